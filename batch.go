@@ -0,0 +1,188 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import "context"
+
+// limitFactory wraps a factory function so that it acquires the
+// semaphore before calling the factory, and releases it afterwards.
+func limitFactory(factory Factory, sem chan struct{}) Factory {
+	return func(ctx context.Context, key Key) *Entry {
+		// Acquire the semaphore
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return &Entry{
+				Error: ctx.Err(),
+				Keys:  []Key{key},
+			}
+		}
+		defer func() { <-sem }()
+
+		return factory(ctx, key)
+	}
+}
+
+// limitGroupFactory wraps a group factory function so that it
+// acquires the semaphore before calling the group factory, and
+// releases it afterwards.
+func limitGroupFactory(factory GroupFactory, sem chan struct{}) GroupFactory {
+	return func(ctx context.Context, key Key) []*Entry {
+		// Acquire the semaphore
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		defer func() { <-sem }()
+
+		return factory(ctx, key)
+	}
+}
+
+// lookupMany is a helper for LookupMany and Preload that looks up
+// each of the keys and returns a list of futures and a list of
+// errors.  The options are processed once for each key, and the
+// processed options for the first key are returned.
+func (fc *FCache) lookupMany(keys []Key, opts []LookupOption, warm bool) ([]*Future, []error, lookupOptions, error) {
+	futures := make([]*Future, len(keys))
+	errs := make([]error, len(keys))
+	var first lookupOptions
+	var sem chan struct{}
+	for i, k := range keys {
+		// Process the options
+		o, err := procLookupOpts(append(opts[:len(opts):len(opts)], ByKey(k)))
+		if err != nil {
+			// Discard the futures we've created
+			for _, f := range futures[:i] {
+				if f != nil {
+					f.Cancel()
+				}
+			}
+			return nil, nil, lookupOptions{}, err
+		}
+
+		// Set up the semaphore
+		if i == 0 {
+			first = o
+			if o.parallel > 0 {
+				sem = make(chan struct{}, o.parallel)
+			}
+		}
+		o.sem = sem
+		o.warm = warm
+
+		// Perform the lookup
+		futures[i], errs[i] = fc.lookup(o)
+	}
+
+	return futures, errs, first, nil
+}
+
+// LookupMany looks up several entries in the cache and returns them.
+// The results are returned as a list of Entry structures in the same
+// order as the keys, with the Object and Error fields set to the
+// results of the lookup of the corresponding key.  The options are
+// applied to each lookup, and may not include ByKey or ByEntry; the
+// Parallelism option may be used to bound the number of factory
+// functions invoked concurrently.  If the context passed with the
+// WithContext option is canceled, LookupMany returns promptly; the
+// entries for lookups that had not completed have the context error.
+func (fc *FCache) LookupMany(keys []Key, opts ...LookupOption) ([]Entry, error) {
+	// Perform the lookups
+	futures, errs, o, err := fc.lookupMany(keys, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	cancel := o.applyTimeout()
+	defer cancel()
+
+	// Wait for the results
+	result := make([]Entry, len(keys))
+	for i, f := range futures {
+		if errs[i] != nil {
+			result[i].Error = errs[i]
+			continue
+		}
+
+		result[i].Object, result[i].Error = f.WaitWithContext(o.ctx)
+		f.Cancel()
+	}
+
+	return result, nil
+}
+
+// Preload looks up several entries in the cache, invoking the index
+// factory functions as necessary, but does not wait for the results.
+// This may be used to warm up the cache.  The options are applied to
+// each lookup, and may not include ByKey or ByEntry; the Parallelism
+// option may be used to bound the number of factory functions invoked
+// concurrently.  If any lookup fails, the first such error is
+// returned.
+func (fc *FCache) Preload(keys []Key, opts ...LookupOption) error {
+	// Perform the lookups
+	futures, errs, _, err := fc.lookupMany(keys, opts, true)
+	if err != nil {
+		return err
+	}
+
+	// Discard the futures
+	for i, f := range futures {
+		if errs[i] != nil {
+			if err == nil {
+				err = errs[i]
+			}
+			continue
+		}
+
+		f.Cancel()
+	}
+
+	return err
+}
+
+// StoreMany inserts several entries into the cache with the cache
+// locked once, completing any pending entries they satisfy.  The
+// entries are inserted as if they had been returned by a factory
+// function, so completed entries already in the cache are not
+// replaced.  Entries with no keys referring to an index of the cache
+// are skipped, and the other entries are still inserted; in that
+// case, an UnmatchedEntriesError is returned listing the positions of
+// the skipped entries.
+func (fc *FCache) StoreMany(entries []Entry) error {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Insert the entries
+	var unmatched []int
+	for i := range entries {
+		ent := entries[i].Clone()
+		if !fc.matches(&ent) {
+			unmatched = append(unmatched, i)
+			continue
+		}
+
+		fc.insert(&ent)
+	}
+
+	if unmatched != nil {
+		return &UnmatchedEntriesError{
+			Entries: unmatched,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,339 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitFactoryBase(t *testing.T) {
+	sem := make(chan struct{}, 1)
+	factory := func(ctx context.Context, key Key) *Entry {
+		assert.Len(t, sem, 1)
+		return &Entry{
+			Object: "object",
+		}
+	}
+
+	result := limitFactory(factory, sem)(context.Background(), Key{"one", 1})
+
+	assert.Equal(t, &Entry{
+		Object: "object",
+	}, result)
+	assert.Len(t, sem, 0)
+}
+
+func TestLimitFactoryCanceled(t *testing.T) {
+	sem := make(chan struct{}, 1)
+	sem <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	factory := func(ctx context.Context, key Key) *Entry {
+		t.Fail()
+		return nil
+	}
+
+	result := limitFactory(factory, sem)(ctx, Key{"one", 1})
+
+	assert.Equal(t, &Entry{
+		Error: context.Canceled,
+		Keys:  []Key{{"one", 1}},
+	}, result)
+	assert.Len(t, sem, 1)
+}
+
+func TestLimitGroupFactoryBase(t *testing.T) {
+	sem := make(chan struct{}, 1)
+	factory := func(ctx context.Context, key Key) []*Entry {
+		assert.Len(t, sem, 1)
+		return []*Entry{{Object: "object"}}
+	}
+
+	result := limitGroupFactory(factory, sem)(context.Background(), Key{"one", 1})
+
+	assert.Equal(t, []*Entry{{Object: "object"}}, result)
+	assert.Len(t, sem, 0)
+}
+
+func TestLimitGroupFactoryCanceled(t *testing.T) {
+	sem := make(chan struct{}, 1)
+	sem <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	factory := func(ctx context.Context, key Key) []*Entry {
+		t.Fail()
+		return nil
+	}
+
+	result := limitGroupFactory(factory, sem)(ctx, Key{"one", 1})
+
+	assert.Nil(t, result)
+	assert.Len(t, sem, 1)
+}
+
+func TestFCacheLookupManyBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+				},
+				factory: func(ctx context.Context, key Key) *Entry {
+					return &Entry{
+						Object: "o2",
+						Keys:   []Key{key},
+					}
+				},
+			},
+		},
+	}
+
+	result, err := obj.LookupMany([]Key{{"one", 1}, {"one", 2}, {"two", 3}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Object: "o1"},
+		{Object: "o2"},
+		{Error: ErrBadIndex},
+	}, result)
+}
+
+func TestFCacheLookupManyCanceled(t *testing.T) {
+	release := make(chan struct{})
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+				},
+				factory: func(ctx context.Context, key Key) *Entry {
+					<-release
+					return &Entry{
+						Object: "o2",
+						Keys:   []Key{key},
+					}
+				},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := obj.LookupMany([]Key{{"one", 1}, {"one", 2}}, WithContext(ctx))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Object: "o1"},
+		{Error: context.Canceled},
+	}, result)
+	close(release)
+	object, err := obj.Lookup(ByKey(Key{"one", 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, "o2", object)
+}
+
+func TestFCacheLookupManyParallelism(t *testing.T) {
+	var mu sync.Mutex
+	active := 0
+	maxActive := 0
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(ctx context.Context, key Key) *Entry {
+					mu.Lock()
+					active++
+					if active > maxActive {
+						maxActive = active
+					}
+					mu.Unlock()
+					defer func() {
+						mu.Lock()
+						active--
+						mu.Unlock()
+					}()
+					return &Entry{
+						Object: key.Key,
+						Keys:   []Key{key},
+					}
+				},
+			},
+		},
+	}
+	keys := []Key{}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, Key{"one", i})
+	}
+
+	result, err := obj.LookupMany(keys, Parallelism(2))
+
+	assert.NoError(t, err)
+	for i, ent := range result {
+		assert.Equal(t, Entry{Object: i}, ent)
+	}
+	assert.LessOrEqual(t, maxActive, 2)
+}
+
+func TestFCacheLookupManyBadOption(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.LookupMany([]Key{{"one", 1}}, ByKey(Key{"one", 2}))
+
+	assert.Same(t, ErrDuplicateOption, err)
+	assert.Nil(t, result)
+}
+
+func TestFCachePreloadBase(t *testing.T) {
+	done := make(chan struct{})
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(ctx context.Context, key Key) *Entry {
+					defer close(done)
+					return &Entry{
+						Object: "o1",
+						Keys:   []Key{key},
+					}
+				},
+			},
+		},
+	}
+
+	err := obj.Preload([]Key{{"one", 1}})
+
+	assert.NoError(t, err)
+	<-done
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "o1", result)
+}
+
+func TestFCachePreloadLookupError(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := obj.Preload([]Key{{"one", 1}, {"two", 2}, {"three", 3}})
+
+	assert.Same(t, ErrBadIndex, err)
+}
+
+func TestFCachePreloadBadOption(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.Preload([]Key{{"one", 1}}, ByKey(Key{"one", 2}))
+
+	assert.Same(t, ErrDuplicateOption, err)
+}
+
+func TestFCacheStoreManyBase(t *testing.T) {
+	pending := &entry{}
+	existing := &entry{
+		content: &Entry{
+			Object: "existing",
+			Keys:   []Key{{"two", 3}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					2: pending,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					3: existing,
+				},
+			},
+		},
+	}
+	entries := []Entry{
+		{Object: "object1", Keys: []Key{{"one", 1}, {"two", 1}}},
+		{Object: "object2", Keys: []Key{{"one", 2}}},
+		{Object: "object3", Keys: []Key{{"two", 3}}},
+	}
+
+	err := obj.StoreMany(entries)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object1", obj.indexes["one"].entries[1].content.Object)
+	assert.Same(t, obj.indexes["one"].entries[1], obj.indexes["two"].entries[1])
+	assert.Equal(t, "object2", pending.content.Object)
+	assert.Same(t, existing, obj.indexes["two"].entries[3])
+	assert.Equal(t, "existing", existing.content.Object)
+	assert.Equal(t, uint64(0), entries[0].Version)
+}
+
+func TestFCacheStoreManyUnmatched(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	err := obj.StoreMany([]Entry{
+		{Object: "object0", Keys: []Key{{"two", 0}}},
+		{Object: "object1", Keys: []Key{{"one", 1}}},
+		{Object: "object2"},
+	})
+
+	assert.Equal(t, &UnmatchedEntriesError{
+		Entries: []int{0, 2},
+	}, err)
+	assert.True(t, errors.Is(err, ErrNoMatchingIndex))
+	assert.Len(t, obj.indexes["one"].entries, 1)
+	assert.Equal(t, "object1", obj.indexes["one"].entries[1].content.Object)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import "reflect"
+
+// EntryBuilder is a helper for constructing an Entry with several
+// keys.  Construct one with NewEntryBuilder, add keys with WithKey,
+// then call Build to obtain the Entry.
+type EntryBuilder struct {
+	ent Entry // The entry being constructed
+}
+
+// NewEntryBuilder returns an EntryBuilder for an entry containing the
+// specified object.
+func NewEntryBuilder(object interface{}) *EntryBuilder {
+	return &EntryBuilder{
+		ent: Entry{
+			Object: object,
+		},
+	}
+}
+
+// WithError sets the error for the entry being built.
+func (b *EntryBuilder) WithError(err error) *EntryBuilder {
+	b.ent.Error = err
+	return b
+}
+
+// WithKey adds a key to the entry being built.  Keys that have
+// already been added are ignored; keys are compared with
+// reflect.DeepEqual, so keys that are not comparable may be added.
+func (b *EntryBuilder) WithKey(index, key interface{}) *EntryBuilder {
+	k := Key{
+		Index: index,
+		Key:   key,
+	}
+
+	// Skip duplicate keys
+	for _, tmp := range b.ent.Keys {
+		if reflect.DeepEqual(tmp, k) {
+			return b
+		}
+	}
+
+	b.ent.Keys = append(b.ent.Keys, k)
+	return b
+}
+
+// Build returns the constructed entry.  If no keys have been added,
+// ErrNoKeys is returned.
+func (b *EntryBuilder) Build() (*Entry, error) {
+	if len(b.ent.Keys) <= 0 {
+		return nil, ErrNoKeys
+	}
+
+	// Copy the entry so the builder may be reused
+	ent := b.ent
+	ent.Keys = append([]Key(nil), b.ent.Keys...)
+
+	return &ent, nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEntryBuilder(t *testing.T) {
+	result := NewEntryBuilder("object")
+
+	assert.Equal(t, &EntryBuilder{
+		ent: Entry{
+			Object: "object",
+		},
+	}, result)
+}
+
+func TestEntryBuilderWithError(t *testing.T) {
+	obj := &EntryBuilder{}
+
+	result := obj.WithError(assert.AnError)
+
+	assert.Same(t, obj, result)
+	assert.Same(t, assert.AnError, obj.ent.Error)
+}
+
+func TestEntryBuilderWithKey(t *testing.T) {
+	obj := &EntryBuilder{}
+
+	result := obj.WithKey("one", 1).WithKey("two", 2).WithKey("one", 1)
+
+	assert.Same(t, obj, result)
+	assert.Equal(t, []Key{{"one", 1}, {"two", 2}}, obj.ent.Keys)
+}
+
+func TestEntryBuilderWithKeyUncomparable(t *testing.T) {
+	obj := &EntryBuilder{}
+
+	result := obj.WithKey("one", []int{1}).WithKey("one", []int{1}).WithKey("one", []int{2})
+
+	assert.Same(t, obj, result)
+	assert.Equal(t, []Key{{"one", []int{1}}, {"one", []int{2}}}, obj.ent.Keys)
+}
+
+func TestEntryBuilderBuildBase(t *testing.T) {
+	obj := &EntryBuilder{
+		ent: Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+
+	result, err := obj.Build()
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}, result)
+	result.Keys[0] = Key{"two", 2}
+	assert.Equal(t, []Key{{"one", 1}}, obj.ent.Keys)
+}
+
+func TestEntryBuilderBuildNoKeys(t *testing.T) {
+	obj := &EntryBuilder{
+		ent: Entry{
+			Object: "object",
+		},
+	}
+
+	result, err := obj.Build()
+
+	assert.Same(t, ErrNoKeys, err)
+	assert.Nil(t, result)
+}
@@ -14,12 +14,20 @@
 
 package fcache
 
-import "context"
-
 // Clean is used to clean things out of the cache.  The specific
 // things to clean up are specified through the options passed in; if
 // no options are passed in, the cache will be completely cleared.
+// Callers waiting on pending entries that are cleaned receive
+// ErrCacheCleaned.
 func (fc *FCache) Clean(opts ...CleanOption) {
+	fc.CleanPlan(opts...)
+}
+
+// CleanPlan is similar to Clean, but also returns the keys removed
+// from the cache, as a map from the index to the list of keys removed
+// from that index.  If the DryRun option is passed, the keys that
+// would be removed are returned, but the cache is not altered.
+func (fc *FCache) CleanPlan(opts ...CleanOption) map[interface{}][]interface{} {
 	// Lock the cache
 	fc.Lock()
 	defer fc.Unlock()
@@ -27,28 +35,47 @@ func (fc *FCache) Clean(opts ...CleanOption) {
 	// Process the options
 	o := procCleanOpts(opts)
 
-	// Clear the desired objects
-	for _, idx := range fc.indexes {
-		// Find the entries to remove
-		toRemove := []interface{}{}
+	// Find the desired objects; completed entries without an error
+	// hold objects, even if the cached object is nil
+	plan := map[interface{}][]interface{}{}
+	for index, idx := range fc.indexes {
 		for key, ent := range idx.entries {
-			if ent.content == nil {
-				if o.pending {
-					ent.complete(&Entry{
-						Error: context.Canceled,
+			if (ent.content == nil && o.pending) ||
+				(ent.content != nil && o.objects && (ent.content.Object != nil || ent.content.Error == nil)) ||
+				(ent.content != nil && o.errors && ent.content.Error != nil) {
+				plan[index] = append(plan[index], key)
+			}
+		}
+	}
+
+	// Clear the desired objects
+	if !o.dryRun {
+		seen := map[*Entry]bool{}
+		for index, keys := range plan {
+			idx := fc.indexes[index]
+			for _, key := range keys {
+				ent := idx.entries[key]
+				if ent.content == nil {
+					idx.complete(ent, &Entry{
+						Error: ErrCacheCleaned,
 					})
-					toRemove = append(toRemove, key)
+					fc.stats.ExplicitEvictions++
+				} else {
+					if !seen[ent.content] {
+						seen[ent.content] = true
+						fc.stats.ExplicitEvictions++
+					}
+					idx.evicted(ent.content)
 				}
-			} else if o.objects && ent.content.Object != nil {
-				toRemove = append(toRemove, key)
-			} else if o.errors && ent.content.Error != nil {
-				toRemove = append(toRemove, key)
+				delete(idx.entries, key)
 			}
 		}
 
-		// Remove the entries
-		for _, k := range toRemove {
-			delete(idx.entries, k)
+		// Forget the tags of the cleaned entries
+		for content := range seen {
+			fc.untag(content)
 		}
 	}
+
+	return plan
 }
@@ -78,6 +78,37 @@ func TestFCacheCleanBase(t *testing.T) {
 	assert.True(t, cancel4Called)
 }
 
+func TestFCacheCleanNilObject(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{},
+					},
+					2: {
+						content: &Entry{
+							Error: assert.AnError,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	obj.Clean(Objects)
+
+	assert.Equal(t, map[interface{}]*entry{
+		2: {
+			content: &Entry{
+				Error: assert.AnError,
+			},
+		},
+	}, obj.indexes["one"].entries)
+	obj.Clean()
+	assert.Len(t, obj.indexes["one"].entries, 0)
+}
+
 func TestFCacheCleanObjects(t *testing.T) {
 	cancel1Called := false
 	cancel4Called := false
@@ -251,3 +282,98 @@ func TestFCacheCleanPending(t *testing.T) {
 	assert.True(t, cancel1Called)
 	assert.True(t, cancel4Called)
 }
+
+func TestFCacheCleanPendingError(t *testing.T) {
+	ent := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+	f := ent.makeFuture(obj)
+
+	obj.Clean(Pending)
+
+	result, err := f.Wait()
+	assert.Same(t, ErrCacheCleaned, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheCleanPlanBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+					2: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+					3: {
+						content: &Entry{
+							Error: assert.AnError,
+						},
+					},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					4: {
+						content: &Entry{
+							Error: assert.AnError,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result := obj.CleanPlan(Objects)
+
+	assert.Equal(t, map[interface{}][]interface{}{
+		"one": {2},
+	}, result)
+	assert.Len(t, obj.indexes["one"].entries, 2)
+	assert.Len(t, obj.indexes["two"].entries, 1)
+}
+
+func TestFCacheCleanPlanDryRun(t *testing.T) {
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+					2: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					3: {
+						content: &Entry{
+							Error: assert.AnError,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result := obj.CleanPlan(DryRun)
+
+	assert.Len(t, result, 2)
+	assert.ElementsMatch(t, []interface{}{1, 2}, result["one"])
+	assert.Equal(t, []interface{}{3}, result["two"])
+	assert.Len(t, obj.indexes["one"].entries, 2)
+	assert.Len(t, obj.indexes["two"].entries, 1)
+	assert.Nil(t, pending.content)
+}
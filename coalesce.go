@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import "reflect"
+
+// Operations that may be coalesced.
+const (
+	opEvict   = "evict"   // An Evict call
+	opReindex = "reindex" // A Reindex call
+)
+
+// callKey identifies a mutation that may be coalesced.
+type callKey struct {
+	op  string // The operation
+	key Key    // The key the operation applies to
+}
+
+// call describes a mutation that is waiting for the cache lock.
+// Identical mutations made while it waits share its result.
+type call struct {
+	args []Key         // Additional arguments of the operation
+	done chan struct{} // Closed when the operation completes
+	err  error         // The result of the operation
+}
+
+// comparableKey checks whether a key may be used to identify a
+// mutation, that is, whether its index and key may be compared.
+func comparableKey(key Key) bool {
+	for _, v := range []interface{}{key.Index, key.Key} {
+		if v != nil && !reflect.TypeOf(v).Comparable() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// coalesced locks the cache and calls the specified function, which
+// performs the mutation identified by op, key, and args.  If the cache
+// was constructed with the CoalesceMutations option and an identical
+// mutation is waiting for the cache lock, the function is not called;
+// instead, coalesced waits for that mutation to complete and returns
+// its result.
+func (fc *FCache) coalesced(op string, key Key, args []Key, fn func() error) error {
+	// Just call the function if we're not coalescing
+	if !fc.coalesce || !comparableKey(key) {
+		fc.Lock()
+		defer fc.Unlock()
+
+		return fn()
+	}
+
+	// Look for an identical mutation waiting for the lock
+	ck := callKey{
+		op:  op,
+		key: key,
+	}
+	fc.callLock.Lock()
+	c, ok := fc.calls[ck]
+	if ok && reflect.DeepEqual(c.args, args) {
+		fc.callLock.Unlock()
+		<-c.done
+		return c.err
+	}
+
+	// Register the mutation, unless a different one is waiting
+	c = &call{
+		args: args,
+		done: make(chan struct{}),
+	}
+	if !ok {
+		if fc.calls == nil {
+			fc.calls = map[callKey]*call{}
+		}
+		fc.calls[ck] = c
+	}
+	fc.callLock.Unlock()
+
+	// Lock the cache; once locked, the mutation may no longer be
+	// shared, since its effect may be observed before later calls
+	defer close(c.done)
+	fc.Lock()
+	defer fc.Unlock()
+	fc.callLock.Lock()
+	if fc.calls[ck] == c {
+		delete(fc.calls, ck)
+	}
+	fc.callLock.Unlock()
+
+	// Perform the mutation
+	c.err = fn()
+
+	return c.err
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComparableKeyTrue(t *testing.T) {
+	result := comparableKey(Key{"one", 1})
+
+	assert.True(t, result)
+}
+
+func TestComparableKeyNil(t *testing.T) {
+	result := comparableKey(Key{"one", nil})
+
+	assert.True(t, result)
+}
+
+func TestComparableKeyFalse(t *testing.T) {
+	result := comparableKey(Key{"one", []int{1}})
+
+	assert.False(t, result)
+}
+
+// waitCall waits for a mutation to be registered with the cache.
+func waitCall(fc *FCache, ck callKey) {
+	for {
+		fc.callLock.Lock()
+		_, ok := fc.calls[ck]
+		fc.callLock.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFCacheCoalescedDisabled(t *testing.T) {
+	obj := &FCache{}
+	calls := 0
+
+	err := obj.coalesced(opEvict, Key{"one", 1}, nil, func() error {
+		calls++
+		return assert.AnError
+	})
+
+	assert.Same(t, assert.AnError, err)
+	assert.Equal(t, 1, calls)
+	assert.Nil(t, obj.calls)
+}
+
+func TestFCacheCoalescedShared(t *testing.T) {
+	obj := &FCache{
+		coalesce: true,
+	}
+	key := Key{"one", 1}
+	args := []Key{{"two", 2}}
+	calls := 0
+	fn := func() error {
+		calls++
+		return assert.AnError
+	}
+	errs := make([]error, 2)
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	obj.Lock()
+	go func() {
+		defer wg.Done()
+		errs[0] = obj.coalesced(opReindex, key, args, fn)
+	}()
+	waitCall(obj, callKey{opReindex, key})
+	go func() {
+		defer wg.Done()
+		errs[1] = obj.coalesced(opReindex, key, []Key{{"two", 2}}, fn)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	obj.Unlock()
+	wg.Wait()
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []error{assert.AnError, assert.AnError}, errs)
+	assert.Len(t, obj.calls, 0)
+}
+
+func TestFCacheCoalescedDifferentArgs(t *testing.T) {
+	obj := &FCache{
+		coalesce: true,
+	}
+	key := Key{"one", 1}
+	calls := 0
+	fn := func() error {
+		calls++
+		return nil
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	obj.Lock()
+	go func() {
+		defer wg.Done()
+		obj.coalesced(opReindex, key, []Key{{"two", 2}}, fn)
+	}()
+	waitCall(obj, callKey{opReindex, key})
+	go func() {
+		defer wg.Done()
+		obj.coalesced(opReindex, key, []Key{{"two", 3}}, fn)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	obj.Unlock()
+	wg.Wait()
+
+	assert.Equal(t, 2, calls)
+	assert.Len(t, obj.calls, 0)
+}
+
+func TestFCacheCoalescedStarted(t *testing.T) {
+	obj := &FCache{
+		coalesce: true,
+	}
+	key := Key{"one", 1}
+	calls := 0
+
+	err := obj.coalesced(opEvict, key, nil, func() error {
+		calls++
+		return nil
+	})
+	assert.NoError(t, err)
+	err = obj.coalesced(opEvict, key, nil, func() error {
+		calls++
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Len(t, obj.calls, 0)
+}
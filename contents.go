@@ -14,11 +14,35 @@
 
 package fcache
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
 // Contents returns all completed entries in the specified cache
 // index.  Only completed entries are returned; any uncompleted
-// entries are skipped.  What is returned is a list of Entry
-// structures; this allows Contents to return cached errors.
-func (fc *FCache) Contents(index interface{}) ([]Entry, error) {
+// entries are skipped, unless the ContentsIncludePending option is
+// passed.  What is returned is a list of Entry structures; this allows
+// Contents to return cached errors.  The Keys of the returned entries
+// are copies, and may be safely altered.
+func (fc *FCache) Contents(index interface{}, opts ...ContentsOption) ([]Entry, error) {
+	return fc.contents(index, -1, procContentsOpts(opts))
+}
+
+// ContentsLimit is similar to Contents, but returns at most n
+// completed entries from the specified cache index; a negative n
+// returns all completed entries.  Note that the selection of entries
+// is arbitrary, and may differ from call to call.
+func (fc *FCache) ContentsLimit(index interface{}, n int) ([]Entry, error) {
+	return fc.contents(index, n, contentsOptions{})
+}
+
+// contents is a helper for Contents and ContentsLimit that returns at
+// most n entries from the specified cache index; a negative n returns
+// all entries.  Pending entries are returned as placeholders if
+// requested by the options.
+func (fc *FCache) contents(index interface{}, n int, o contentsOptions) ([]Entry, error) {
 	// Lock the cache
 	fc.Lock()
 	defer fc.Unlock()
@@ -30,20 +54,250 @@ func (fc *FCache) Contents(index interface{}) ([]Entry, error) {
 	}
 
 	// Initialize a container for entries
-	result := make([]Entry, 0, len(idx.entries))
-	for _, ent := range idx.entries {
+	size := len(idx.entries)
+	if n >= 0 && n < size {
+		size = n
+	}
+	result := make([]Entry, 0, size)
+	for key, ent := range idx.entries {
+		if n >= 0 && len(result) >= n {
+			break
+		}
 		if ent.content != nil {
-			result = append(result, *ent.content)
+			result = append(result, ent.content.Clone())
+		} else if o.pending {
+			result = append(result, Entry{
+				Keys:    []Key{{Index: index, Key: key}},
+				Pending: true,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// MultiContents is similar to Contents, but returns the completed
+// entries of several cache indexes, as a map from the index to the
+// list of entries.  The entries of all the indexes are collected with
+// the cache locked once, so the results are consistent with each
+// other: an object present in several of the indexes is reported in
+// each of them.  Returns ErrBadIndex if any of the indexes does not
+// exist.
+func (fc *FCache) MultiContents(indexes ...interface{}) (map[interface{}][]Entry, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the indexes
+	idxs := make([]index, len(indexes))
+	for i, key := range indexes {
+		idx, ok := fc.indexes[key]
+		if !ok {
+			return nil, ErrBadIndex
+		}
+		idxs[i] = idx
+	}
+
+	// Collect the entries
+	result := make(map[interface{}][]Entry, len(indexes))
+	for i, idx := range idxs {
+		ents := make([]Entry, 0, len(idx.entries))
+		for _, ent := range idx.entries {
+			if ent.content != nil {
+				ents = append(ents, ent.content.Clone())
+			}
 		}
+		result[indexes[i]] = ents
+	}
+
+	return result, nil
+}
+
+// ContentsObjects is similar to Contents, but returns only the objects
+// of the completed entries in the specified cache index.  Entries
+// containing cached errors are skipped, as are uncompleted entries.
+func (fc *FCache) ContentsObjects(index interface{}) ([]interface{}, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return nil, ErrBadIndex
+	}
+
+	// Collect the objects
+	result := make([]interface{}, 0, len(idx.entries))
+	for _, ent := range idx.entries {
+		if ent.content != nil && ent.content.Error == nil {
+			result = append(result, ent.content.Object)
+		}
+	}
+
+	return result, nil
+}
+
+// contentsBatch is the number of entries ContentsChan fetches from
+// the cache each time it locks the cache.  It is also the size of the
+// buffer of the returned channel.
+var contentsBatch = 100
+
+// ContentsChan is similar to Contents, but returns a channel from
+// which the completed entries in the specified cache index may be
+// received; the channel is closed after the last entry is sent, or
+// when the context is canceled.  The keys of the index are captured
+// when ContentsChan is called, and the entries are fetched in batches
+// to avoid holding the cache lock for a long time; entries evicted
+// before they are fetched are skipped.
+func (fc *FCache) ContentsChan(ctx context.Context, index interface{}) (<-chan Entry, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return nil, ErrBadIndex
 	}
 
+	// Capture the keys
+	keys := make([]interface{}, 0, len(idx.entries))
+	for key := range idx.entries {
+		keys = append(keys, key)
+	}
+
+	// Send the entries in the background
+	result := make(chan Entry, contentsBatch)
+	go fc.contentsChan(ctx, index, keys, result)
+
 	return result, nil
 }
 
+// contentsChan sends the contents of the specified keys to the
+// result channel.  It MUST be called as a goroutine.
+func (fc *FCache) contentsChan(ctx context.Context, index interface{}, keys []interface{}, result chan<- Entry) {
+	defer close(result)
+
+	for len(keys) > 0 {
+		// Select the next batch of keys
+		batch := keys
+		if len(batch) > contentsBatch {
+			batch = batch[:contentsBatch]
+		}
+		keys = keys[len(batch):]
+
+		// Fetch the completed entries
+		fc.Lock()
+		idx, ok := fc.indexes[index]
+		ents := make([]Entry, 0, len(batch))
+		for _, key := range batch {
+			if !ok {
+				break
+			}
+			if ent, ok := idx.entries[key]; ok && ent.content != nil {
+				ents = append(ents, ent.content.Clone())
+			}
+		}
+		fc.Unlock()
+
+		// Send them to the channel
+		for _, ent := range ents {
+			select {
+			case result <- ent:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
 // ContentsFuture is similar to Contents, but returns Future instances
 // for all entries in the specified cache index, including pending
 // entries.
 func (fc *FCache) ContentsFuture(index interface{}) ([]*Future, error) {
+	return fc.contentsFuture(index)
+}
+
+// ContentsFutureWithContext is similar to ContentsFuture, but accepts
+// a context.Context.  When the context is canceled, the returned
+// futures that are still waiting on pending entries are released;
+// waiting on such a future will return ErrNotCached.  This allows
+// callers to abandon the returned futures without waiting on all of
+// them.  Each returned future has its own result channel, even if the
+// cache was created with SharedNotify, so that it may be released.
+// The context is watched by a goroutine, which exits once the context
+// is canceled or all the pending entries have been completed.  With
+// the AutoCancel option, releasing the last future waiting on a
+// pending entry cancels its factory call, as Future.Cancel does.
+func (fc *FCache) ContentsFutureWithContext(ctx context.Context, index interface{}) ([]*Future, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return nil, ErrBadIndex
+	}
+
+	// Construct the futures, collecting the notification channels
+	// of the pending entries
+	result := make([]*Future, 0, len(idx.entries))
+	var pending []<-chan struct{}
+	for _, ent := range idx.entries {
+		result = append(result, ent.requestFuture(fc))
+		if ent.content == nil {
+			if ent.done == nil {
+				ent.done = make(chan struct{})
+			}
+			pending = append(pending, ent.done)
+		}
+	}
+
+	// Release the futures when the context is done
+	if len(pending) > 0 {
+		go fc.releaseOnDone(ctx, result, pending)
+	}
+
+	return result, nil
+}
+
+// releaseOnDone releases the specified futures if the context is
+// canceled before all the pending entries, identified by their
+// notification channels, have been completed.  It MUST be called as
+// a goroutine.
+func (fc *FCache) releaseOnDone(ctx context.Context, futures []*Future, pending []<-chan struct{}) {
+	for _, done := range pending {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			fc.release(futures)
+			return
+		}
+	}
+}
+
+// release releases the result channels of the specified futures that
+// are still waiting on pending entries.  The channels are closed
+// without sending a result, and, as with Future.Cancel, entries no
+// longer waited on are abandoned.
+func (fc *FCache) release(futures []*Future) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	for _, f := range futures {
+		if req, ok := f.ent.reqs[f.cookie]; ok {
+			close(req)
+			delete(f.ent.reqs, f.cookie)
+			fc.abandon(f.ent)
+		}
+	}
+}
+
+// contentsFuture is the implementation of ContentsFuture.
+func (fc *FCache) contentsFuture(index interface{}) ([]*Future, error) {
 	// Lock the cache
 	fc.Lock()
 	defer fc.Unlock()
@@ -62,3 +316,158 @@ func (fc *FCache) ContentsFuture(index interface{}) ([]*Future, error) {
 
 	return result, nil
 }
+
+// AllObjects returns all completed entries in the cache, across all
+// indexes.  Since an object may be present in several indexes, the
+// results are deduplicated, so each distinct cached object appears
+// exactly once.  As with Contents, uncompleted entries are skipped,
+// and cached errors are included.
+func (fc *FCache) AllObjects() []Entry {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Walk through all the indexes, skipping objects we've seen
+	seen := map[*Entry]bool{}
+	result := []Entry{}
+	for _, idx := range fc.indexes {
+		for _, ent := range idx.entries {
+			if ent.content == nil || seen[ent.content] {
+				continue
+			}
+
+			seen[ent.content] = true
+			result = append(result, ent.content.Clone())
+		}
+	}
+
+	return result
+}
+
+// ObjectsWithKeys is similar to AllObjects, but the Keys of each
+// returned entry list exactly the keys under which the entry may
+// currently be found in the cache.  Keys of the entry referring to
+// indexes that do not exist, or under which another entry is now
+// cached, are omitted.  The whole cache is read with the lock held
+// once, so the results are consistent.
+func (fc *FCache) ObjectsWithKeys() []Entry {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Walk through all the indexes, skipping objects we've seen
+	seen := map[*Entry]bool{}
+	result := []Entry{}
+	for _, idx := range fc.indexes {
+		for _, ent := range idx.entries {
+			if ent.content == nil || seen[ent.content] {
+				continue
+			}
+			seen[ent.content] = true
+
+			// Select the keys that reach the object
+			content := ent.content.Clone()
+			content.Keys = make([]Key, 0, len(ent.content.Keys))
+			for _, k := range ent.content.Keys {
+				if kIdx, ok := fc.indexes[k.Index]; ok {
+					if e, ok := kIdx.entries[kIdx.hash(k.Key)]; ok && e.content == ent.content {
+						content.Keys = append(content.Keys, k)
+					}
+				}
+			}
+			result = append(result, content)
+		}
+	}
+
+	return result
+}
+
+// Errors returns the errors cached in the specified cache index, as a
+// map from the key within the index to the error.  Only completed
+// entries are considered.  If the index has a KeyHasher, the map is
+// keyed by the values returned by the KeyHasher.
+func (fc *FCache) Errors(index interface{}) (map[interface{}]error, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return nil, ErrBadIndex
+	}
+
+	// Collect the errors
+	result := map[interface{}]error{}
+	for key, ent := range idx.entries {
+		if ent.content != nil && ent.content.Error != nil {
+			result[key] = ent.content.Error
+		}
+	}
+
+	return result, nil
+}
+
+// RetryableKeys returns the keys of the specified cache index whose
+// completed entries contain a RetryableError, as a map from the key
+// within the index to the time after which the lookup will be
+// retried.  This allows a scheduler to refresh such entries as soon
+// as they become retryable.  Note that the returned times may already
+// have passed.  If the index has a KeyHasher, the map is keyed by the
+// values returned by the KeyHasher.
+func (fc *FCache) RetryableKeys(index interface{}) (map[interface{}]time.Time, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return nil, ErrBadIndex
+	}
+
+	// Collect the retry times
+	result := map[interface{}]time.Time{}
+	for key, ent := range idx.entries {
+		if ent.content == nil || ent.content.Error == nil {
+			continue
+		}
+		var tmp *RetryableError
+		if errors.As(ent.content.Error, &tmp) {
+			result[key] = tmp.After
+		}
+	}
+
+	return result, nil
+}
+
+// Fingerprint returns a lightweight fingerprint of the specified cache
+// index, which may be compared to a fingerprint of the same index
+// taken at another time, or from another cache, to detect divergence.
+// The fingerprint is a map from the key within the index to the result
+// of calling the hash function on the completed entry with that key;
+// pending entries are skipped.  If the index has a KeyHasher, the map
+// is keyed by the values returned by the KeyHasher.  The hash function
+// is called with the cache locked, and must not call any methods of
+// the cache.
+func (fc *FCache) Fingerprint(index interface{}, hash func(Entry) uint64) (map[interface{}]uint64, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return nil, ErrBadIndex
+	}
+
+	// Hash the entries
+	result := make(map[interface{}]uint64, len(idx.entries))
+	for key, ent := range idx.entries {
+		if ent.content != nil {
+			result[key] = hash(*ent.content)
+		}
+	}
+
+	return result, nil
+}
@@ -15,9 +15,13 @@
 package fcache
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/klmitch/patcher"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFCacheContentsBase(t *testing.T) {
@@ -63,6 +67,60 @@ func TestFCacheContentsBase(t *testing.T) {
 	}, result)
 }
 
+func TestFCacheContentsIncludePending(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					"o1": {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+					"o2": {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Contents("idx", ContentsIncludePending)
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Entry{
+		{
+			Object: "o1",
+		},
+		{
+			Keys:    []Key{{"idx", "o2"}},
+			Pending: true,
+		},
+	}, result)
+}
+
+func TestFCacheContentsCopiesKeys(t *testing.T) {
+	content := &Entry{
+		Object: "o1",
+		Keys:   []Key{{"idx", "o1"}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					"o1": {
+						content: content,
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Contents("idx")
+	result[0].Keys[0] = Key{"idx", "mutated"}
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Key{{"idx", "o1"}}, content.Keys)
+}
+
 func TestFCacheContentsBadIndex(t *testing.T) {
 	obj := &FCache{
 		indexes: map[interface{}]index{},
@@ -74,6 +132,271 @@ func TestFCacheContentsBadIndex(t *testing.T) {
 	assert.Nil(t, result)
 }
 
+func TestFCacheContentsLimitBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					"o1": {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+					"o2": {
+						content: &Entry{
+							Object: "o2",
+						},
+					},
+					"o3": {
+						content: &Entry{
+							Object: "o3",
+						},
+					},
+					"o4": {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.ContentsLimit("idx", 2)
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	for _, ent := range result {
+		assert.Contains(t, []interface{}{"o1", "o2", "o3"}, ent.Object)
+	}
+}
+
+func TestFCacheContentsLimitZero(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					"o1": {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.ContentsLimit("idx", 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{}, result)
+}
+
+func TestFCacheContentsLimitBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.ContentsLimit("idx", 2)
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheMultiContentsBase(t *testing.T) {
+	content := &Entry{
+		Object: "shared",
+		Keys:   []Key{{"one", 1}, {"two", 2}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {content: content},
+					3: {},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: {content: content},
+				},
+			},
+			"three": {
+				entries: map[interface{}]*entry{
+					3: {
+						content: &Entry{
+							Object: "other",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.MultiContents("one", "two")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}][]Entry{
+		"one": {*content},
+		"two": {*content},
+	}, result)
+}
+
+func TestFCacheMultiContentsBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result, err := obj.MultiContents("one", "two")
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheContentsObjectsBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "one",
+							Keys:   []Key{{"idx", 1}},
+						},
+					},
+					2: {
+						content: &Entry{
+							Object: "two",
+							Keys:   []Key{{"idx", 2}},
+						},
+					},
+					3: {
+						content: &Entry{
+							Error: assert.AnError,
+							Keys:  []Key{{"idx", 3}},
+						},
+					},
+					4: {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.ContentsObjects("idx")
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []interface{}{"one", "two"}, result)
+}
+
+func TestFCacheContentsObjectsBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.ContentsObjects("idx")
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheContentsChanBase(t *testing.T) {
+	defer patcher.SetVar(&contentsBatch, 2).Install().Restore()
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					"o1": {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+					"o2": {
+						content: &Entry{
+							Error: assert.AnError,
+						},
+					},
+					"o3": {
+						content: &Entry{
+							Object: "o3",
+						},
+					},
+					"o4": {},
+				},
+			},
+		},
+	}
+
+	ch, err := obj.ContentsChan(context.Background(), "idx")
+
+	assert.NoError(t, err)
+	result := []Entry{}
+	for ent := range ch {
+		result = append(result, ent)
+	}
+	assert.ElementsMatch(t, []Entry{
+		{
+			Object: "o1",
+		},
+		{
+			Error: assert.AnError,
+		},
+		{
+			Object: "o3",
+		},
+	}, result)
+}
+
+func TestFCacheContentsChanCanceled(t *testing.T) {
+	defer patcher.SetVar(&contentsBatch, 1).Install().Restore()
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					"o1": {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+					"o2": {
+						content: &Entry{
+							Object: "o2",
+						},
+					},
+					"o3": {
+						content: &Entry{
+							Object: "o3",
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	ch, err := obj.ContentsChan(ctx, "idx")
+	time.Sleep(10 * time.Millisecond)
+
+	assert.NoError(t, err)
+	count := 0
+	for range ch {
+		count++
+	}
+	assert.True(t, count <= 1)
+}
+
+func TestFCacheContentsChanBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	ch, err := obj.ContentsChan(context.Background(), "idx")
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, ch)
+}
+
 func TestFCacheContentsFutureBase(t *testing.T) {
 	obj := &FCache{
 		indexes: map[interface{}]index{
@@ -125,3 +448,493 @@ func TestFCacheContentsFutureBadIndex(t *testing.T) {
 	assert.Same(t, ErrBadIndex, err)
 	assert.Nil(t, result)
 }
+
+func TestFCacheAllObjects(t *testing.T) {
+	ent1 := &entry{
+		content: &Entry{
+			Object: "o1",
+			Keys:   []Key{{"one", 1}, {"two", 1}},
+		},
+	}
+	ent2 := &entry{
+		content: &Entry{
+			Error: &PermanentError{assert.AnError},
+			Keys:  []Key{{"one", 2}},
+		},
+	}
+	ent3 := &entry{
+		content: &Entry{
+			Object: "o3",
+			Keys:   []Key{{"one", 3}, {"two", 3}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent1,
+					2: ent2,
+					3: ent3,
+					4: {},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					1: ent1,
+					3: {
+						content: ent3.content,
+					},
+				},
+			},
+		},
+	}
+
+	result := obj.AllObjects()
+
+	assert.ElementsMatch(t, []Entry{
+		*ent1.content,
+		*ent2.content,
+		*ent3.content,
+	}, result)
+}
+
+func TestFCacheObjectsWithKeys(t *testing.T) {
+	ent1 := &entry{
+		content: &Entry{
+			Object: "o1",
+			Keys:   []Key{{"one", 1}, {"two", 1}, {"three", 1}},
+		},
+	}
+	ent2 := &entry{
+		content: &Entry{
+			Object: "o2",
+			Keys:   []Key{{"one", 2}, {"two", 2}},
+		},
+	}
+	ent3 := &entry{
+		content: &Entry{
+			Object: "o3",
+			Keys:   []Key{{"two", 2}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent1,
+					2: ent2,
+					3: {},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: ent1.content,
+					},
+					2: ent3,
+				},
+			},
+		},
+	}
+
+	result := obj.ObjectsWithKeys()
+
+	assert.ElementsMatch(t, []Entry{
+		{
+			Object: "o1",
+			Keys:   []Key{{"one", 1}, {"two", 1}},
+		},
+		{
+			Object: "o2",
+			Keys:   []Key{{"one", 2}},
+		},
+		{
+			Object: "o3",
+			Keys:   []Key{{"two", 2}},
+		},
+	}, result)
+	assert.Equal(t, []Key{{"one", 1}, {"two", 1}, {"three", 1}}, ent1.content.Keys)
+}
+
+func TestFCacheObjectsWithKeysTags(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "o1",
+			Keys:   []Key{{"one", 1}},
+			Tags:   []string{"a"},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	result := obj.ObjectsWithKeys()
+	assert.Len(t, result, 1)
+	result[0].Tags[0] = "b"
+
+	assert.Equal(t, []string{"a"}, ent.content.Tags)
+}
+
+func TestFCacheAllObjectsEmpty(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result := obj.AllObjects()
+
+	assert.Equal(t, []Entry{}, result)
+}
+
+func TestFCacheContentsFutureWithContextBase(t *testing.T) {
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					"o1": {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+					"o2": pending,
+				},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	result, err := obj.ContentsFutureWithContext(ctx, "idx")
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	obj.Lock()
+	assert.Len(t, pending.reqs, 1)
+	obj.Unlock()
+	cancel()
+	for _, f := range result {
+		if f.ent == pending {
+			object, err := f.Wait()
+			assert.Same(t, ErrNotCached, err)
+			assert.Nil(t, object)
+		}
+	}
+	obj.Lock()
+	assert.Len(t, pending.reqs, 0)
+	obj.Unlock()
+}
+
+func TestFCacheContentsFutureWithContextSharedNotify(t *testing.T) {
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					"o1": pending,
+				},
+			},
+		},
+		sharedNotify: true,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	result, err := obj.ContentsFutureWithContext(ctx, "idx")
+
+	assert.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Nil(t, result[0].done)
+	cancel()
+	object, err := result[0].Wait()
+	assert.Same(t, ErrNotCached, err)
+	assert.Nil(t, object)
+}
+
+func TestFCacheContentsFutureWithContextCompleted(t *testing.T) {
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					"o1": pending,
+				},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result, err := obj.ContentsFutureWithContext(ctx, "idx")
+
+	assert.NoError(t, err)
+	require.Len(t, result, 1)
+	obj.Lock()
+	pending.complete(&Entry{
+		Object: "o1",
+	})
+	obj.Unlock()
+	object, err := result[0].Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "o1", object)
+}
+
+func TestFCacheContentsFutureWithContextBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.ContentsFutureWithContext(context.Background(), "idx")
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheRelease(t *testing.T) {
+	req := make(chan Entry, 1)
+	ent := &entry{
+		reqs: map[uint64]chan<- Entry{
+			42: req,
+		},
+	}
+	obj := &FCache{}
+
+	obj.release([]*Future{
+		{
+			ent:    ent,
+			cookie: 42,
+		},
+		{
+			ent: &entry{
+				content: &Entry{},
+			},
+		},
+	})
+
+	assert.Len(t, ent.reqs, 0)
+	_, ok := <-req
+	assert.False(t, ok)
+}
+
+func TestFCacheErrorsBase(t *testing.T) {
+	permErr := &PermanentError{assert.AnError}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+					2: {
+						content: &Entry{
+							Error: permErr,
+						},
+					},
+					3: {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Errors("idx")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]error{
+		2: permErr,
+	}, result)
+}
+
+func TestFCacheErrorsBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.Errors("idx")
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheRetryableKeysBase(t *testing.T) {
+	after := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+					2: {
+						content: &Entry{
+							Error: &PermanentError{assert.AnError},
+						},
+					},
+					3: {
+						content: &Entry{
+							Error: &RetryableError{
+								Err:   assert.AnError,
+								After: after,
+							},
+						},
+					},
+					4: {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.RetryableKeys("idx")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]time.Time{
+		3: after,
+	}, result)
+}
+
+func TestFCacheRetryableKeysBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.RetryableKeys("idx")
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheFingerprintBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"idx": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: uint64(5),
+						},
+					},
+					2: {
+						content: &Entry{
+							Object: uint64(7),
+						},
+					},
+					3: {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Fingerprint("idx", func(ent Entry) uint64 {
+		return ent.Object.(uint64) * 2
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]uint64{
+		1: 10,
+		2: 14,
+	}, result)
+}
+
+func TestFCacheFingerprintBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.Fingerprint("idx", func(ent Entry) uint64 {
+		return 0
+	})
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheReleaseOnDoneCompleted(t *testing.T) {
+	req := make(chan Entry, 1)
+	ent := &entry{
+		reqs: map[uint64]chan<- Entry{
+			42: req,
+		},
+	}
+	done := make(chan struct{})
+	close(done)
+	obj := &FCache{}
+
+	obj.releaseOnDone(context.Background(), []*Future{
+		{
+			ent:    ent,
+			cookie: 42,
+		},
+	}, []<-chan struct{}{done})
+
+	assert.Len(t, ent.reqs, 1)
+}
+
+func TestFCacheReleaseOnDoneCanceled(t *testing.T) {
+	req := make(chan Entry, 1)
+	ent := &entry{
+		reqs: map[uint64]chan<- Entry{
+			42: req,
+		},
+	}
+	done := make(chan struct{})
+	close(done)
+	obj := &FCache{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	obj.releaseOnDone(ctx, []*Future{
+		{
+			ent:    ent,
+			cookie: 42,
+		},
+	}, []<-chan struct{}{done, make(chan struct{})})
+
+	assert.Len(t, ent.reqs, 0)
+	_, ok := <-req
+	assert.False(t, ok)
+}
+
+func TestFCacheReleaseAbandoned(t *testing.T) {
+	canceled := false
+	pending := &entry{
+		reqs: map[uint64]chan<- Entry{
+			42: make(chan Entry, 1),
+		},
+		cancel: func() { canceled = true },
+		done:   make(chan struct{}),
+		auto:   &Key{"one", 1},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+		},
+	}
+
+	obj.release([]*Future{
+		{
+			ent:    pending,
+			cookie: 42,
+		},
+	})
+
+	assert.True(t, canceled)
+	assert.Len(t, obj.indexes["one"].entries, 0)
+	assert.Equal(t, &Entry{
+		Error: context.Canceled,
+		Keys:  []Key{{"one", 1}},
+	}, pending.content)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// debugSample is the maximum number of keys of each index included in
+// the output of String.
+const debugSample = 5
+
+// indexSummary is a snapshot of an index used by String.
+type indexSummary struct {
+	key    interface{}   // The index key
+	name   string        // The formatted index key
+	size   IndexSize     // The counts of the entries
+	sample []interface{} // A sample of the keys
+}
+
+// String returns a concise, multi-line summary of the cache, intended
+// for debugging.  It lists each index with the counts of its entries
+// and a sample of its keys; the full contents of the cache are not
+// included.  Only the counts and sampled keys are collected with the
+// cache locked; the summary is formatted after the lock is released.
+func (fc *FCache) String() string {
+	// Snapshot the indexes
+	fc.Lock()
+	pending := fc.pending
+	summaries := make([]indexSummary, 0, len(fc.indexes))
+	for key, idx := range fc.indexes {
+		summary := indexSummary{
+			key:  key,
+			size: idx.size(),
+		}
+		for k := range idx.entries {
+			if len(summary.sample) >= debugSample {
+				break
+			}
+			summary.sample = append(summary.sample, k)
+		}
+		summaries = append(summaries, summary)
+	}
+	fc.Unlock()
+
+	// Format the summary
+	for i := range summaries {
+		summaries[i].name = fmt.Sprintf("%#v", summaries[i].key)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].name < summaries[j].name
+	})
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "FCache: %d indexes, %d pending entries", len(summaries), pending)
+	for _, summary := range summaries {
+		keys := make([]string, len(summary.sample))
+		for i, k := range summary.sample {
+			keys[i] = fmt.Sprintf("%#v", k)
+		}
+		sort.Strings(keys)
+		total := summary.size.Completed + summary.size.Pending
+		if total > len(keys) {
+			keys = append(keys, "...")
+		}
+
+		fmt.Fprintf(buf, "\n  index %s: %d completed (%d errors), %d pending; keys: [%s]", summary.name, summary.size.Completed, summary.size.Errors, summary.size.Pending, strings.Join(keys, " "))
+	}
+
+	return buf.String()
+}
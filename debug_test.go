@@ -0,0 +1,99 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFCacheStringBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"two": {
+				entries: map[interface{}]*entry{},
+			},
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+					2: {
+						content: &Entry{
+							Error: &PermanentError{assert.AnError},
+						},
+					},
+					3: {},
+				},
+			},
+		},
+		pending: 1,
+	}
+
+	result := obj.String()
+
+	assert.Equal(t, `FCache: 2 indexes, 1 pending entries
+  index "one": 2 completed (1 errors), 1 pending; keys: [1 2 3]
+  index "two": 0 completed (0 errors), 0 pending; keys: []`, result)
+}
+
+func TestFCacheStringSample(t *testing.T) {
+	entries := map[interface{}]*entry{}
+	for i := 0; i < debugSample+3; i++ {
+		entries[i] = &entry{}
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: entries,
+			},
+		},
+	}
+
+	result := obj.String()
+
+	assert.Contains(t, result, "8 pending")
+	assert.Contains(t, result, " ...]")
+}
+
+type lockingKey struct {
+	fc *FCache
+}
+
+func (k lockingKey) GoString() string {
+	k.fc.Lock()
+	defer k.fc.Unlock()
+	return "locking"
+}
+
+func TestFCacheStringUnlocked(t *testing.T) {
+	obj := &FCache{}
+	key := lockingKey{obj}
+	obj.indexes = map[interface{}]index{
+		key: {
+			entries: map[interface{}]*entry{
+				key: {},
+			},
+		},
+	}
+
+	result := obj.String()
+
+	assert.Equal(t, `FCache: 1 indexes, 0 pending entries
+  index locking: 0 completed (0 errors), 1 pending; keys: [locking]`, result)
+}
@@ -14,7 +14,11 @@
 
 package fcache
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 // Errors that may be returned by the cache.
 var (
@@ -27,8 +31,62 @@ var (
 	ErrIncongruentKeys = errors.New("old keys are not congruent with new keys")
 	ErrEntryNotFound   = errors.New("entry not found with specified key")
 	ErrFutureCanceled  = errors.New("cannot wait on canceled future")
+	ErrFactoryNil      = errors.New("factory returned a nil entry")
+	ErrNoKeys          = errors.New("entry has no keys")
+	ErrConflictingKeys = errors.New("entry has conflicting keys for an index")
+	ErrTooManyPending  = errors.New("too many pending entries")
+	ErrMultiValue      = errors.New("entries may not be passed for a multi-value index")
+	ErrDuplicateIndex  = errors.New("duplicate index")
+	ErrCacheCleaned    = errors.New("pending entry cleaned from cache")
+	ErrNotFound        = errors.New("object does not exist")
+	ErrHandleReleased  = errors.New("entry handle has been released")
+	ErrKeyExists       = errors.New("key already present in cache")
+	ErrReservationDone = errors.New("reservation has already been completed")
+	ErrReadOnly        = errors.New("cache view is read-only")
+	ErrNoMatchingIndex = errors.New("entry keys match no cache index")
+	ErrVersionConflict = errors.New("entry version does not match expected version")
+	ErrObjectConflict  = errors.New("cached object does not match expected object")
+	ErrEmptyIndex      = errors.New("index has no completed entries")
+	ErrNoTag           = errors.New("no tag specified")
+	ErrNotCacheable    = errors.New("entry error may not be cached")
 )
 
+// DuplicateIndexError is an implementation of the error interface
+// that is returned when more than one Index with the same index key is
+// passed to New or NewWithOptions.  It wraps ErrDuplicateIndex, so
+// errors.Is may be used to test for it.
+type DuplicateIndexError struct {
+	Index interface{} // The duplicated index key
+}
+
+// Error returns the error message.
+func (d *DuplicateIndexError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrDuplicateIndex, d.Index)
+}
+
+// Unwrap returns the wrapped error.
+func (d *DuplicateIndexError) Unwrap() error {
+	return ErrDuplicateIndex
+}
+
+// UnmatchedEntriesError is an implementation of the error interface
+// that is returned by StoreMany when some of the entries have no keys
+// referring to an index of the cache.  It wraps ErrNoMatchingIndex, so
+// errors.Is may be used to test for it.
+type UnmatchedEntriesError struct {
+	Entries []int // The positions of the unmatched entries
+}
+
+// Error returns the error message.
+func (u *UnmatchedEntriesError) Error() string {
+	return fmt.Sprintf("%s: entries %v", ErrNoMatchingIndex, u.Entries)
+}
+
+// Unwrap returns the wrapped error.
+func (u *UnmatchedEntriesError) Unwrap() error {
+	return ErrNoMatchingIndex
+}
+
 // PermanentError is an implementation of the error interface that
 // wraps another error to signal that it is a permanent error.
 // Permanent errors will be cached, as opposed to other errors.
@@ -54,3 +112,46 @@ func IsPermanent(err error) bool {
 
 	return errors.As(err, &tmp)
 }
+
+// RetryableError is an implementation of the error interface that
+// wraps another error to signal that the error should be cached until
+// the specified time.  Lookups after that time will treat the entry as
+// a cache miss.
+type RetryableError struct {
+	Err   error     // The wrapped error
+	After time.Time // The time after which to retry
+}
+
+// Error returns the error message.
+func (r *RetryableError) Error() string {
+	return r.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (r *RetryableError) Unwrap() error {
+	return r.Err
+}
+
+// IsRetryable is a test to see if an error is a retryable error.  It
+// returns true if the error is wrapped by RetryableError, and false
+// otherwise.
+func IsRetryable(err error) bool {
+	var tmp *RetryableError
+
+	return errors.As(err, &tmp)
+}
+
+// isCacheable is a test to see if an entry with the specified error
+// may be cached.  Entries with no error, a permanent error, a
+// retryable error, or ErrNotFound may be cached.
+func isCacheable(err error) bool {
+	return err == nil || err == ErrNotFound || IsPermanent(err) || IsRetryable(err)
+}
+
+// isExpired is a test to see if the specified error is a retryable
+// error whose retry time has been reached.
+func isExpired(err error) bool {
+	var tmp *RetryableError
+
+	return errors.As(err, &tmp) && !now().Before(tmp.After)
+}
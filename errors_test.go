@@ -16,10 +16,60 @@ package fcache
 
 import (
 	"testing"
+	"time"
 
+	"github.com/klmitch/patcher"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestDuplicateIndexErrorImplementsError(t *testing.T) {
+	assert.Implements(t, (*error)(nil), &DuplicateIndexError{})
+}
+
+func TestDuplicateIndexErrorError(t *testing.T) {
+	obj := &DuplicateIndexError{
+		Index: "one",
+	}
+
+	result := obj.Error()
+
+	assert.Equal(t, "duplicate index: one", result)
+}
+
+func TestDuplicateIndexErrorUnwrap(t *testing.T) {
+	obj := &DuplicateIndexError{
+		Index: "one",
+	}
+
+	result := obj.Unwrap()
+
+	assert.Same(t, ErrDuplicateIndex, result)
+}
+
+func TestUnmatchedEntriesErrorImplementsError(t *testing.T) {
+	assert.Implements(t, (*error)(nil), &UnmatchedEntriesError{})
+}
+
+func TestUnmatchedEntriesErrorError(t *testing.T) {
+	obj := &UnmatchedEntriesError{
+		Entries: []int{1, 3},
+	}
+
+	result := obj.Error()
+
+	assert.Equal(t, "entry keys match no cache index: entries [1 3]", result)
+}
+
+func TestUnmatchedEntriesErrorUnwrap(t *testing.T) {
+	obj := &UnmatchedEntriesError{
+		Entries: []int{1, 3},
+	}
+
+	result := obj.Unwrap()
+
+	assert.Same(t, ErrNoMatchingIndex, result)
+}
+
 func TestPermanentErrorImplementsError(t *testing.T) {
 	assert.Implements(t, (*error)(nil), &PermanentError{})
 }
@@ -59,3 +109,58 @@ func TestIsPermanentErrorTrue(t *testing.T) {
 
 	assert.True(t, result)
 }
+
+func TestRetryableErrorError(t *testing.T) {
+	obj := &RetryableError{
+		Err: assert.AnError,
+	}
+
+	result := obj.Error()
+
+	assert.Equal(t, assert.AnError.Error(), result)
+}
+
+func TestRetryableErrorUnwrap(t *testing.T) {
+	obj := &RetryableError{
+		Err: assert.AnError,
+	}
+
+	result := obj.Unwrap()
+
+	assert.Same(t, assert.AnError, result)
+}
+
+func TestIsRetryableFalse(t *testing.T) {
+	result := IsRetryable(assert.AnError)
+
+	assert.False(t, result)
+}
+
+func TestIsRetryableTrue(t *testing.T) {
+	err := &RetryableError{
+		Err: assert.AnError,
+	}
+
+	result := IsRetryable(err)
+
+	assert.True(t, result)
+	assert.False(t, IsPermanent(err))
+}
+
+func TestIsCacheable(t *testing.T) {
+	assert.True(t, isCacheable(nil))
+	assert.True(t, isCacheable(&PermanentError{assert.AnError}))
+	assert.True(t, isCacheable(&RetryableError{Err: assert.AnError}))
+	assert.True(t, isCacheable(ErrNotFound))
+	assert.False(t, isCacheable(assert.AnError))
+}
+
+func TestIsExpired(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+
+	assert.False(t, isExpired(nil))
+	assert.False(t, isExpired(assert.AnError))
+	assert.False(t, isExpired(&RetryableError{assert.AnError, time.Unix(1001, 0)}))
+	assert.True(t, isExpired(&RetryableError{assert.AnError, time.Unix(1000, 0)}))
+	assert.True(t, isExpired(&RetryableError{assert.AnError, time.Unix(999, 0)}))
+}
@@ -14,10 +14,16 @@
 
 package fcache
 
+import (
+	"context"
+	"time"
+)
+
 // evict clears entries from the cache.  The cache MUST be locked upon
 // entry to this method.
 func (fc *FCache) evict(keys []Key) {
 	// Walk through the keys
+	var removed []*Entry
 	for _, k := range keys {
 		// Skip indexes we don't know about
 		idx, ok := fc.indexes[k.Index]
@@ -26,15 +32,68 @@ func (fc *FCache) evict(keys []Key) {
 		}
 
 		// Clear out only completed entries
-		if e, ok := idx.entries[k.Key]; ok && e.content != nil {
-			delete(idx.entries, k.Key)
+		hk := idx.hash(k.Key)
+		if e, ok := idx.entries[hk]; ok && e.content != nil {
+			delete(idx.entries, hk)
+			idx.evicted(e.content)
+			removed = append(removed, e.content)
 		}
 	}
+
+	// Forget the tags of the removed entries
+	for _, content := range removed {
+		fc.untag(content)
+	}
+}
+
+// findEvict is a helper for the eviction methods that processes the
+// options and finds the completed entry to evict.  If the entry is not
+// present in the cache or is pending, a nil entry is returned.  The
+// cache MUST be locked upon entry to this method.
+func (fc *FCache) findEvict(opts []LookupOption) (lookupOptions, index, *entry, error) {
+	// Process the options
+	o, err := procLookupOpts(opts)
+	if err != nil {
+		return o, index{}, nil, err
+	}
+
+	// Look for the index
+	idx, ok := fc.indexes[o.key.Index]
+	if !ok {
+		return o, index{}, nil, ErrBadIndex
+	}
+
+	// Check to see if there's an entry
+	ent, ok := idx.entries[idx.hash(o.key.Key)]
+	if !ok || ent.content == nil {
+		// Not present, do nothing
+		return o, idx, nil, nil
+	}
+
+	return o, idx, ent, nil
 }
 
 // Evict removes a specific entry in the cache.  The options specify
-// which entry to evict.
+// which entry to evict.  Futures already obtained for the entry are
+// not affected, and continue to return the evicted content.
 func (fc *FCache) Evict(opts ...LookupOption) error {
+	// Process the options
+	o, err := procLookupOpts(opts)
+	if err != nil {
+		return err
+	}
+
+	return fc.coalesced(opEvict, *o.key, nil, func() error {
+		_, _, err := fc.evictAndGet(opts)
+		return err
+	})
+}
+
+// ForceEvict removes a specific entry in the cache, regardless of its
+// state.  The options specify which entry to evict.  A completed entry
+// is removed from all indexes, as with Evict; a pending entry is
+// removed, and any callers waiting on it receive context.Canceled.
+func (fc *FCache) ForceEvict(opts ...LookupOption) error {
 	// Lock the cache
 	fc.Lock()
 	defer fc.Unlock()
@@ -52,14 +111,165 @@ func (fc *FCache) Evict(opts ...LookupOption) error {
 	}
 
 	// Check to see if there's an entry
-	ent, ok := idx.entries[o.key.Key]
-	if !ok || ent.content == nil {
-		// Not present, do nothing
+	hk := idx.hash(o.key.Key)
+	ent, ok := idx.entries[hk]
+	if !ok {
+		return nil
+	}
+
+	// Evict a completed entry
+	fc.stats.ExplicitEvictions++
+	if ent.content != nil {
+		fc.evict(ent.content.Keys)
+		return nil
+	}
+
+	// Cancel a pending entry
+	idx.complete(ent, &Entry{
+		Error: context.Canceled,
+		Keys:  []Key{*o.key},
+	})
+	delete(idx.entries, hk)
+
+	return nil
+}
+
+// HardEvict removes a specific entry in the cache immediately; it is
+// identical to Evict.  The options specify which entry to evict.
+func (fc *FCache) HardEvict(opts ...LookupOption) error {
+	return fc.Evict(opts...)
+}
+
+// SoftEvict marks a specific entry in the cache as stale and starts a
+// background refresh of the entry using the index factory function,
+// or the factory specified by the WithFactory option.  Unlike Evict,
+// the entry continues to be returned by lookups until the refresh
+// completes.  The options specify which entry to evict.  If the entry
+// is not present in the cache or is pending, nothing is done.  If
+// there is no factory to refresh the entry with, ErrMissingFactory is
+// returned and the entry is not marked stale.  If factory calls are
+// paused, the refresh is started by the first lookup of the entry
+// after they are resumed.
+func (fc *FCache) SoftEvict(opts ...LookupOption) error {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Find the entry
+	o, idx, ent, err := fc.findEvict(opts)
+	if err != nil || ent == nil {
+		return err
+	}
+
+	// Select the factory
+	factory := idx.refreshFactory()
+	if o.factory != nil {
+		factory = idx.override(o.factory)
+	}
+	if factory == nil {
+		return ErrMissingFactory
+	}
+
+	// Mark it stale and start the refresh, unless paused
+	ent.stale = true
+	if fc.paused {
 		return nil
 	}
+	fc.startRefresh(ent, *o.key, factory)
+
+	return nil
+}
+
+// EvictAndGet is similar to Evict, but also returns the evicted entry
+// and a boolean true value if an entry was evicted.  If the entry is
+// not present in the cache or is pending, nothing is evicted, and the
+// zero Entry and false are returned.
+func (fc *FCache) EvictAndGet(opts ...LookupOption) (Entry, bool, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	return fc.evictAndGet(opts)
+}
+
+// evictAndGet is the implementation of EvictAndGet.  The cache MUST be
+// locked upon entry to this method.
+func (fc *FCache) evictAndGet(opts []LookupOption) (Entry, bool, error) {
+	// Find the entry
+	_, _, ent, err := fc.findEvict(opts)
+	if err != nil || ent == nil {
+		return Entry{}, false, err
+	}
 
 	// Evict the entry
 	fc.evict(ent.content.Keys)
+	fc.stats.ExplicitEvictions++
+
+	return *ent.content, true, nil
+}
+
+// EvictOlderThan removes all completed entries in the specified cache
+// index that were cached more than the specified age ago.  The
+// entries are removed from all indexes.  Returns the number of
+// entries evicted.
+func (fc *FCache) EvictOlderThan(index interface{}, age time.Duration) (int, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return 0, ErrBadIndex
+	}
+
+	// Find the entries to evict
+	cutoff := now().Add(-age)
+	toEvict := map[*Entry]bool{}
+	for _, ent := range idx.entries {
+		if ent.content != nil && ent.content.CreatedAt.Before(cutoff) {
+			toEvict[ent.content] = true
+		}
+	}
+
+	// Evict the entries
+	for content := range toEvict {
+		fc.evict(content.Keys)
+	}
+	fc.stats.ExplicitEvictions += uint64(len(toEvict))
+
+	return len(toEvict), nil
+}
+
+// FlushIndex removes all completed entries, including cached errors,
+// in the specified cache index.  As with Evict, the entries are
+// removed from all indexes.  Pending entries are not affected, and
+// their factory functions are allowed to complete and populate the
+// cache normally.
+func (fc *FCache) FlushIndex(index interface{}) error {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return ErrBadIndex
+	}
+
+	// Find the entries to evict
+	toEvict := map[*Entry]bool{}
+	for _, ent := range idx.entries {
+		if ent.content != nil {
+			toEvict[ent.content] = true
+		}
+	}
+
+	// Evict the entries
+	for content := range toEvict {
+		fc.evict(content.Keys)
+	}
+	fc.stats.ExplicitEvictions += uint64(len(toEvict))
 
 	return nil
 }
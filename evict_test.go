@@ -15,8 +15,12 @@
 package fcache
 
 import (
+	"context"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/klmitch/patcher"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -132,6 +136,67 @@ func TestFCacheEvictCached(t *testing.T) {
 	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["one"].entries)
 }
 
+func TestFCacheEvictThenWait(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+							Keys:   []Key{{"one", 1}},
+						},
+					},
+				},
+			},
+		},
+	}
+	f, err := obj.LookupFuture(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+
+	err = obj.Evict(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["one"].entries)
+	result, err := f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	ent := <-f.Channel()
+	assert.Equal(t, "object", ent.Object)
+}
+
+func TestFCacheEvictOnEvict(t *testing.T) {
+	called := make(chan Entry, 1)
+	content := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}, {"two", 2}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: content,
+					},
+				},
+				onEvict: func(ent Entry) { called <- ent },
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: {
+						content: content,
+					},
+				},
+			},
+		},
+	}
+
+	err := obj.Evict(ByKey(Key{"two", 2}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, *content, <-called)
+}
+
 func TestFCacheEvictBadOption(t *testing.T) {
 	obj := &FCache{
 		indexes: map[interface{}]index{
@@ -156,3 +221,486 @@ func TestFCacheEvictBadIndex(t *testing.T) {
 
 	assert.Same(t, ErrBadIndex, err)
 }
+
+func TestFCacheForceEvictCompleted(t *testing.T) {
+	content := &Entry{
+		Keys: []Key{{"one", 1}, {"two", 2}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: content,
+					},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: {
+						content: content,
+					},
+				},
+			},
+		},
+	}
+
+	err := obj.ForceEvict(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["one"].entries)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["two"].entries)
+	assert.Equal(t, uint64(1), obj.stats.ExplicitEvictions)
+}
+
+func TestFCacheForceEvictPending(t *testing.T) {
+	canceled := false
+	pending := &entry{
+		cancel: func() { canceled = true },
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+		},
+	}
+	f := pending.makeFuture(obj)
+
+	err := obj.ForceEvict(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["one"].entries)
+	assert.True(t, canceled)
+	result, err := f.Wait()
+	assert.Same(t, context.Canceled, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheForceEvictMissing(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	err := obj.ForceEvict(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+}
+
+func TestFCacheForceEvictBadOption(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.ForceEvict()
+
+	assert.Same(t, ErrNoKey, err)
+}
+
+func TestFCacheForceEvictBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.ForceEvict(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrBadIndex, err)
+}
+
+func TestFCacheHardEvict(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Keys: []Key{{"one", 1}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := obj.HardEvict(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["one"].entries)
+}
+
+func TestFCacheSoftEvictBase(t *testing.T) {
+	release := make(chan struct{})
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				factory: func(ctx context.Context, key Key) *Entry {
+					<-release
+					return &Entry{
+						Object: "new",
+						Keys:   []Key{key},
+					}
+				},
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.SoftEvict(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	obj.Lock()
+	assert.True(t, ent.stale)
+	assert.Same(t, ent, obj.indexes["one"].entries[1])
+	f := ent.next.makeFuture(obj)
+	obj.Unlock()
+	close(release)
+	object, err := f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "new", object)
+	obj.Lock()
+	defer obj.Unlock()
+	assert.Equal(t, "new", obj.indexes["one"].entries[1].content.Object)
+}
+
+func TestFCacheSoftEvictWithFactory(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	release := make(chan struct{})
+
+	err := obj.SoftEvict(ByKey(Key{"one", 1}), WithFactory(func(ctx context.Context, key Key) *Entry {
+		<-release
+		return &Entry{
+			Object: "new",
+			Keys:   []Key{key},
+		}
+	}))
+
+	assert.NoError(t, err)
+	obj.Lock()
+	f := ent.next.makeFuture(obj)
+	obj.Unlock()
+	close(release)
+	object, err := f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "new", object)
+}
+
+func TestFCacheSoftEvictPaused(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				factory: factory,
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+		paused: true,
+	}
+
+	err := obj.SoftEvict(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.True(t, ent.stale)
+	assert.Nil(t, ent.next)
+}
+
+func TestFCacheSoftEvictMissingFactory(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.SoftEvict(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrMissingFactory, err)
+	assert.False(t, ent.stale)
+	assert.Nil(t, ent.next)
+}
+
+func TestFCacheSoftEvictPending(t *testing.T) {
+	ent := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.SoftEvict(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.False(t, ent.stale)
+	assert.Nil(t, ent.next)
+}
+
+func TestFCacheSoftEvictBadOption(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.SoftEvict()
+
+	assert.Same(t, ErrNoKey, err)
+}
+
+func TestFCacheSoftEvictBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.SoftEvict(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrBadIndex, err)
+}
+
+func TestFCacheEvictAndGetCached(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+							Keys:   []Key{{"one", 1}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, ok, err := obj.EvictAndGet(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}, result)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["one"].entries)
+}
+
+func TestFCacheEvictAndGetPending(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+		},
+	}
+
+	result, ok, err := obj.EvictAndGet(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, Entry{}, result)
+	assert.Len(t, obj.indexes["one"].entries, 1)
+}
+
+func TestFCacheEvictAndGetBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, ok, err := obj.EvictAndGet(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.False(t, ok)
+	assert.Equal(t, Entry{}, result)
+}
+
+func TestFCacheEvictOlderThanBase(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	old := &entry{
+		content: &Entry{
+			Object:    "old",
+			Keys:      []Key{{"one", 1}, {"two", 1}},
+			CreatedAt: time.Unix(100, 0),
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: old,
+					2: {
+						content: &Entry{
+							Object:    "new",
+							Keys:      []Key{{"one", 2}},
+							CreatedAt: time.Unix(950, 0),
+						},
+					},
+					3: {},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					1: old,
+				},
+			},
+		},
+	}
+
+	result, err := obj.EvictOlderThan("one", 100*time.Second)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+	assert.Len(t, obj.indexes["one"].entries, 2)
+	assert.Contains(t, obj.indexes["one"].entries, 2)
+	assert.Contains(t, obj.indexes["one"].entries, 3)
+	assert.Len(t, obj.indexes["two"].entries, 0)
+}
+
+func TestFCacheEvictOlderThanBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.EvictOlderThan("one", time.Second)
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Equal(t, 0, result)
+}
+
+func TestFCacheFlushIndexBase(t *testing.T) {
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+							Keys:   []Key{{"one", 1}, {"two", 1}},
+						},
+					},
+					2: {
+						content: &Entry{
+							Error: &PermanentError{assert.AnError},
+							Keys:  []Key{{"one", 2}},
+						},
+					},
+					3: pending,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+							Keys:   []Key{{"one", 1}, {"two", 1}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := obj.FlushIndex("one")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]*entry{
+		3: pending,
+	}, obj.indexes["one"].entries)
+	assert.Len(t, obj.indexes["two"].entries, 0)
+	assert.Nil(t, pending.content)
+	assert.Equal(t, uint64(2), obj.stats.ExplicitEvictions)
+}
+
+func TestFCacheFlushIndexBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.FlushIndex("one")
+
+	assert.Same(t, ErrBadIndex, err)
+}
+
+func TestFCacheEvictEntryCallback(t *testing.T) {
+	calls := int32(0)
+	done := make(chan struct{})
+	content := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}, {"two", 2}},
+		OnEvict: func() {
+			atomic.AddInt32(&calls, 1)
+			close(done)
+		},
+	}
+	ent := &entry{
+		content: content,
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.Evict(ByKey(Key{"one", 1}))
+	obj.Clean()
+
+	assert.NoError(t, err)
+	<-done
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
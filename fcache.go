@@ -18,6 +18,8 @@ package fcache
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // FCache describes a future cache.  A future cache is a cache that is
@@ -26,38 +28,342 @@ import (
 type FCache struct {
 	sync.Mutex
 
-	indexes map[interface{}]index // The cache indexes
+	indexes      map[interface{}]index   // The cache indexes
+	instrument   bool                    // Flag to instrument the lock
+	lockHeld     int32                   // Set while the lock is held
+	stats        Stats                   // Statistics about the cache
+	sharedNotify bool                    // Flag to share notification channels
+	strict       bool                    // Flag to reject conflicting keys
+	maker        IndexMaker              // Constructs indexes on demand
+	factories    map[interface{}]Factory // Factories shared between indexes
+	maxPending   int                     // Maximum number of pending entries
+	pending      int                     // Number of pending entries
+	paused       bool                    // Flag indicating factories are paused
+	serveStale   bool                    // Flag to keep stale content on error
+	track        bool                    // Flag to track factory calls
+	slowAfter    time.Duration           // Threshold for slow factory calls
+	onSlow       SlowFactoryFunc         // Called for slow factory calls
+	running      map[*factoryRun]bool    // Factory calls in progress
+	changed      chan struct{}           // Closed when content is added
+	onReject     RejectFunc              // Called when a limit is hit
+	coalesce     bool                    // Flag to coalesce mutations
+	callLock     sync.Mutex              // Protects calls
+	calls        map[callKey]*call       // Mutations awaiting the lock
+	version      uint64                  // Version of the latest content
+	autoCancel   bool                    // Flag to cancel abandoned factory calls
+	tags         map[string]tagSet       // Cached entries with each tag
 }
 
 // New constructs a new FCache object and returns it.  At least one
 // Index must be passed, and all indexes must define both the index
 // key and the factory function to call when the requested entry does
-// not exist in the cache.
+// not exist in the cache.  If more than one Index has the same index
+// key, a *DuplicateIndexError is returned; note that this error wraps
+// ErrDuplicateIndex, not ErrDuplicateOption as in earlier versions.
+// To configure the cache as a whole, use NewWithOptions, which accepts
+// a list of CacheOption values after the indexes.
 func New(indexes ...Index) (*FCache, error) {
+	return NewWithOptions(indexes)
+}
+
+// NewWithOptions is similar to New, but also accepts options that
+// configure the cache as a whole.  Indexes that do not define a
+// factory function may obtain one from the SharedFactory option.  If
+// the LazyIndexes option is provided, no indexes need be passed.
+func NewWithOptions(indexes []Index, opts ...CacheOption) (*FCache, error) {
+	// Process the options
+	o := procCacheOpts(opts)
+
 	// Make sure we have at least one index
-	if len(indexes) < 1 {
+	if len(indexes) < 1 && o.maker == nil {
 		return nil, ErrMissingIndex
 	}
 
 	// Construct the cache
 	fc := &FCache{
-		indexes: map[interface{}]index{},
+		indexes:      map[interface{}]index{},
+		instrument:   o.instrument,
+		sharedNotify: o.sharedNotify,
+		strict:       o.strict,
+		maker:        o.maker,
+		factories:    o.factories,
+		maxPending:   o.maxPending,
+		serveStale:   o.serveStale,
+		track:        o.track,
+		slowAfter:    o.slowAfter,
+		onSlow:       o.onSlow,
+		onReject:     o.onReject,
+		coalesce:     o.coalesce,
+		autoCancel:   o.autoCancel,
 	}
 
 	// Process all the indexes
 	for _, idx := range indexes {
 		if _, ok := fc.indexes[idx.Index]; ok {
-			return nil, ErrDuplicateOption
+			return nil, &DuplicateIndexError{
+				Index: idx.Index,
+			}
+		}
+		tmp, err := fc.newIndex(idx.Index, idx)
+		if err != nil {
+			return nil, err
+		}
+		fc.indexes[idx.Index] = tmp
+	}
+
+	return fc, nil
+}
+
+// newIndex constructs the internal index from an Index.  It returns
+// ErrMissingFactory if the Index does not have the required factory
+// function.
+func newIndex(idx Index) (index, error) {
+	if idx.Factory == nil && idx.AsyncFactory != nil {
+		idx.Factory = asyncFactory(idx.AsyncFactory)
+	}
+
+	if idx.MultiValue {
+		if idx.GroupFactory == nil {
+			return index{}, ErrMissingFactory
 		}
-		if idx.Factory == nil {
-			return nil, ErrMissingFactory
+		idx.Factory = nil
+		idx.GroupKey = nil
+	} else if idx.GroupKey != nil {
+		if idx.GroupFactory == nil {
+			return index{}, ErrMissingFactory
 		}
+	} else if idx.Factory == nil {
+		return index{}, ErrMissingFactory
+	}
+
+	result := index{
+		factory:      idx.Factory,
+		entries:      map[interface{}]*entry{},
+		groupKey:     idx.GroupKey,
+		groupFactory: idx.GroupFactory,
+		groups:       map[interface{}]*group{},
+		defObject:    idx.DefaultObject,
+		onComplete:   idx.OnComplete,
+		onEvict:      idx.OnEvict,
+		post:         idx.PostFactory,
+		hasher:       idx.KeyHasher,
+		multi:        idx.MultiValue,
+		refreshEvery: idx.RefreshInterval,
+		growth:       &IndexGrowth{},
+		write:        idx.WriteThrough,
+	}
 
-		fc.indexes[idx.Index] = index{
-			factory: idx.Factory,
-			entries: map[interface{}]*entry{},
+	// Serialize the factories if requested
+	if idx.Serialize {
+		result.serial = make(chan struct{}, 1)
+		if result.factory != nil {
+			result.factory = limitFactory(result.factory, result.serial)
+		}
+		if result.groupFactory != nil {
+			result.groupFactory = limitGroupFactory(result.groupFactory, result.serial)
 		}
 	}
 
-	return fc, nil
+	// Process the factory results
+	result.factory = postFactory(result.factory, result.post)
+	result.groupFactory = postGroupFactory(result.groupFactory, result.post)
+	result.factory = writeFactory(result.factory, result.write)
+	result.groupFactory = writeGroupFactory(result.groupFactory, result.write)
+
+	// Combine the sets for a multi-value index
+	if result.multi {
+		result.factory = multiFactory(result.groupFactory)
+	}
+
+	return result, nil
+}
+
+// newIndex constructs the internal index for the specified index key.
+// Indexes that do not define a factory function use the one specified
+// for the index by the SharedFactory option, if any.
+func (fc *FCache) newIndex(key interface{}, idx Index) (index, error) {
+	if idx.Factory == nil && idx.AsyncFactory == nil {
+		idx.Factory = fc.factories[key]
+	}
+
+	return newIndex(idx)
+}
+
+// findIndex looks up the specified index.  If the index does not
+// exist and the cache was constructed with the LazyIndexes option,
+// the IndexMaker is called to construct the index, which is then
+// added to the cache.  Returns ErrBadIndex if the index does not
+// exist and could not be constructed.  The cache MUST be locked upon
+// entry to this method.
+func (fc *FCache) findIndex(key interface{}) (index, error) {
+	// Look for an existing index
+	if idx, ok := fc.indexes[key]; ok {
+		return idx, nil
+	}
+
+	// Construct the index
+	if fc.maker == nil {
+		return index{}, ErrBadIndex
+	}
+	tmp, ok := fc.maker(key)
+	if !ok {
+		return index{}, ErrBadIndex
+	}
+	idx, err := fc.newIndex(key, tmp)
+	if err != nil {
+		return index{}, err
+	}
+	fc.indexes[key] = idx
+
+	return idx, nil
+}
+
+// addPending checks that another pending entry may be added to the
+// cache, returning ErrTooManyPending if the MaxPending limit has been
+// reached, after calling the OnReject callback, if any, with the key.
+// Otherwise, the entry is counted as pending until it is completed.
+// The cache MUST be locked upon entry to this method.
+func (fc *FCache) addPending(e *entry, key Key) error {
+	if fc.maxPending > 0 && fc.pending >= fc.maxPending {
+		fc.reject(RejectMaxPending, key)
+		return ErrTooManyPending
+	}
+
+	fc.pending++
+	e.counter = &fc.pending
+
+	return nil
+}
+
+// signal wakes up any callers waiting for content to be added to the
+// cache.  It must be called whenever completed content is added to an
+// index.  The cache MUST be locked upon entry to this method.
+func (fc *FCache) signal() {
+	if fc.changed != nil {
+		close(fc.changed)
+		fc.changed = nil
+	}
+}
+
+// nextVersion returns the version to assign to new or changed content.
+// Versions are unique across the cache, so content that is evicted and
+// cached again never reuses a version.  The cache MUST be locked upon
+// entry to this method.
+func (fc *FCache) nextVersion() uint64 {
+	fc.version++
+	return fc.version
+}
+
+// checkVersion checks the expected version passed with the IfVersion
+// option, if any, against the specified entry, returning
+// ErrVersionConflict if they do not match.  An entry that is absent
+// or pending has version 0.  The cache MUST be locked upon entry to
+// this method.
+func checkVersion(o lookupOptions, ent *entry) error {
+	if o.version == nil {
+		return nil
+	}
+
+	var version uint64
+	if ent != nil && ent.content != nil {
+		version = ent.content.Version
+	}
+	if version != *o.version {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// checkObject checks the expected object passed with the IfObject
+// option, if any, against the specified entry, returning
+// ErrObjectConflict if they are not equal.  An entry that is absent or
+// pending has a nil object.  The cache MUST be locked upon entry to
+// this method.
+func checkObject(o lookupOptions, ent *entry) error {
+	if o.expect == nil {
+		return nil
+	}
+
+	var object interface{}
+	if ent != nil && ent.content != nil {
+		object = ent.content.Object
+	}
+	if !o.expect.equal(object, o.expect.object) {
+		return ErrObjectConflict
+	}
+
+	return nil
+}
+
+// checkExpected checks the expected version and object of the
+// specified entry.  The cache MUST be locked upon entry to this
+// method.
+func checkExpected(o lookupOptions, ent *entry) error {
+	if err := checkVersion(o, ent); err != nil {
+		return err
+	}
+
+	return checkObject(o, ent)
+}
+
+// reject calls the OnReject callback, if any, in a separate
+// goroutine.  The cache MUST be locked upon entry to this method.
+func (fc *FCache) reject(reason string, key Key) {
+	if fc.onReject != nil {
+		go fc.onReject(reason, key)
+	}
+}
+
+// Lock locks the cache.  If the cache was constructed with the
+// InstrumentLock option, the time spent waiting for the lock is
+// recorded in the cache statistics.
+func (fc *FCache) Lock() {
+	// Simply lock if we're not instrumenting the lock
+	if !fc.instrument {
+		fc.Mutex.Lock()
+		return
+	}
+
+	// Time the acquisition of the lock
+	start := now()
+	contended := atomic.LoadInt32(&fc.lockHeld) != 0
+	fc.Mutex.Lock()
+	atomic.StoreInt32(&fc.lockHeld, 1)
+
+	// Update the statistics
+	fc.stats.LockAcquisitions++
+	if contended {
+		fc.stats.LockContentions++
+	}
+	fc.stats.LockWait += now().Sub(start)
+}
+
+// Unlock unlocks the cache.
+func (fc *FCache) Unlock() {
+	if fc.instrument {
+		atomic.StoreInt32(&fc.lockHeld, 0)
+	}
+	fc.Mutex.Unlock()
+}
+
+// Pause pauses calls to the factory functions.  While paused, lookups
+// of keys not present in the cache behave as if the SearchCache
+// option had been passed, and stale entries are not refreshed.
+// Lookups of completed entries are not affected, and factory calls
+// already in progress are allowed to complete.
+func (fc *FCache) Pause() {
+	fc.Lock()
+	defer fc.Unlock()
+
+	fc.paused = true
+}
+
+// Resume resumes calls to the factory functions after a call to
+// Pause.
+func (fc *FCache) Resume() {
+	fc.Lock()
+	defer fc.Unlock()
+
+	fc.paused = false
 }
@@ -16,7 +16,14 @@ package fcache
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -28,8 +35,8 @@ func factory(ctx context.Context, key Key) *Entry {
 
 func TestNewBase(t *testing.T) {
 	result, err := New(
-		Index{"one", factory},
-		Index{"two", factory},
+		Index{Index: "one", Factory: factory},
+		Index{Index: "two", Factory: factory},
 	)
 
 	assert.NoError(t, err)
@@ -38,11 +45,12 @@ func TestNewBase(t *testing.T) {
 	assert.NotNil(t, result.indexes["one"].factory)
 	assert.Contains(t, result.indexes, "two")
 	assert.NotNil(t, result.indexes["two"].factory)
+	assert.NotSame(t, result.indexes["one"].growth, result.indexes["two"].growth)
 }
 
 func TestNewOneIndex(t *testing.T) {
 	result, err := New(
-		Index{"one", factory},
+		Index{Index: "one", Factory: factory},
 	)
 
 	assert.NoError(t, err)
@@ -58,22 +66,788 @@ func TestNewMissingIndex(t *testing.T) {
 	assert.Nil(t, result)
 }
 
-func TestNewDuplicateOption(t *testing.T) {
+func TestNewDuplicateIndex(t *testing.T) {
 	result, err := New(
-		Index{"one", factory},
-		Index{"one", factory},
+		Index{Index: "one", Factory: factory},
+		Index{Index: "one", Factory: factory},
 	)
 
-	assert.Same(t, ErrDuplicateOption, err)
+	assert.Equal(t, &DuplicateIndexError{
+		Index: "one",
+	}, err)
+	assert.True(t, errors.Is(err, ErrDuplicateIndex))
 	assert.Nil(t, result)
 }
 
 func TestNewMissingFactory(t *testing.T) {
 	result, err := New(
-		Index{"one", factory},
-		Index{"two", nil},
+		Index{Index: "one", Factory: factory},
+		Index{Index: "two", Factory: nil},
 	)
 
 	assert.Same(t, ErrMissingFactory, err)
 	assert.Nil(t, result)
 }
+
+func TestNewGroup(t *testing.T) {
+	groupFactory := func(ctx context.Context, key Key) []*Entry {
+		return nil
+	}
+	result, err := New(
+		Index{
+			Index:        "one",
+			GroupKey:     func(key Key) interface{} { return key.Key },
+			GroupFactory: groupFactory,
+		},
+	)
+
+	assert.NoError(t, err)
+	require.Contains(t, result.indexes, "one")
+	assert.Nil(t, result.indexes["one"].factory)
+	assert.NotNil(t, result.indexes["one"].groupKey)
+	assert.NotNil(t, result.indexes["one"].groupFactory)
+	assert.NotNil(t, result.indexes["one"].groups)
+}
+
+func TestNewMissingGroupFactory(t *testing.T) {
+	result, err := New(
+		Index{
+			Index:    "one",
+			Factory:  factory,
+			GroupKey: func(key Key) interface{} { return key.Key },
+		},
+	)
+
+	assert.Same(t, ErrMissingFactory, err)
+	assert.Nil(t, result)
+}
+
+func TestNewDefaultObject(t *testing.T) {
+	result, err := New(
+		Index{Index: "one", Factory: factory, DefaultObject: "default"},
+	)
+
+	assert.NoError(t, err)
+	require.Contains(t, result.indexes, "one")
+	assert.Equal(t, "default", result.indexes["one"].defObject)
+}
+
+func TestNewCallbacks(t *testing.T) {
+	result, err := New(
+		Index{
+			Index:      "one",
+			Factory:    factory,
+			OnComplete: func(ent Entry) {},
+			OnEvict:    func(ent Entry) {},
+		},
+	)
+
+	assert.NoError(t, err)
+	require.Contains(t, result.indexes, "one")
+	assert.NotNil(t, result.indexes["one"].onComplete)
+	assert.NotNil(t, result.indexes["one"].onEvict)
+}
+
+func TestNewWriteThrough(t *testing.T) {
+	written := []Entry{}
+	result, err := New(
+		Index{
+			Index: "one",
+			Factory: func(ctx context.Context, key Key) *Entry {
+				return &Entry{
+					Object: "object",
+					Keys:   []Key{key},
+				}
+			},
+			WriteThrough: func(ctx context.Context, ent Entry) error {
+				written = append(written, ent)
+				return nil
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	obj, err := result.Lookup(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", obj)
+	assert.Equal(t, []Entry{
+		{
+			Object: "object",
+			Keys:   []Key{{"one", 1}},
+		},
+	}, written)
+}
+
+func TestNewSerialize(t *testing.T) {
+	running := int32(0)
+	maxRunning := int32(0)
+	var mu sync.Mutex
+	serialFactory := func(ctx context.Context, key Key) *Entry {
+		n := atomic.AddInt32(&running, 1)
+		mu.Lock()
+		if n > maxRunning {
+			maxRunning = n
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return &Entry{
+			Object: key.Key,
+			Keys:   []Key{key},
+		}
+	}
+	obj, err := New(
+		Index{Index: "one", Factory: serialFactory, Serialize: true},
+	)
+	require.NoError(t, err)
+	require.NotNil(t, obj.indexes["one"].serial)
+
+	futures := []*Future{}
+	for i := 0; i < 5; i++ {
+		f, err := obj.LookupFuture(ByKey(Key{"one", i}))
+		require.NoError(t, err)
+		futures = append(futures, f)
+	}
+	for i, f := range futures {
+		result, err := f.Wait()
+		assert.NoError(t, err)
+		assert.Equal(t, i, result)
+	}
+
+	assert.Equal(t, int32(1), maxRunning)
+}
+
+func TestNewPostFactory(t *testing.T) {
+	obj, err := New(
+		Index{
+			Index: "one",
+			Factory: func(ctx context.Context, key Key) *Entry {
+				return &Entry{
+					Object: "secret",
+					Keys:   []Key{key},
+				}
+			},
+			PostFactory: func(key Key, ent *Entry) (*Entry, error) {
+				ent.Object = "redacted"
+				return ent, nil
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "redacted", result)
+	result, err = obj.Lookup(ByKey(Key{"one", 2}), WithFactory(func(ctx context.Context, key Key) *Entry {
+		return &Entry{
+			Object: "override",
+			Keys:   []Key{key},
+		}
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "redacted", result)
+}
+
+func TestNewKeyHasher(t *testing.T) {
+	calls := 0
+	obj, err := New(
+		Index{
+			Index: "one",
+			Factory: func(ctx context.Context, key Key) *Entry {
+				calls++
+				return &Entry{
+					Object: fmt.Sprint(key.Key),
+					Keys:   []Key{key},
+				}
+			},
+			KeyHasher: func(key interface{}) interface{} {
+				return fmt.Sprint(key)
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	result, err := obj.Lookup(ByKey(Key{"one", []int{1, 2}}))
+	assert.NoError(t, err)
+	assert.Equal(t, "[1 2]", result)
+	ent, err := obj.Inspect(ByKey(Key{"one", []int{1, 2}}))
+	assert.NoError(t, err)
+	assert.Equal(t, "[1 2]", ent.Object)
+	assert.Len(t, obj.Verify(), 0)
+	err = obj.Reindex([]Key{{"one", []int{3}}}, ByKey(Key{"one", []int{1, 2}}))
+	assert.NoError(t, err)
+	_, err = obj.Inspect(ByKey(Key{"one", []int{1, 2}}))
+	assert.Same(t, ErrNotCached, err)
+	result, err = obj.Lookup(ByKey(Key{"one", []int{3}}))
+	assert.NoError(t, err)
+	assert.Equal(t, "[1 2]", result)
+	err = obj.Evict(ByKey(Key{"one", []int{3}}))
+	assert.NoError(t, err)
+	assert.Len(t, obj.indexes["one"].entries, 0)
+	assert.Equal(t, 1, calls)
+}
+
+func TestNewNotFound(t *testing.T) {
+	calls := 0
+	obj, err := New(
+		Index{
+			Index: "one",
+			Factory: func(ctx context.Context, key Key) *Entry {
+				calls++
+				return &Entry{
+					Keys:     []Key{key},
+					NotFound: true,
+				}
+			},
+		},
+	)
+	require.NoError(t, err)
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.Same(t, ErrNotFound, err)
+	assert.Nil(t, result)
+	result, err = obj.Lookup(ByKey(Key{"one", 1}))
+	assert.Same(t, ErrNotFound, err)
+	assert.Nil(t, result)
+	assert.Equal(t, 1, calls)
+}
+
+func TestNewMultiValue(t *testing.T) {
+	calls := 0
+	obj, err := New(
+		Index{
+			Index:   "id",
+			Factory: factory,
+		},
+		Index{
+			Index: "tag",
+			GroupFactory: func(ctx context.Context, key Key) []*Entry {
+				calls++
+				return []*Entry{
+					{Object: "a", Keys: []Key{{"id", 1}, key}},
+					{Object: "b", Keys: []Key{{"id", 2}, key}},
+				}
+			},
+			MultiValue: true,
+		},
+	)
+	require.NoError(t, err)
+
+	result, err := obj.Lookup(ByKey(Key{"tag", "red"}))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b"}, result)
+	result, err = obj.Lookup(ByKey(Key{"tag", "red"}))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b"}, result)
+	assert.Len(t, obj.indexes["id"].entries, 0)
+	_, err = obj.Lookup(ByEntry(Entry{Object: "c", Keys: []Key{{"tag", "red"}}}))
+	assert.Same(t, ErrMultiValue, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestNewMultiValueMissingFactory(t *testing.T) {
+	result, err := New(
+		Index{
+			Index:      "one",
+			Factory:    factory,
+			MultiValue: true,
+		},
+	)
+
+	assert.Same(t, ErrMissingFactory, err)
+	assert.Nil(t, result)
+}
+
+func TestNewWithOptions(t *testing.T) {
+	result, err := NewWithOptions(
+		[]Index{{Index: "one", Factory: factory}},
+		InstrumentLock,
+	)
+
+	assert.NoError(t, err)
+	assert.Len(t, result.indexes, 1)
+	assert.True(t, result.instrument)
+}
+
+func TestNewWithOptionsStrictKeys(t *testing.T) {
+	result, err := NewWithOptions(
+		[]Index{{Index: "one", Factory: factory}},
+		StrictKeys,
+	)
+
+	assert.NoError(t, err)
+	assert.True(t, result.strict)
+}
+
+func TestNewWithOptionsSharedFactory(t *testing.T) {
+	called := []Key{}
+	shared := func(ctx context.Context, key Key) *Entry {
+		called = append(called, key)
+		return nil
+	}
+
+	result, err := NewWithOptions(
+		[]Index{
+			{Index: "one"},
+			{Index: "two"},
+			{Index: "three", Factory: factory},
+		},
+		SharedFactory(shared, "one", "two", "three"),
+	)
+
+	assert.NoError(t, err)
+	require.Len(t, result.indexes, 3)
+	result.indexes["one"].factory(context.Background(), Key{"one", 1})
+	result.indexes["two"].factory(context.Background(), Key{"two", 2})
+	result.indexes["three"].factory(context.Background(), Key{"three", 3})
+	assert.Equal(t, []Key{{"one", 1}, {"two", 2}}, called)
+}
+
+func TestNewAsyncFactory(t *testing.T) {
+	async := func(ctx context.Context, key Key) <-chan *Entry {
+		ch := make(chan *Entry, 1)
+		ch <- &Entry{
+			Object: "async",
+			Keys:   []Key{key},
+		}
+		return ch
+	}
+
+	result, err := NewWithOptions(
+		[]Index{
+			{Index: "one", AsyncFactory: async},
+			{Index: "two", Factory: factory, AsyncFactory: async},
+		},
+		SharedFactory(factory, "one"),
+	)
+
+	assert.NoError(t, err)
+	require.Len(t, result.indexes, 2)
+	assert.Equal(t, &Entry{
+		Object: "async",
+		Keys:   []Key{{"one", 1}},
+	}, result.indexes["one"].factory(context.Background(), Key{"one", 1}))
+	assert.Nil(t, result.indexes["two"].factory(context.Background(), Key{"two", 2}))
+}
+
+func TestNewWithOptionsSharedFactoryMissing(t *testing.T) {
+	result, err := NewWithOptions(
+		[]Index{
+			{Index: "one"},
+			{Index: "two"},
+		},
+		SharedFactory(factory, "one"),
+	)
+
+	assert.Same(t, ErrMissingFactory, err)
+	assert.Nil(t, result)
+}
+
+func TestNewWithOptionsLazyIndexes(t *testing.T) {
+	result, err := NewWithOptions(nil, LazyIndexes(func(index interface{}) (Index, bool) {
+		return Index{Factory: factory}, true
+	}))
+
+	assert.NoError(t, err)
+	assert.Len(t, result.indexes, 0)
+	assert.NotNil(t, result.maker)
+}
+
+func TestFCacheFindIndexExisting(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result, err := obj.findIndex("one")
+
+	assert.NoError(t, err)
+	assert.Equal(t, obj.indexes["one"], result)
+}
+
+func TestFCacheFindIndexMissing(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	_, err := obj.findIndex("one")
+
+	assert.Same(t, ErrBadIndex, err)
+}
+
+func TestFCacheFindIndexLazy(t *testing.T) {
+	calls := []interface{}{}
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+		maker: func(index interface{}) (Index, bool) {
+			calls = append(calls, index)
+			return Index{Factory: factory, DefaultObject: "default"}, true
+		},
+	}
+
+	result, err := obj.findIndex("one")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "default", result.defObject)
+	assert.NotNil(t, result.factory)
+	require.Contains(t, obj.indexes, "one")
+	_, err = obj.findIndex("one")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"one"}, calls)
+}
+
+func TestFCacheFindIndexLazyUnknown(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+		maker: func(index interface{}) (Index, bool) {
+			return Index{}, false
+		},
+	}
+
+	_, err := obj.findIndex("one")
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Len(t, obj.indexes, 0)
+}
+
+func TestFCacheFindIndexLazyMissingFactory(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+		maker: func(index interface{}) (Index, bool) {
+			return Index{}, true
+		},
+	}
+
+	_, err := obj.findIndex("one")
+
+	assert.Same(t, ErrMissingFactory, err)
+	assert.Len(t, obj.indexes, 0)
+}
+
+func TestFCacheFindIndexLazySharedFactory(t *testing.T) {
+	called := []Key{}
+	shared := func(ctx context.Context, key Key) *Entry {
+		called = append(called, key)
+		return nil
+	}
+	obj, err := NewWithOptions(nil, LazyIndexes(func(index interface{}) (Index, bool) {
+		return Index{}, true
+	}), SharedFactory(shared, "one"))
+	require.NoError(t, err)
+
+	result, err := obj.findIndex("one")
+
+	assert.NoError(t, err)
+	require.NotNil(t, result.factory)
+	result.factory(context.Background(), Key{"one", 1})
+	assert.Equal(t, []Key{{"one", 1}}, called)
+}
+
+func TestFCacheLookupAnyLazyIndex(t *testing.T) {
+	obj, err := NewWithOptions(nil, LazyIndexes(func(index interface{}) (Index, bool) {
+		return Index{
+			Factory: func(ctx context.Context, key Key) *Entry {
+				return &Entry{
+					Object: fmt.Sprintf("%v/%v", index, key.Key),
+					Keys:   []Key{key},
+				}
+			},
+		}, true
+	}))
+	require.NoError(t, err)
+
+	result, err := obj.LookupAny(Key{"one", 1}, Key{"two", 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "one/1", result)
+}
+
+func TestFCacheWaitForLazyIndex(t *testing.T) {
+	obj, err := NewWithOptions(nil, LazyIndexes(func(index interface{}) (Index, bool) {
+		return Index{Factory: factory}, true
+	}))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = obj.WaitFor(ctx, Key{"one", 1})
+
+	assert.Same(t, context.Canceled, err)
+	assert.Contains(t, obj.indexes, "one")
+}
+
+func TestFCacheLookupLazyIndex(t *testing.T) {
+	obj, err := NewWithOptions(nil, LazyIndexes(func(index interface{}) (Index, bool) {
+		return Index{
+			Factory: func(ctx context.Context, key Key) *Entry {
+				return &Entry{
+					Object: fmt.Sprintf("%v/%v", index, key.Key),
+					Keys:   []Key{key},
+				}
+			},
+		}, true
+	}))
+	require.NoError(t, err)
+
+	result, err := obj.Lookup(ByKey(Key{"tenant", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant/1", result)
+}
+
+func TestFCacheAddPendingBase(t *testing.T) {
+	obj := &FCache{
+		maxPending: 2,
+		pending:    1,
+	}
+	ent := &entry{}
+
+	err := obj.addPending(ent, Key{"one", 1})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, obj.pending)
+	assert.Same(t, &obj.pending, ent.counter)
+}
+
+func TestFCacheAddPendingUnlimited(t *testing.T) {
+	obj := &FCache{
+		pending: 5,
+	}
+	ent := &entry{}
+
+	err := obj.addPending(ent, Key{"one", 1})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 6, obj.pending)
+}
+
+func TestFCacheAddPendingTooMany(t *testing.T) {
+	obj := &FCache{
+		maxPending: 2,
+		pending:    2,
+	}
+	ent := &entry{}
+
+	err := obj.addPending(ent, Key{"one", 1})
+
+	assert.Same(t, ErrTooManyPending, err)
+	assert.Equal(t, 2, obj.pending)
+	assert.Nil(t, ent.counter)
+}
+
+func TestFCacheAddPendingTooManyOnReject(t *testing.T) {
+	type rejection struct {
+		reason string
+		key    Key
+	}
+	rejected := make(chan rejection, 1)
+	obj := &FCache{
+		maxPending: 2,
+		pending:    2,
+		onReject: func(reason string, key Key) {
+			rejected <- rejection{reason, key}
+		},
+	}
+	ent := &entry{}
+
+	err := obj.addPending(ent, Key{"one", 1})
+
+	assert.Same(t, ErrTooManyPending, err)
+	assert.Equal(t, rejection{RejectMaxPending, Key{"one", 1}}, <-rejected)
+}
+
+func TestFCacheNextVersion(t *testing.T) {
+	obj := &FCache{
+		version: 5,
+	}
+
+	result := obj.nextVersion()
+
+	assert.Equal(t, uint64(6), result)
+	assert.Equal(t, uint64(6), obj.version)
+}
+
+func TestCheckVersionUnset(t *testing.T) {
+	err := checkVersion(lookupOptions{}, nil)
+
+	assert.NoError(t, err)
+}
+
+func TestCheckVersionMissing(t *testing.T) {
+	version := uint64(0)
+
+	err := checkVersion(lookupOptions{version: &version}, &entry{})
+
+	assert.NoError(t, err)
+}
+
+func TestCheckVersionMatch(t *testing.T) {
+	version := uint64(3)
+
+	err := checkVersion(lookupOptions{version: &version}, &entry{
+		content: &Entry{
+			Version: 3,
+		},
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestCheckVersionConflict(t *testing.T) {
+	version := uint64(2)
+
+	err := checkVersion(lookupOptions{version: &version}, &entry{
+		content: &Entry{
+			Version: 3,
+		},
+	})
+
+	assert.Same(t, ErrVersionConflict, err)
+}
+
+func TestCheckObjectUnset(t *testing.T) {
+	err := checkObject(lookupOptions{}, nil)
+
+	assert.NoError(t, err)
+}
+
+func TestCheckObjectMissing(t *testing.T) {
+	err := checkObject(lookupOptions{
+		expect: &expectation{
+			object: "object",
+			equal:  reflect.DeepEqual,
+		},
+	}, &entry{})
+
+	assert.Same(t, ErrObjectConflict, err)
+}
+
+func TestCheckObjectMatch(t *testing.T) {
+	err := checkObject(lookupOptions{
+		expect: &expectation{
+			object: []string{"object"},
+			equal:  reflect.DeepEqual,
+		},
+	}, &entry{
+		content: &Entry{
+			Object: []string{"object"},
+		},
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestCheckObjectCustomEqual(t *testing.T) {
+	var calls [][2]interface{}
+	err := checkObject(lookupOptions{
+		expect: &expectation{
+			object: "OBJECT",
+			equal: func(a, b interface{}) bool {
+				calls = append(calls, [2]interface{}{a, b})
+				return strings.EqualFold(a.(string), b.(string))
+			},
+		},
+	}, &entry{
+		content: &Entry{
+			Object: "object",
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]interface{}{{"object", "OBJECT"}}, calls)
+}
+
+func TestCheckObjectConflict(t *testing.T) {
+	err := checkObject(lookupOptions{
+		expect: &expectation{
+			object: "other",
+			equal:  reflect.DeepEqual,
+		},
+	}, &entry{
+		content: &Entry{
+			Object: "object",
+		},
+	})
+
+	assert.Same(t, ErrObjectConflict, err)
+}
+
+func TestCheckExpectedVersionConflict(t *testing.T) {
+	version := uint64(2)
+
+	err := checkExpected(lookupOptions{
+		version: &version,
+		expect: &expectation{
+			object: "object",
+			equal:  reflect.DeepEqual,
+		},
+	}, &entry{
+		content: &Entry{
+			Object:  "object",
+			Version: 3,
+		},
+	})
+
+	assert.Same(t, ErrVersionConflict, err)
+}
+
+func TestCheckExpectedObjectConflict(t *testing.T) {
+	version := uint64(3)
+
+	err := checkExpected(lookupOptions{
+		version: &version,
+		expect: &expectation{
+			object: "other",
+			equal:  reflect.DeepEqual,
+		},
+	}, &entry{
+		content: &Entry{
+			Object:  "object",
+			Version: 3,
+		},
+	})
+
+	assert.Same(t, ErrObjectConflict, err)
+}
+
+func TestFCacheLockBase(t *testing.T) {
+	obj := &FCache{}
+
+	obj.Lock()
+	obj.Unlock()
+
+	assert.Equal(t, Stats{}, obj.stats)
+}
+
+func TestFCacheLockInstrumented(t *testing.T) {
+	obj := &FCache{
+		instrument: true,
+	}
+
+	obj.Lock()
+	assert.Equal(t, int32(1), obj.lockHeld)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		obj.Unlock()
+	}()
+	obj.Lock()
+	obj.Unlock()
+
+	assert.Equal(t, int32(0), obj.lockHeld)
+	assert.Equal(t, uint64(2), obj.stats.LockAcquisitions)
+	assert.Equal(t, uint64(1), obj.stats.LockContentions)
+	assert.True(t, obj.stats.LockWait > 0)
+}
+
+func TestFCachePauseResume(t *testing.T) {
+	obj := &FCache{}
+
+	obj.Pause()
+	assert.True(t, obj.paused)
+	obj.Resume()
+	assert.False(t, obj.paused)
+}
@@ -25,24 +25,43 @@ import "context"
 // callers are strongly encouraged to call one or the other, but not
 // both.
 type Future struct {
-	fc       *FCache      // The cache the future is from
-	ent      *entry       // The actual entry in the cache
-	result   <-chan Entry // Channel to receive the result
-	cookie   uint64       // A unique identifier for this future
-	canceled bool         // A flag indicating cancelation
+	fc       *FCache       // The cache the future is from
+	ent      *entry        // The actual entry in the cache
+	result   <-chan Entry  // Channel to receive the result
+	cookie   uint64        // A unique identifier for this future
+	canceled bool          // A flag indicating cancelation
+	src      *Future       // The future being mapped, if any
+	mapper   Mapper        // Function to transform the object
+	done     chan struct{} // Shared channel closed on completion
+	stop     chan struct{} // Closed when the future is canceled
 }
 
-// wait is the internal implementation of waiting on the future.
-func (f *Future) wait(ctx context.Context) Entry {
+// Mapper describes a function that may be used to transform the
+// object returned by a Future.  See Future.Map.
+type Mapper func(obj interface{}) (interface{}, error)
+
+// wait is the internal implementation of waiting on the future.  A
+// result that is already available is returned even if the context
+// is done.  The boolean return value is false if the result channel
+// was closed without a result being sent.
+func (f *Future) wait(ctx context.Context) (Entry, bool) {
+	// Prefer a result that's already available
+	select {
+	case result, ok := <-f.result:
+		return result, ok
+
+	default:
+	}
+
 	// Allow canceling from the context
 	select {
-	case result := <-f.result:
-		return result
+	case result, ok := <-f.result:
+		return result, ok
 
 	case <-ctx.Done():
 		return Entry{
 			Error: ctx.Err(),
-		}
+		}, true
 	}
 }
 
@@ -57,10 +76,39 @@ func (f *Future) WaitWithContext(ctx context.Context) (interface{}, error) {
 		return nil, ErrFutureCanceled
 	}
 
+	// If this is a mapped future, wait on the source and map it
+	if f.src != nil {
+		obj, err := f.src.WaitWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return f.mapper(obj)
+	}
+
+	// If we have a shared notification channel, wait on it
+	if f.done != nil {
+		select {
+		case <-f.done:
+			f.done = nil
+
+		default:
+			select {
+			case <-f.done:
+				f.done = nil
+
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
 	// If we have a result channel, simply wait on it
 	if f.result != nil {
-		// If the result is empty, the channel has been closed
-		if ent := f.wait(ctx); ent.Object != nil || ent.Error != nil {
+		// If the channel was closed without a result, fall
+		// back to the entry; a cached nil object is returned
+		// like any other
+		if ent, ok := f.wait(ctx); ok {
 			f.result = nil
 			return ent.Object, ent.Error
 		}
@@ -89,23 +137,92 @@ func (f *Future) Wait() (interface{}, error) {
 // Note that calling this method does not cancel any pending factory
 // function calls.
 func (f *Future) Cancel() {
+	// Cancel the source of a mapped future, stopping any channel
+	// returned by Channel
+	if f.src != nil {
+		f.src.Cancel()
+		if !f.canceled && f.stop != nil {
+			close(f.stop)
+		}
+		f.canceled = true
+		return
+	}
+
 	if !f.canceled {
 		f.fc.Lock()
 		defer f.fc.Unlock()
 		delete(f.ent.reqs, f.cookie)
+		f.fc.abandon(f.ent)
+		if f.stop != nil {
+			close(f.stop)
+		}
 		f.result = nil
+		f.done = nil
 		f.canceled = true
 	}
 }
 
+// abandon cancels a pending entry created with the AutoCancel option
+// once no callers are waiting on it.  The factory call is canceled,
+// and the entry removed from the cache.  The cache MUST be locked upon
+// entry to this method.
+func (fc *FCache) abandon(e *entry) {
+	// Make sure nobody is waiting on the entry
+	if e.auto == nil || e.content != nil || len(e.reqs) > 0 || e.shared || len(e.onDone) > 0 {
+		return
+	}
+
+	// Remove the entry from the index
+	if idx, ok := fc.indexes[e.auto.Index]; ok {
+		hk := idx.hash(e.auto.Key)
+		if idx.entries[hk] == e {
+			delete(idx.entries, hk)
+		}
+		idx.complete(e, &Entry{
+			Error: context.Canceled,
+			Keys:  []Key{*e.auto},
+		})
+	}
+}
+
 // Channel returns a channel that the caller may receive from to
-// receive the result.
+// receive the result.  For a mapped future, or a future sharing a
+// notification channel, the channel is closed without a result if the
+// future is canceled before the result is available.
 func (f *Future) Channel() <-chan Entry {
 	// If the future was canceled, return nil
 	if f.canceled {
 		return nil
 	}
 
+	// For futures sharing a notification channel, read the
+	// contents in the background; the channel is closed without a
+	// result if the future is canceled first
+	if f.done != nil {
+		if f.stop == nil {
+			f.stop = make(chan struct{})
+		}
+		result := make(chan Entry, 1)
+		go f.sharedChannel(f.done, f.stop, result)
+		return result
+	}
+
+	// For mapped futures, receive from the source and map in the
+	// background; the channel is closed without a result if the
+	// future is canceled first
+	if f.src != nil {
+		src := f.src.Channel()
+		if src == nil {
+			return nil
+		}
+		if f.stop == nil {
+			f.stop = make(chan struct{})
+		}
+		result := make(chan Entry, 1)
+		go f.mapChannel(src, f.stop, result)
+		return result
+	}
+
 	// If the result channel exists, return it
 	if f.result != nil {
 		return f.result
@@ -126,3 +243,139 @@ func (f *Future) Channel() <-chan Entry {
 	close(result)
 	return result
 }
+
+// sharedChannel waits for the shared notification channel to be
+// closed, then sends the entry contents on the result channel, which
+// is then closed.  If the stop channel is closed first, the result
+// channel is closed without sending anything.  It MUST be called as a
+// goroutine.
+func (f *Future) sharedChannel(done, stop <-chan struct{}, result chan<- Entry) {
+	defer close(result)
+
+	// Wait for the entry to be completed
+	select {
+	case <-done:
+	case <-stop:
+		return
+	}
+
+	f.fc.Lock()
+	ent := *f.ent.content
+	f.fc.Unlock()
+	result <- ent
+}
+
+// mapChannel receives the result of the source of a mapped future from
+// the source's channel, maps it, and sends it on the result channel,
+// which is then closed.  If the stop channel is closed first, the
+// result channel is closed without sending anything.  It MUST be
+// called as a goroutine.
+func (f *Future) mapChannel(src <-chan Entry, stop <-chan struct{}, result chan<- Entry) {
+	defer close(result)
+
+	// Wait for the source result
+	var ent Entry
+	var ok bool
+	select {
+	case ent, ok = <-src:
+	case <-stop:
+		return
+	}
+
+	// If the channel was closed without a result, get the entry
+	// contents
+	if !ok {
+		f.fc.Lock()
+		if f.ent.content != nil {
+			ent = *f.ent.content
+		}
+		f.fc.Unlock()
+	}
+
+	// Map the object
+	if ent.Error != nil {
+		result <- Entry{
+			Error: ent.Error,
+		}
+		return
+	}
+	obj, err := f.mapper(ent.Object)
+	result <- Entry{
+		Object: obj,
+		Error:  err,
+	}
+}
+
+// Pending returns a boolean true value if the entry the future is
+// waiting on has not yet been completed, that is, if waiting on the
+// future would block.  Canceled futures are never pending.
+func (f *Future) Pending() bool {
+	// Canceled futures are not pending
+	if f.canceled {
+		return false
+	}
+
+	// Check the source of a mapped future
+	if f.src != nil {
+		return f.src.Pending()
+	}
+
+	// Lock the cache and check the entry
+	f.fc.Lock()
+	defer f.fc.Unlock()
+	return f.ent.content == nil
+}
+
+// Map returns a new Future that transforms the object returned by
+// this Future using the specified Mapper.  If this Future resolves to
+// an error, the error is returned without calling the Mapper;
+// otherwise, the results of the Mapper are returned.  Canceling the
+// new Future also cancels this Future.  Once Map has been called,
+// callers should wait only on the new Future.
+func (f *Future) Map(mapper Mapper) *Future {
+	return &Future{
+		fc:     f.fc,
+		ent:    f.ent,
+		src:    f,
+		mapper: mapper,
+	}
+}
+
+// OnCompleteKey registers a callback to be called when the pending
+// entry with the specified key is completed.  The callback is called
+// exactly once, in a separate goroutine, and is passed the completed
+// entry.  If the entry is already complete, the callback is started
+// immediately.  If there is no entry with the specified key,
+// ErrNotCached is returned.
+func (fc *FCache) OnCompleteKey(key Key, fn func(Entry)) error {
+	// Lock the cache
+	fc.Lock()
+
+	// Look for the index
+	idx, ok := fc.indexes[key.Index]
+	if !ok {
+		fc.Unlock()
+		return ErrBadIndex
+	}
+
+	// Look for the entry
+	ent, ok := idx.entries[idx.hash(key.Key)]
+	if !ok {
+		fc.Unlock()
+		return ErrNotCached
+	}
+
+	// Register the callback if the entry is pending
+	if ent.content == nil {
+		ent.onDone = append(ent.onDone, fn)
+		fc.Unlock()
+		return nil
+	}
+
+	// Call the callback
+	content := *ent.content
+	fc.Unlock()
+	go fn(content)
+
+	return nil
+}
@@ -17,8 +17,10 @@ package fcache
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFutureWaitInternalBase(t *testing.T) {
@@ -31,13 +33,28 @@ func TestFutureWaitInternalBase(t *testing.T) {
 		result: resultChan,
 	}
 
-	result := obj.wait(ctx)
+	result, ok := obj.wait(ctx)
 
+	assert.True(t, ok)
 	assert.Equal(t, Entry{
 		Error: assert.AnError,
 	}, result)
 }
 
+func TestFutureWaitInternalClosed(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	close(resultChan)
+	ctx := context.Background()
+	obj := &Future{
+		result: resultChan,
+	}
+
+	result, ok := obj.wait(ctx)
+
+	assert.False(t, ok)
+	assert.Equal(t, Entry{}, result)
+}
+
 func TestFutureWaitInternalCanceled(t *testing.T) {
 	resultChan := make(chan Entry, 1)
 	ctx, cancelFunc := context.WithCancel(context.Background())
@@ -46,13 +63,33 @@ func TestFutureWaitInternalCanceled(t *testing.T) {
 		result: resultChan,
 	}
 
-	result := obj.wait(ctx)
+	result, ok := obj.wait(ctx)
 
+	assert.True(t, ok)
 	assert.Equal(t, Entry{
 		Error: context.Canceled,
 	}, result)
 }
 
+func TestFutureWaitInternalCanceledResolved(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	resultChan <- Entry{
+		Object: "object",
+	}
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	cancelFunc()
+	obj := &Future{
+		result: resultChan,
+	}
+
+	result, ok := obj.wait(ctx)
+
+	assert.True(t, ok)
+	assert.Equal(t, Entry{
+		Object: "object",
+	}, result)
+}
+
 func TestFutureWaitWithContextBase(t *testing.T) {
 	resultChan := make(chan Entry, 1)
 	resultChan <- Entry{
@@ -71,6 +108,45 @@ func TestFutureWaitWithContextBase(t *testing.T) {
 	assert.Nil(t, obj.result)
 }
 
+func TestFutureWaitWithContextNilObject(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	resultChan <- Entry{}
+	ctx := context.Background()
+	obj := &Future{
+		result: resultChan,
+		ent:    &entry{},
+	}
+
+	result, err := obj.WaitWithContext(ctx)
+
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+	assert.Nil(t, obj.result)
+}
+
+func TestFCacheLookupNilObject(t *testing.T) {
+	release := make(chan struct{})
+	obj, err := New(Index{
+		Index: "one",
+		Factory: func(ctx context.Context, key Key) *Entry {
+			<-release
+			return &Entry{
+				Object: (*Entry)(nil),
+				Keys:   []Key{key},
+			}
+		},
+	})
+	require.NoError(t, err)
+	f, err := obj.LookupFuture(ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+	close(release)
+
+	result, err := f.Wait()
+
+	assert.NoError(t, err)
+	assert.Equal(t, (*Entry)(nil), result)
+}
+
 func TestFutureWaitWithContextComplete(t *testing.T) {
 	ctx := context.Background()
 	obj := &Future{
@@ -114,6 +190,63 @@ func TestFutureWaitWithContextUncached(t *testing.T) {
 	assert.Nil(t, result)
 }
 
+func TestFutureWaitWithContextShared(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+	obj := &Future{
+		fc: &FCache{},
+		ent: &entry{
+			content: &Entry{
+				Object: "object",
+			},
+		},
+		done: done,
+	}
+
+	result, err := obj.WaitWithContext(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Nil(t, obj.done)
+}
+
+func TestFutureWaitWithContextSharedCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	obj := &Future{
+		fc:   &FCache{},
+		ent:  &entry{},
+		done: make(chan struct{}),
+	}
+
+	result, err := obj.WaitWithContext(ctx)
+
+	assert.Same(t, context.Canceled, err)
+	assert.Nil(t, result)
+	assert.NotNil(t, obj.done)
+}
+
+func TestFutureWaitWithContextSharedCanceledResolved(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	close(done)
+	obj := &Future{
+		fc: &FCache{},
+		ent: &entry{
+			content: &Entry{
+				Object: "object",
+			},
+		},
+		done: done,
+	}
+
+	result, err := obj.WaitWithContext(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+}
+
 func TestFutureWait(t *testing.T) {
 	resultChan := make(chan Entry, 1)
 	resultChan <- Entry{
@@ -156,6 +289,184 @@ func TestFutureCancelBase(t *testing.T) {
 	}, obj)
 }
 
+func TestFutureCancelAbandoned(t *testing.T) {
+	canceled := false
+	resultChan := make(chan Entry, 1)
+	pending := &entry{
+		reqs: map[uint64]chan<- Entry{
+			42: resultChan,
+		},
+		cancel: func() { canceled = true },
+		auto:   &Key{"one", 1},
+	}
+	fc := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+		},
+	}
+	obj := &Future{
+		fc:     fc,
+		ent:    pending,
+		result: resultChan,
+		cookie: 42,
+	}
+
+	obj.Cancel()
+
+	assert.True(t, canceled)
+	assert.Len(t, fc.indexes["one"].entries, 0)
+	assert.Equal(t, &Entry{
+		Error: context.Canceled,
+		Keys:  []Key{{"one", 1}},
+	}, pending.content)
+}
+
+func TestFCacheAbandonWaiting(t *testing.T) {
+	pending := &entry{
+		reqs: map[uint64]chan<- Entry{
+			42: make(chan Entry, 1),
+		},
+		cancel: func() { panic("canceled") },
+		auto:   &Key{"one", 1},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+		},
+	}
+
+	obj.abandon(pending)
+
+	assert.Same(t, pending, obj.indexes["one"].entries[1])
+	assert.Nil(t, pending.content)
+}
+
+func TestFCacheAbandonNotAuto(t *testing.T) {
+	pending := &entry{
+		cancel: func() { panic("canceled") },
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+		},
+	}
+
+	obj.abandon(pending)
+
+	assert.Same(t, pending, obj.indexes["one"].entries[1])
+	assert.Nil(t, pending.content)
+}
+
+func TestFCacheAbandonCallbacks(t *testing.T) {
+	pending := &entry{
+		cancel: func() { panic("canceled") },
+		onDone: []func(Entry){func(Entry) {}},
+		auto:   &Key{"one", 1},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+		},
+	}
+
+	obj.abandon(pending)
+
+	assert.Same(t, pending, obj.indexes["one"].entries[1])
+	assert.Nil(t, pending.content)
+}
+
+func TestFCacheAbandonShared(t *testing.T) {
+	pending := &entry{
+		cancel: func() { panic("canceled") },
+		done:   make(chan struct{}),
+		auto:   &Key{"one", 1},
+		shared: true,
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+		},
+	}
+
+	obj.abandon(pending)
+
+	assert.Same(t, pending, obj.indexes["one"].entries[1])
+	assert.Nil(t, pending.content)
+}
+
+func TestFCacheAutoCancel(t *testing.T) {
+	factoryErr := make(chan error, 1)
+	obj, err := NewWithOptions([]Index{{
+		Index: "one",
+		Factory: func(ctx context.Context, key Key) *Entry {
+			<-ctx.Done()
+			factoryErr <- ctx.Err()
+			return &Entry{
+				Error: ctx.Err(),
+				Keys:  []Key{key},
+			}
+		},
+	}}, AutoCancel)
+	require.NoError(t, err)
+
+	f1, err := obj.LookupFuture(ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+	f2, err := obj.LookupFuture(ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+	f1.Cancel()
+	assert.True(t, f2.Pending())
+	f2.Cancel()
+
+	assert.Same(t, context.Canceled, <-factoryErr)
+	obj.Lock()
+	defer obj.Unlock()
+	assert.Len(t, obj.indexes["one"].entries, 0)
+	assert.Equal(t, 0, obj.pending)
+}
+
+func TestFCacheAutoCancelPreload(t *testing.T) {
+	release := make(chan struct{})
+	obj, err := NewWithOptions([]Index{{
+		Index: "one",
+		Factory: func(ctx context.Context, key Key) *Entry {
+			<-release
+			return &Entry{
+				Object: ctx.Err() == nil,
+				Keys:   []Key{key},
+			}
+		},
+	}}, AutoCancel)
+	require.NoError(t, err)
+
+	err = obj.Preload([]Key{{"one", 1}})
+	require.NoError(t, err)
+	close(release)
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, true, result)
+}
+
 func TestFutureCancelCanceled(t *testing.T) {
 	resultChan := make(chan Entry, 1)
 	obj := &Future{
@@ -223,6 +534,51 @@ func TestFutureChannelSynthesized(t *testing.T) {
 	}, data)
 }
 
+func TestFutureChannelShared(t *testing.T) {
+	done := make(chan struct{})
+	ent := &entry{
+		done: done,
+	}
+	obj := &Future{
+		fc:   &FCache{},
+		ent:  ent,
+		done: done,
+	}
+
+	result := obj.Channel()
+	obj.fc.Lock()
+	ent.complete(&Entry{
+		Object: "object",
+	})
+	obj.fc.Unlock()
+
+	assert.Equal(t, Entry{
+		Object: "object",
+	}, <-result)
+}
+
+func TestFutureChannelSharedCanceled(t *testing.T) {
+	done := make(chan struct{})
+	ent := &entry{
+		done: done,
+	}
+	obj := &Future{
+		fc:   &FCache{},
+		ent:  ent,
+		done: done,
+	}
+
+	result := obj.Channel()
+	obj.Cancel()
+
+	select {
+	case _, ok := <-result:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed")
+	}
+}
+
 func TestFutureChannelCanceled(t *testing.T) {
 	resultChan := make(chan Entry, 1)
 	resultChan <- Entry{
@@ -249,3 +605,324 @@ func TestFutureChannelNoEntry(t *testing.T) {
 
 	assert.Nil(t, result)
 }
+
+func TestFutureMap(t *testing.T) {
+	src := &Future{
+		fc:  &FCache{},
+		ent: &entry{},
+	}
+	mapper := func(obj interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	result := src.Map(mapper)
+
+	assert.Same(t, src.fc, result.fc)
+	assert.Same(t, src.ent, result.ent)
+	assert.Same(t, src, result.src)
+	assert.NotNil(t, result.mapper)
+}
+
+func TestFutureMapWait(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	resultChan <- Entry{
+		Object: "object",
+	}
+	src := &Future{
+		result: resultChan,
+	}
+	obj := src.Map(func(obj interface{}) (interface{}, error) {
+		return obj.(string) + " mapped", nil
+	})
+
+	result, err := obj.Wait()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object mapped", result)
+}
+
+func TestFutureMapWaitError(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	resultChan <- Entry{
+		Error: assert.AnError,
+	}
+	src := &Future{
+		result: resultChan,
+	}
+	obj := src.Map(func(obj interface{}) (interface{}, error) {
+		t.Fail()
+		return nil, nil
+	})
+
+	result, err := obj.Wait()
+
+	assert.Same(t, assert.AnError, err)
+	assert.Nil(t, result)
+}
+
+func TestFutureMapWaitMapperError(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	resultChan <- Entry{
+		Object: "object",
+	}
+	src := &Future{
+		result: resultChan,
+	}
+	obj := src.Map(func(obj interface{}) (interface{}, error) {
+		return nil, assert.AnError
+	})
+
+	result, err := obj.Wait()
+
+	assert.Same(t, assert.AnError, err)
+	assert.Nil(t, result)
+}
+
+func TestFutureMapChannel(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	resultChan <- Entry{
+		Object: "object",
+	}
+	src := &Future{
+		result: resultChan,
+	}
+	obj := src.Map(func(obj interface{}) (interface{}, error) {
+		return obj.(string) + " mapped", nil
+	})
+
+	result := <-obj.Channel()
+
+	assert.Equal(t, Entry{
+		Object: "object mapped",
+	}, result)
+}
+
+func TestFutureMapChannelError(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	resultChan <- Entry{
+		Error: assert.AnError,
+	}
+	src := &Future{
+		result: resultChan,
+	}
+	obj := src.Map(func(obj interface{}) (interface{}, error) {
+		t.Fail()
+		return nil, nil
+	})
+
+	result := <-obj.Channel()
+
+	assert.Equal(t, Entry{
+		Error: assert.AnError,
+	}, result)
+}
+
+func TestFutureMapChannelClosed(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	close(resultChan)
+	src := &Future{
+		fc: &FCache{},
+		ent: &entry{
+			content: &Entry{
+				Object: "object",
+			},
+		},
+		result: resultChan,
+	}
+	obj := src.Map(func(obj interface{}) (interface{}, error) {
+		return obj.(string) + " mapped", nil
+	})
+
+	result := <-obj.Channel()
+
+	assert.Equal(t, Entry{
+		Object: "object mapped",
+	}, result)
+}
+
+func TestFutureMapChannelCanceled(t *testing.T) {
+	resultChan := make(chan Entry, 1)
+	ent := &entry{
+		reqs: map[uint64]chan<- Entry{
+			42: resultChan,
+		},
+	}
+	src := &Future{
+		fc:     &FCache{},
+		ent:    ent,
+		result: resultChan,
+		cookie: 42,
+	}
+	obj := src.Map(func(obj interface{}) (interface{}, error) {
+		t.Fail()
+		return nil, nil
+	})
+	ch := obj.Channel()
+
+	obj.Cancel()
+
+	select {
+	case result, ok := <-ch:
+		assert.False(t, ok)
+		assert.Equal(t, Entry{}, result)
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed")
+	}
+}
+
+func TestFutureMapCancel(t *testing.T) {
+	ent := &entry{
+		reqs: map[uint64]chan<- Entry{
+			42: make(chan Entry, 1),
+		},
+	}
+	src := &Future{
+		fc:     &FCache{},
+		ent:    ent,
+		result: make(chan Entry, 1),
+		cookie: 42,
+	}
+	obj := src.Map(func(obj interface{}) (interface{}, error) {
+		return obj, nil
+	})
+
+	obj.Cancel()
+
+	assert.True(t, obj.canceled)
+	assert.True(t, src.canceled)
+	assert.Len(t, ent.reqs, 0)
+	result, err := obj.Wait()
+	assert.Same(t, ErrFutureCanceled, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheOnCompleteKeyPending(t *testing.T) {
+	ent := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+	called := make(chan Entry, 1)
+
+	err := obj.OnCompleteKey(Key{"one", 1}, func(ent Entry) {
+		called <- ent
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, ent.onDone, 1)
+	obj.Lock()
+	ent.complete(&Entry{
+		Object: "object",
+	})
+	obj.Unlock()
+	assert.Equal(t, Entry{Object: "object"}, <-called)
+}
+
+func TestFCacheOnCompleteKeyCompleted(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+				},
+			},
+		},
+	}
+	called := make(chan Entry, 1)
+
+	err := obj.OnCompleteKey(Key{"one", 1}, func(ent Entry) {
+		called <- ent
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Entry{Object: "object"}, <-called)
+}
+
+func TestFCacheOnCompleteKeyMissing(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	err := obj.OnCompleteKey(Key{"one", 1}, func(ent Entry) {
+		t.Fail()
+	})
+
+	assert.Same(t, ErrNotCached, err)
+}
+
+func TestFCacheOnCompleteKeyBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.OnCompleteKey(Key{"one", 1}, func(ent Entry) {
+		t.Fail()
+	})
+
+	assert.Same(t, ErrBadIndex, err)
+}
+
+func TestFuturePendingTrue(t *testing.T) {
+	obj := &Future{
+		fc:  &FCache{},
+		ent: &entry{},
+	}
+
+	result := obj.Pending()
+
+	assert.True(t, result)
+}
+
+func TestFuturePendingFalse(t *testing.T) {
+	obj := &Future{
+		fc: &FCache{},
+		ent: &entry{
+			content: &Entry{
+				Object: "object",
+			},
+		},
+	}
+
+	result := obj.Pending()
+
+	assert.False(t, result)
+}
+
+func TestFuturePendingCanceled(t *testing.T) {
+	obj := &Future{
+		fc:       &FCache{},
+		ent:      &entry{},
+		canceled: true,
+	}
+
+	result := obj.Pending()
+
+	assert.False(t, result)
+}
+
+func TestFuturePendingMapped(t *testing.T) {
+	src := &Future{
+		fc:  &FCache{},
+		ent: &entry{},
+	}
+	obj := src.Map(func(obj interface{}) (interface{}, error) {
+		return obj, nil
+	})
+
+	result := obj.Pending()
+
+	assert.True(t, result)
+}
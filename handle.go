@@ -0,0 +1,162 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+// EntryHandle is returned by LockEntry and provides exclusive access
+// to a cached object.  The handle must be released by calling either
+// Commit or Unlock.
+type EntryHandle struct {
+	fc       *FCache       // The cache the handle is from
+	ent      *entry        // The locked entry
+	key      Key           // The key used to find the entry
+	sem      chan struct{} // The entry lock
+	released bool          // A flag indicating the handle was released
+}
+
+// LockEntry looks up a completed entry in the cache and locks it for
+// exclusive update, returning an EntryHandle.  The options specify
+// which entry to lock; the index factory function is never invoked.
+// If the entry is already locked, LockEntry waits until it is
+// released, or until the context passed with the WithContext option
+// is done.  If the entry is not present in the cache or is pending,
+// ErrNotCached is returned; if it is a cached error, that error is
+// returned.  Note that only other callers of LockEntry are excluded;
+// lookups continue to return the cached object, and methods such as
+// Update and Evict do not wait for the entry to be released.
+func (fc *FCache) LockEntry(opts ...LookupOption) (*EntryHandle, error) {
+	// Process the options
+	o, err := procLookupOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	cancel := o.applyTimeout()
+	defer cancel()
+
+	// Lock the cache
+	fc.Lock()
+
+	// Find the entry
+	ent, err := fc.findLocked(*o.key)
+	if err != nil {
+		fc.Unlock()
+		return nil, err
+	}
+	if ent.lock == nil {
+		ent.lock = make(chan struct{}, 1)
+	}
+	sem := ent.lock
+	fc.Unlock()
+
+	// Acquire the entry lock
+	select {
+	case sem <- struct{}{}:
+	case <-o.ctx.Done():
+		return nil, o.ctx.Err()
+	}
+
+	// Make sure the entry is still cached
+	fc.Lock()
+	defer fc.Unlock()
+	if cur, err := fc.findLocked(*o.key); err != nil || cur != ent {
+		<-sem
+		if err == nil {
+			err = ErrNotCached
+		}
+		return nil, err
+	}
+
+	return &EntryHandle{
+		fc:  fc,
+		ent: ent,
+		key: *o.key,
+		sem: sem,
+	}, nil
+}
+
+// findLocked finds the completed entry for LockEntry.  The cache MUST
+// be locked upon entry to this method.
+func (fc *FCache) findLocked(key Key) (*entry, error) {
+	// Look for the index
+	idx, ok := fc.indexes[key.Index]
+	if !ok {
+		return nil, ErrBadIndex
+	}
+
+	// Check to see if there's a completed entry
+	ent, ok := idx.entries[idx.hash(key.Key)]
+	if !ok || ent.content == nil {
+		return nil, ErrNotCached
+	}
+	if ent.content.Error != nil {
+		return nil, ent.content.Error
+	}
+
+	return ent, nil
+}
+
+// Object returns the object the handle provides access to.
+func (h *EntryHandle) Object() interface{} {
+	h.fc.Lock()
+	defer h.fc.Unlock()
+
+	return h.ent.content.Object
+}
+
+// Commit replaces the object in all indexes referring to it with the
+// specified object, then releases the handle.  If the entry was
+// removed from the cache while the handle was held, the object is
+// discarded and ErrNotCached is returned.  If the handle has already
+// been released, ErrHandleReleased is returned.
+func (h *EntryHandle) Commit(obj interface{}) error {
+	// Lock the cache
+	h.fc.Lock()
+	defer h.fc.Unlock()
+
+	// Make sure the handle is still held
+	if h.released {
+		return ErrHandleReleased
+	}
+	h.release()
+
+	// Make sure the entry is still cached
+	if cur, err := h.fc.findLocked(h.key); err != nil || cur != h.ent {
+		return ErrNotCached
+	}
+
+	// Store the object
+	h.ent.content.Object = obj
+	h.ent.content.Version = h.fc.nextVersion()
+
+	return nil
+}
+
+// Unlock releases the handle without altering the object.  Calling
+// Unlock on a handle that has already been released has no effect.
+func (h *EntryHandle) Unlock() {
+	// Lock the cache
+	h.fc.Lock()
+	defer h.fc.Unlock()
+
+	if !h.released {
+		h.release()
+	}
+}
+
+// release releases the entry lock.  The cache MUST be locked upon
+// entry to this method.
+func (h *EntryHandle) release() {
+	h.released = true
+	<-h.sem
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFCacheLockEntryBase(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	result, err := obj.LockEntry(ByKey(Key{"one", 1}))
+
+	require.NoError(t, err)
+	assert.Same(t, ent, result.ent)
+	assert.Equal(t, Key{"one", 1}, result.key)
+	assert.Equal(t, "object", result.Object())
+	assert.Len(t, ent.lock, 1)
+	assert.NoError(t, result.Commit("new"))
+	assert.Equal(t, "new", ent.content.Object)
+	assert.Len(t, ent.lock, 0)
+	assert.Same(t, ErrHandleReleased, result.Commit("newer"))
+	assert.Equal(t, "new", ent.content.Object)
+}
+
+func TestFCacheLockEntryExclusive(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: 0,
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+	done := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		go func() {
+			h, err := obj.LockEntry(ByKey(Key{"one", 1}))
+			if assert.NoError(t, err) {
+				value := h.Object().(int)
+				time.Sleep(time.Millisecond)
+				assert.NoError(t, h.Commit(value+1))
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		<-done
+	}
+
+	assert.Equal(t, 5, ent.content.Object)
+}
+
+func TestFCacheLockEntryCanceled(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 1}},
+		},
+		lock: make(chan struct{}, 1),
+	}
+	ent.lock <- struct{}{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := obj.LockEntry(ByKey(Key{"one", 1}), WithContext(ctx))
+
+	assert.Same(t, context.Canceled, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLockEntryEvicted(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 1}},
+		},
+		lock: make(chan struct{}, 1),
+	}
+	ent.lock <- struct{}{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		obj.Lock()
+		defer obj.Unlock()
+		obj.evict(ent.content.Keys)
+		<-ent.lock
+	}()
+
+	result, err := obj.LockEntry(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrNotCached, err)
+	assert.Nil(t, result)
+	assert.Len(t, ent.lock, 0)
+}
+
+func TestFCacheLockEntryBadOption(t *testing.T) {
+	obj := &FCache{}
+
+	result, err := obj.LockEntry()
+
+	assert.Same(t, ErrNoKey, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLockEntryNotCached(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					2: {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.LockEntry(ByKey(Key{"one", 1}))
+	assert.Same(t, ErrNotCached, err)
+	assert.Nil(t, result)
+	result, err = obj.LockEntry(ByKey(Key{"one", 2}))
+	assert.Same(t, ErrNotCached, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLockEntryCachedError(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Error: assert.AnError,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.LockEntry(ByKey(Key{"one", 1}))
+
+	assert.Same(t, assert.AnError, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLockEntryBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.LockEntry(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestEntryHandleCommitEvicted(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+		},
+		lock: make(chan struct{}, 1),
+	}
+	ent.lock <- struct{}{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+	h := &EntryHandle{
+		fc:  obj,
+		ent: ent,
+		key: Key{"one", 1},
+		sem: ent.lock,
+	}
+
+	err := h.Commit("new")
+
+	assert.Same(t, ErrNotCached, err)
+	assert.Equal(t, "object", ent.content.Object)
+	assert.Len(t, ent.lock, 0)
+}
+
+func TestEntryHandleUnlock(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+		},
+		lock: make(chan struct{}, 1),
+	}
+	ent.lock <- struct{}{}
+	h := &EntryHandle{
+		fc:  &FCache{},
+		ent: ent,
+		sem: ent.lock,
+	}
+
+	h.Unlock()
+	h.Unlock()
+
+	assert.True(t, h.released)
+	assert.Len(t, ent.lock, 0)
+	assert.Equal(t, "object", ent.content.Object)
+}
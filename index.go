@@ -16,7 +16,9 @@ package fcache
 
 import (
 	"context"
+	"sort"
 	"sync/atomic"
+	"time"
 )
 
 // Factory describes a function that may be used to construct an
@@ -24,9 +26,69 @@ import (
 // called with a context.Context object, which may be used to cancel
 // the factory function, and must return the entry for the constructed
 // object.  Wrapping the error in a PermanentError will cause the
-// error to be cached in the index.
+// error to be cached in the index; wrapping it in a RetryableError
+// will cause it to be cached until the specified time.
 type Factory func(ctx context.Context, key Key) *Entry
 
+// GroupFactory describes a function that may be used to construct
+// all the objects in a group when any of them is not found in the
+// specified index.  It is called with a context.Context object, which
+// may be used to cancel the factory function, and the key that
+// triggered the call, and must return the entries for all the
+// objects in the group.
+type GroupFactory func(ctx context.Context, key Key) []*Entry
+
+// AsyncFactory describes a function that may be used in place of a
+// Factory by data sources that are already asynchronous.  Rather than
+// returning the entry for the constructed object, it starts
+// constructing the object and returns a channel on which the entry
+// will be sent.  The context.Context object is canceled if the entry
+// is no longer needed; in that case, the channel is abandoned, so it
+// should be buffered to avoid leaking the goroutine sending on it.
+type AsyncFactory func(ctx context.Context, key Key) <-chan *Entry
+
+// asyncFactory wraps an asynchronous factory function so that it may
+// be called as a Factory.  If the context is canceled before the
+// entry is sent, the entry is completed with the context error; if
+// the channel is closed without sending an entry, the entry is
+// completed with ErrFactoryNil.
+func asyncFactory(factory AsyncFactory) Factory {
+	return func(ctx context.Context, key Key) *Entry {
+		select {
+		case ent := <-factory(ctx, key):
+			return ent
+		case <-ctx.Done():
+			return &Entry{
+				Error: ctx.Err(),
+				Keys:  []Key{key},
+			}
+		}
+	}
+}
+
+// PostFactory describes a function that may be used to validate or
+// rewrite the entries returned by the factory functions for an index
+// before they are cached.  It is called with the key that triggered
+// the factory call and the entry returned by the factory, and returns
+// the entry to cache.  If it returns an error, the entry is replaced
+// by an entry with that error; wrapping the error in a
+// PermanentError will cause the error to be cached in the index.
+type PostFactory func(key Key, ent *Entry) (*Entry, error)
+
+// WriteThrough describes a function that may be used to write the
+// objects returned by the factory functions for an index to a durable
+// store before they are cached.  It is called with the context passed
+// to the factory and the entry to cache.  If it returns an error, the
+// entry is replaced by an entry with that error, so the object is not
+// cached; wrapping the error in a PermanentError will cause the error
+// to be cached in the index instead.
+type WriteThrough func(ctx context.Context, ent Entry) error
+
+// KeyHasher describes a function that may be used to map a key within
+// an index to a comparable value, which may then be used as a map
+// key.  See Index.
+type KeyHasher func(key interface{}) interface{}
+
 // Key describes a cache key.  A cache key is a two-ple struct,
 // consisting of the name of an index and a key within that index for
 // the object.  If the key does not exist in the index, the factory
@@ -38,19 +100,132 @@ type Key struct {
 }
 
 // Entry describes the object (or permanent error), including its
-// index keys.
+// index keys.  The CreatedAt field is set by the cache when the entry
+// is cached.  A factory may set NotFound to indicate that the object
+// does not exist; such an entry is cached, and lookups of it return
+// ErrNotFound.  If OnEvict is provided, it is called exactly once, in
+// a separate goroutine, when the cached entry is evicted or cleaned
+// out of the cache; this may be used to release resources owned by
+// the object.  Tags may be used to evict related entries together,
+// using EvictByTag.  Pending is set only on the placeholders returned
+// by Contents with the ContentsIncludePending option.
 type Entry struct {
-	Object interface{} // The object
-	Error  error       // An error encountered by the factory
-	Keys   []Key       // A list of keys associated with the object
+	Object    interface{} // The object
+	Error     error       // An error encountered by the factory
+	Keys      []Key       // A list of keys associated with the object
+	CreatedAt time.Time   // The time the entry was cached
+	NotFound  bool        // The object does not exist
+	OnEvict   func()      // Called when the entry is evicted
+	Version   uint64      // The version of the content; set by the cache
+	Tags      []string    // Tags for evicting related entries
+	Pending   bool        // Placeholder for a pending entry
+
+	multi   bool // Entry contains the set for a multi-value index
+	evicted bool // OnEvict has been called
+}
+
+// Clone returns a copy of the entry, which may be safely altered.  The
+// Keys slice is copied, so the copy does not share it with the entry;
+// however, the Object is not copied.
+func (e Entry) Clone() Entry {
+	result := e
+	if e.Keys != nil {
+		result.Keys = make([]Key, len(e.Keys))
+		copy(result.Keys, e.Keys)
+	}
+	if e.Tags != nil {
+		result.Tags = make([]string, len(e.Tags))
+		copy(result.Tags, e.Tags)
+	}
+
+	return result
+}
+
+// checkNotFound sets the error of an entry marked NotFound to
+// ErrNotFound, unless it already has an error.
+func (e *Entry) checkNotFound() {
+	if e.NotFound && e.Error == nil {
+		e.Error = ErrNotFound
+	}
 }
 
 // Index describes an index.  At least one of these structures must be
 // passed to New to construct an FCache object.  Each Index must have
 // both the index key and the factory function.
+//
+// If GroupKey is provided, it is called to derive a group key for
+// each key that misses in the index.  Concurrent misses sharing a
+// group key will result in only a single call to GroupFactory, which
+// must then return the entries for all keys in the group; the
+// Factory is not required in this case.  Any keys in the group not
+// returned by GroupFactory complete with ErrEntryNotFound.
+//
+// If AsyncFactory is provided and Factory is not, it is used as the
+// factory function for the index; the entry it sends on the returned
+// channel completes the entry, as if it had been returned by a
+// Factory.
+//
+// If DefaultObject is provided, lookups that only search the cache
+// return it, rather than ErrNotCached, when the key is not cached.
+// The default object is not stored in the cache.
+//
+// If OnComplete is provided, it is called with the entry when a
+// pending entry in the index is completed.  If OnEvict is provided,
+// it is called with the entry when a completed entry is evicted from
+// or cleaned out of the index.  Both are called in a separate
+// goroutine.
+//
+// If Serialize is set, at most one factory function call for the
+// index will be in progress at any time, regardless of the key; other
+// calls wait for it to complete.
+//
+// If PostFactory is provided, it is called with each entry returned
+// by a factory function for the index, including a factory passed
+// with the WithFactory option, before the entry is cached.
+//
+// If KeyHasher is provided, it is used to map each key within the
+// index to a comparable value, which is used internally in place of
+// the key.  This allows keys that may not be used as map keys, such
+// as slices, to be used.  Keys that map to the same value refer to
+// the same entry.
+//
+// If MultiValue is set, each key within the index refers to a set of
+// objects, rather than a single object.  The GroupFactory is called
+// with the key and must return the entries for all the objects in the
+// set; a lookup then returns the objects as a []interface{}.  If any
+// of the returned entries has an error, the lookup returns that error
+// instead.  The entries returned by the GroupFactory are not added to
+// the other indexes, and entries returned by the factories of other
+// indexes, or passed with ByEntry, are not added to the sets; the
+// GroupKey and Factory are ignored.  A factory passed with the
+// WithFactory option must return an entry with the set as its
+// []interface{} object.
+//
+// If RefreshInterval is provided, a stale entry is not refreshed if a
+// refresh of it completed less than that long ago; the entry remains
+// stale, and is refreshed by a later lookup after the interval has
+// passed.
+//
+// If WriteThrough is provided, it is called with each entry without an
+// error, and not marked NotFound, returned by a factory function for
+// the index, after any PostFactory, before the entry is cached.
+// Entries passed with ByEntry or inserted by other methods are not
+// written.
 type Index struct {
-	Index   interface{} // Key describing the index
-	Factory Factory     // The factory function for the index
+	Index           interface{}           // Key describing the index
+	Factory         Factory               // The factory function for the index
+	AsyncFactory    AsyncFactory          // Asynchronous factory for the index
+	GroupKey        func(Key) interface{} // Derives a group key from a key
+	GroupFactory    GroupFactory          // The factory function for a group
+	DefaultObject   interface{}           // Object to return on a cache miss
+	OnComplete      func(Entry)           // Called when an entry completes
+	OnEvict         func(Entry)           // Called when an entry is evicted
+	Serialize       bool                  // Call only one factory at a time
+	PostFactory     PostFactory           // Validates factory results
+	KeyHasher       KeyHasher             // Maps keys to comparable values
+	MultiValue      bool                  // Keys refer to sets of objects
+	RefreshInterval time.Duration         // Minimum time between refreshes
+	WriteThrough    WriteThrough          // Writes factory results to a store
 }
 
 // entry contains the internal index entry, which also contains
@@ -59,13 +234,325 @@ type entry struct {
 	content *Entry                  // The contents of the entry
 	reqs    map[uint64]chan<- Entry // Pending waiting requests
 	cancel  context.CancelFunc      // Function to cancel request
+	stale   bool                    // Entry should be refreshed
+	next    *entry                  // Pending refresh of the entry
+	done    chan struct{}           // Closed when the entry completes
+	onDone  []func(Entry)           // Callbacks to call on completion
+	counter *int                    // Count of pending entries
+	refresh time.Time               // Time the last refresh completed
+	lock    chan struct{}           // Lock for exclusive update
+	hits    uint64                  // Number of lookups that hit
+	auto    *Key                    // Key to cancel when abandoned
+	shared  bool                    // Futures share the notification channel
 }
 
 // index contains a single index.  An FCache contains one or more such
 // indexes.
 type index struct {
-	factory Factory                // The factory that fetches the object
-	entries map[interface{}]*entry // The entries in the index
+	factory      Factory                 // The factory that fetches the object
+	entries      map[interface{}]*entry  // The entries in the index
+	groupKey     func(Key) interface{}   // Derives a group key from a key
+	groupFactory GroupFactory            // The factory that fetches a group
+	groups       map[interface{}]*group  // Groups being fetched
+	defObject    interface{}             // Object to return on a cache miss
+	waiters      map[interface{}]*waiter // Waiters for absent keys
+	onComplete   func(Entry)             // Called when an entry completes
+	onEvict      func(Entry)             // Called when an entry is evicted
+	serial       chan struct{}           // Semaphore to serialize factories
+	post         PostFactory             // Validates factory results
+	hasher       KeyHasher               // Maps keys to comparable values
+	multi        bool                    // Keys refer to sets of objects
+	refreshEvery time.Duration           // Minimum time between refreshes
+	growth       *IndexGrowth            // Growth of the entries map
+	write        WriteThrough            // Writes factory results to a store
+}
+
+// grew records the size of the entries map after entries have been
+// added to the index.  The cache MUST be locked upon entry to this
+// method.
+func (idx index) grew() {
+	if idx.growth == nil {
+		return
+	}
+
+	n := len(idx.entries)
+	if n > idx.growth.Peak {
+		idx.growth.Peak = n
+	}
+	if n > idx.growth.PeakSinceRealloc {
+		idx.growth.PeakSinceRealloc = n
+	}
+}
+
+// group contains the keys of the pending entries waiting on a single
+// call to an index's group factory.
+type group struct {
+	keys []Key // Keys waiting on the group factory
+}
+
+// waiter contains a pending entry used by WaitFor to wait for a key
+// that is not yet present in an index.
+type waiter struct {
+	ent   *entry // Entry completed when the key is inserted
+	count int    // Number of callers waiting
+}
+
+// hash maps a key within the index to the value used internally.  If
+// the index has no KeyHasher, the key itself is returned.
+func (idx index) hash(key interface{}) interface{} {
+	if idx.hasher == nil {
+		return key
+	}
+
+	return idx.hasher(key)
+}
+
+// notify completes the waiter for the specified key, if there is one.
+// It must be called with the hashed key whenever completed content is
+// added to the index.
+// The cache MUST be locked upon entry to this method.
+func (idx index) notify(key interface{}, content *Entry) {
+	if w, ok := idx.waiters[key]; ok {
+		delete(idx.waiters, key)
+		w.ent.complete(content)
+	}
+}
+
+// complete completes a pending entry in the index, calling the
+// index's OnComplete callback.  It returns the result of calling the
+// complete method of the entry.  The cache MUST be locked upon entry
+// to this method.
+func (idx index) complete(e *entry, ent *Entry) bool {
+	if e.content == nil && idx.onComplete != nil {
+		go idx.onComplete(*ent)
+	}
+
+	return e.complete(ent)
+}
+
+// evicted calls the index's OnEvict callback for content that has
+// been removed from the index.  The entry's own OnEvict callback is
+// also called, if it has not already been.  The cache MUST be locked
+// upon entry to this method.
+func (idx index) evicted(content *Entry) {
+	if idx.onEvict != nil {
+		go idx.onEvict(*content)
+	}
+
+	if content.OnEvict != nil && !content.evicted {
+		content.evicted = true
+		go content.OnEvict()
+	}
+}
+
+// override prepares a factory function passed with the WithFactory
+// option for use with the index.  If the index is serialized, the
+// factory is wrapped to acquire the index's semaphore.
+func (idx index) override(factory Factory) Factory {
+	if idx.serial != nil {
+		factory = limitFactory(factory, idx.serial)
+	}
+	if idx.multi {
+		factory = markMulti(factory)
+	}
+
+	return writeFactory(postFactory(factory, idx.post), idx.write)
+}
+
+// multiFactory wraps a group factory function for a multi-value index
+// so that the entries it returns are combined into a single entry
+// containing the set of objects.
+func multiFactory(factory GroupFactory) Factory {
+	return func(ctx context.Context, key Key) *Entry {
+		result := &Entry{
+			Keys:  []Key{key},
+			multi: true,
+		}
+
+		// Collect the objects
+		objs := []interface{}{}
+		for _, ent := range factory(ctx, key) {
+			if ent == nil {
+				continue
+			}
+			if ent.Error != nil {
+				result.Error = ent.Error
+				return result
+			}
+			objs = append(objs, ent.Object)
+		}
+		result.Object = objs
+
+		return result
+	}
+}
+
+// markMulti wraps a factory function passed with the WithFactory
+// option for use with a multi-value index, so that the entry it
+// returns is treated as containing the set of objects.
+func markMulti(factory Factory) Factory {
+	return func(ctx context.Context, key Key) *Entry {
+		ent := factory(ctx, key)
+		if ent == nil {
+			return nil
+		}
+
+		return &Entry{
+			Object: ent.Object,
+			Error:  ent.Error,
+			Keys:   []Key{key},
+			multi:  true,
+		}
+	}
+}
+
+// postProcess calls the PostFactory function for an entry returned
+// by a factory function.  A nil entry is returned unaltered.
+func postProcess(post PostFactory, key Key, ent *Entry) *Entry {
+	if ent == nil {
+		return nil
+	}
+
+	result, err := post(key, ent)
+	if err != nil {
+		return &Entry{
+			Error: err,
+			Keys:  ent.Keys,
+		}
+	}
+
+	return result
+}
+
+// postFactory wraps a factory function so that the PostFactory
+// function is called with its results.  If the PostFactory function
+// is nil, the factory is returned unaltered.
+func postFactory(factory Factory, post PostFactory) Factory {
+	if factory == nil || post == nil {
+		return factory
+	}
+
+	return func(ctx context.Context, key Key) *Entry {
+		return postProcess(post, key, factory(ctx, key))
+	}
+}
+
+// postGroupFactory wraps a group factory function so that the
+// PostFactory function is called with each of its results.  If the
+// PostFactory function is nil, the group factory is returned
+// unaltered.
+func postGroupFactory(factory GroupFactory, post PostFactory) GroupFactory {
+	if factory == nil || post == nil {
+		return factory
+	}
+
+	return func(ctx context.Context, key Key) []*Entry {
+		ents := factory(ctx, key)
+		for i, ent := range ents {
+			ents[i] = postProcess(post, key, ent)
+		}
+
+		return ents
+	}
+}
+
+// writeProcess calls the WriteThrough function with an entry returned
+// by a factory function.  Entries with errors, or marked NotFound, are
+// not written.
+func writeProcess(ctx context.Context, write WriteThrough, ent *Entry) *Entry {
+	if ent == nil || ent.Error != nil || ent.NotFound {
+		return ent
+	}
+
+	if err := write(ctx, *ent); err != nil {
+		return &Entry{
+			Error: err,
+			Keys:  ent.Keys,
+		}
+	}
+
+	return ent
+}
+
+// writeFactory wraps a factory function so that the WriteThrough
+// function is called with its results.  If the WriteThrough function
+// is nil, the factory is returned unaltered.
+func writeFactory(factory Factory, write WriteThrough) Factory {
+	if factory == nil || write == nil {
+		return factory
+	}
+
+	return func(ctx context.Context, key Key) *Entry {
+		return writeProcess(ctx, write, factory(ctx, key))
+	}
+}
+
+// writeGroupFactory wraps a group factory function so that the
+// WriteThrough function is called with each of its results.  If the
+// WriteThrough function is nil, the group factory is returned
+// unaltered.
+func writeGroupFactory(factory GroupFactory, write WriteThrough) GroupFactory {
+	if factory == nil || write == nil {
+		return factory
+	}
+
+	return func(ctx context.Context, key Key) []*Entry {
+		ents := factory(ctx, key)
+		for i, ent := range ents {
+			ents[i] = writeProcess(ctx, write, ent)
+		}
+
+		return ents
+	}
+}
+
+// refreshFactory returns a factory function that may be used to
+// refresh a single entry in the index.  For indexes with a group key,
+// the group factory is called, and only the entry with the specified
+// key is returned; keys are compared using the index's KeyHasher, if
+// any.
+func (idx index) refreshFactory() Factory {
+	if idx.factory != nil || idx.groupFactory == nil {
+		return idx.factory
+	}
+
+	groupFactory := idx.groupFactory
+	return func(ctx context.Context, key Key) *Entry {
+		for _, ent := range groupFactory(ctx, key) {
+			if ent == nil {
+				continue
+			}
+
+			for _, k := range ent.Keys {
+				if k.Index == key.Index && idx.hash(k.Key) == idx.hash(key.Key) {
+					return ent
+				}
+			}
+		}
+
+		return &Entry{
+			Error: ErrEntryNotFound,
+			Keys:  []Key{key},
+		}
+	}
+}
+
+// defaultFuture returns a Future for the default object for the
+// index, if one is configured.  If there is no default object, it
+// returns ErrNotCached.  The default object is not stored in the
+// index.
+func (idx index) defaultFuture(fc *FCache, key Key) (*Future, error) {
+	if idx.defObject == nil {
+		return nil, ErrNotCached
+	}
+
+	ent := &entry{
+		content: &Entry{
+			Object: idx.defObject,
+			Keys:   []Key{key},
+		},
+	}
+	return ent.makeFuture(fc), nil
 }
 
 // newEntry constructs a new index entry, complete with a cancel
@@ -79,6 +566,10 @@ func newEntry() (*entry, context.Context) {
 	}, ctx
 }
 
+// now returns the current time.  It is a variable to allow it to be
+// patched in tests.
+var now = time.Now
+
 // reqCounter is a counter that is atomically incremented.  It is used
 // to provide a stream of cookies, which may be used for canceling
 // specific requests.
@@ -86,6 +577,28 @@ var reqCounter uint64
 
 // makeFuture constructs a Future from the entry.
 func (e *entry) makeFuture(fc *FCache) *Future {
+	// Share a notification channel if requested
+	if e.content == nil && fc.sharedNotify {
+		if e.done == nil {
+			e.done = make(chan struct{})
+		}
+		e.shared = true
+
+		return &Future{
+			fc:   fc,
+			ent:  e,
+			done: e.done,
+		}
+	}
+
+	return e.requestFuture(fc)
+}
+
+// requestFuture is similar to makeFuture, but always gives the future
+// its own result channel if the entry is not completed, even if
+// futures should share a notification channel.  The cache MUST be
+// locked upon entry to this method.
+func (e *entry) requestFuture(fc *FCache) *Future {
 	// Make a channel if we're not completed
 	var resultChan chan Entry
 	var cookie uint64
@@ -106,10 +619,25 @@ func (e *entry) makeFuture(fc *FCache) *Future {
 	}
 }
 
+// sortedCookies returns the cookies of the pending requests in
+// ascending order, which is the order in which the requests were
+// made.
+func sortedCookies(reqs map[uint64]chan<- Entry) []uint64 {
+	result := make([]uint64, 0, len(reqs))
+	for cookie := range reqs {
+		result = append(result, cookie)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+
+	return result
+}
+
 // complete updates the entry with the proper contents.  It returns a
-// boolean true value if the index entry should be removed, e.g., if
-// the error is non-nil and is not a permanent error.  This call will
-// cancel any pending operations.
+// boolean true value if the index entry should be removed, e.g., if the
+// error is non-nil and is not a permanent or retryable error.  This
+// call will cancel any pending operations.
 func (e *entry) complete(ent *Entry) bool {
 	// Do nothing if the entry is already complete
 	if e.content != nil {
@@ -125,10 +653,24 @@ func (e *entry) complete(ent *Entry) bool {
 	// Save the content
 	e.content = ent
 
-	// Pass it on to all pending requests and close the channels
+	// The entry is no longer pending
+	if e.counter != nil {
+		*e.counter--
+		e.counter = nil
+	}
+
+	// Pass it on to all pending requests and close the channels;
+	// this is done in the order the requests were made.  The
+	// cache is locked, so never block on a request channel; a
+	// waiter that misses the result will find the channel closed
+	// and retrieve the content from the entry instead
 	if e.reqs != nil {
-		for _, req := range e.reqs {
-			req <- *ent
+		for _, cookie := range sortedCookies(e.reqs) {
+			req := e.reqs[cookie]
+			select {
+			case req <- *ent:
+			default:
+			}
 			close(req)
 		}
 
@@ -136,6 +678,18 @@ func (e *entry) complete(ent *Entry) bool {
 		e.reqs = nil
 	}
 
+	// Notify the futures sharing the notification channel
+	if e.done != nil {
+		close(e.done)
+	}
+
+	// Invoke the callbacks; they're called in goroutines, since
+	// the cache is locked
+	for _, fn := range e.onDone {
+		go fn(*ent)
+	}
+	e.onDone = nil
+
 	// Check if the entry needs to be removed
-	return ent.Error != nil && !IsPermanent(ent.Error)
+	return !isCacheable(ent.Error)
 }
@@ -15,6 +15,8 @@
 package fcache
 
 import (
+	"context"
+	"fmt"
 	"testing"
 
 	"github.com/klmitch/patcher"
@@ -22,6 +24,246 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func TestAsyncFactoryBase(t *testing.T) {
+	factory := func(ctx context.Context, key Key) <-chan *Entry {
+		ch := make(chan *Entry, 1)
+		go func() {
+			ch <- &Entry{
+				Object: "object",
+				Keys:   []Key{key},
+			}
+		}()
+		return ch
+	}
+
+	result := asyncFactory(factory)(context.Background(), Key{"one", 1})
+
+	assert.Equal(t, &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}, result)
+}
+
+func TestAsyncFactoryClosed(t *testing.T) {
+	factory := func(ctx context.Context, key Key) <-chan *Entry {
+		ch := make(chan *Entry)
+		close(ch)
+		return ch
+	}
+
+	result := asyncFactory(factory)(context.Background(), Key{"one", 1})
+
+	assert.Nil(t, result)
+}
+
+func TestAsyncFactoryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	factory := func(ctx context.Context, key Key) <-chan *Entry {
+		return make(chan *Entry)
+	}
+
+	result := asyncFactory(factory)(ctx, Key{"one", 1})
+
+	assert.Equal(t, &Entry{
+		Error: context.Canceled,
+		Keys:  []Key{{"one", 1}},
+	}, result)
+}
+
+func TestEntryClone(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}
+
+	result := ent.Clone()
+	result.Keys[0] = Key{"two", 2}
+
+	assert.Equal(t, "object", result.Object)
+	assert.Equal(t, []Key{{"one", 1}}, ent.Keys)
+}
+
+func TestEntryCloneTags(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+		Tags:   []string{"tag"},
+	}
+
+	result := ent.Clone()
+	result.Tags[0] = "other"
+
+	assert.Equal(t, []string{"tag"}, ent.Tags)
+	assert.Equal(t, []string{"other"}, result.Tags)
+}
+
+func TestEntryCloneNilKeys(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+	}
+
+	result := ent.Clone()
+
+	assert.Equal(t, Entry{Object: "object"}, result)
+}
+
+func TestEntryCloneValue(t *testing.T) {
+	ent := Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}
+
+	result := ent.Clone()
+	result.Keys = append(result.Keys[:0], Key{"two", 2})
+
+	assert.Equal(t, []Key{{"one", 1}}, ent.Keys)
+	assert.Equal(t, []Key{{"two", 2}}, result.Keys)
+}
+
+func TestEntryCheckNotFoundBase(t *testing.T) {
+	obj := &Entry{
+		NotFound: true,
+	}
+
+	obj.checkNotFound()
+
+	assert.Same(t, ErrNotFound, obj.Error)
+}
+
+func TestEntryCheckNotFoundError(t *testing.T) {
+	obj := &Entry{
+		Error:    assert.AnError,
+		NotFound: true,
+	}
+
+	obj.checkNotFound()
+
+	assert.Same(t, assert.AnError, obj.Error)
+}
+
+func TestEntryCheckNotFoundFound(t *testing.T) {
+	obj := &Entry{}
+
+	obj.checkNotFound()
+
+	assert.Nil(t, obj.Error)
+}
+
+func TestIndexRefreshFactoryBase(t *testing.T) {
+	obj := index{
+		factory: factory,
+	}
+
+	result := obj.refreshFactory()
+
+	assert.NotNil(t, result)
+}
+
+func TestIndexRefreshFactoryGroup(t *testing.T) {
+	obj := index{
+		groupFactory: func(ctx context.Context, key Key) []*Entry {
+			return []*Entry{
+				nil,
+				{
+					Object: "o2",
+					Keys:   []Key{{"one", 2}},
+				},
+				{
+					Object: "o1",
+					Keys:   []Key{{"one", 1}},
+				},
+			}
+		},
+	}
+
+	result := obj.refreshFactory()
+
+	assert.Equal(t, &Entry{
+		Object: "o1",
+		Keys:   []Key{{"one", 1}},
+	}, result(context.Background(), Key{"one", 1}))
+	assert.Equal(t, &Entry{
+		Error: ErrEntryNotFound,
+		Keys:  []Key{{"one", 3}},
+	}, result(context.Background(), Key{"one", 3}))
+}
+
+func TestIndexGrewBase(t *testing.T) {
+	obj := index{
+		entries: map[interface{}]*entry{
+			1: {},
+			2: {},
+		},
+		growth: &IndexGrowth{
+			Peak:             1,
+			PeakSinceRealloc: 1,
+		},
+	}
+
+	obj.grew()
+
+	assert.Equal(t, &IndexGrowth{
+		Peak:             2,
+		PeakSinceRealloc: 2,
+	}, obj.growth)
+}
+
+func TestIndexGrewSmaller(t *testing.T) {
+	obj := index{
+		entries: map[interface{}]*entry{
+			1: {},
+		},
+		growth: &IndexGrowth{
+			Peak:             5,
+			PeakSinceRealloc: 3,
+		},
+	}
+
+	obj.grew()
+
+	assert.Equal(t, &IndexGrowth{
+		Peak:             5,
+		PeakSinceRealloc: 3,
+	}, obj.growth)
+}
+
+func TestIndexGrewUntracked(t *testing.T) {
+	obj := index{
+		entries: map[interface{}]*entry{
+			1: {},
+		},
+	}
+
+	obj.grew()
+
+	assert.Nil(t, obj.growth)
+}
+
+func TestIndexDefaultFutureBase(t *testing.T) {
+	fc := &FCache{}
+	obj := index{
+		defObject: "default",
+	}
+
+	result, err := obj.defaultFuture(fc, Key{"one", 1})
+
+	assert.NoError(t, err)
+	assert.Same(t, fc, result.fc)
+	assert.Equal(t, &Entry{
+		Object: "default",
+		Keys:   []Key{{"one", 1}},
+	}, result.ent.content)
+}
+
+func TestIndexDefaultFutureNoDefault(t *testing.T) {
+	obj := index{}
+
+	result, err := obj.defaultFuture(&FCache{}, Key{"one", 1})
+
+	assert.Same(t, ErrNotCached, err)
+	assert.Nil(t, result)
+}
+
 func TestNewEntry(t *testing.T) {
 	ent, ctx := newEntry()
 
@@ -78,6 +320,37 @@ func TestEntryMakeFutureIncompleteMakeReqs(t *testing.T) {
 	assert.NotNil(t, result.result)
 }
 
+func TestEntryMakeFutureShared(t *testing.T) {
+	fc := &FCache{
+		sharedNotify: true,
+	}
+	obj := &entry{}
+
+	result1 := obj.makeFuture(fc)
+	result2 := obj.makeFuture(fc)
+
+	assert.NotNil(t, obj.done)
+	assert.True(t, obj.shared)
+	assert.Nil(t, obj.reqs)
+	assert.Equal(t, &Future{
+		fc:   fc,
+		ent:  obj,
+		done: obj.done,
+	}, result1)
+	assert.Equal(t, result1, result2)
+}
+
+func TestSortedCookies(t *testing.T) {
+	reqs := map[uint64]chan<- Entry{}
+	for _, cookie := range []uint64{42, 7, 19, 3, 100} {
+		reqs[cookie] = make(chan Entry, 1)
+	}
+
+	result := sortedCookies(reqs)
+
+	assert.Equal(t, []uint64{3, 7, 19, 42, 100}, result)
+}
+
 func TestEntryCompleteBase(t *testing.T) {
 	ent := &Entry{}
 	obj := &entry{}
@@ -174,6 +447,65 @@ func TestEntryCompleteFulfillRequests(t *testing.T) {
 	}
 }
 
+func TestEntryCompleteUndrainedRequest(t *testing.T) {
+	full := make(chan Entry, 1)
+	full <- Entry{Object: "stale"}
+	unbuffered := make(chan Entry)
+	obj := &entry{
+		reqs: map[uint64]chan<- Entry{
+			1: full,
+			2: unbuffered,
+		},
+	}
+
+	result := obj.complete(&Entry{
+		Object: "object",
+	})
+
+	assert.False(t, result)
+	assert.Nil(t, obj.reqs)
+	assert.Equal(t, Entry{Object: "stale"}, <-full)
+	_, ok := <-full
+	assert.False(t, ok)
+	_, ok = <-unbuffered
+	assert.False(t, ok)
+}
+
+func TestEntryCompleteShared(t *testing.T) {
+	done := make(chan struct{})
+	obj := &entry{
+		done: done,
+	}
+
+	obj.complete(&Entry{
+		Object: "object",
+	})
+
+	select {
+	case <-done:
+	default:
+		t.Error("done channel not closed")
+	}
+}
+
+func TestEntryCompleteCallbacks(t *testing.T) {
+	called := make(chan Entry, 2)
+	obj := &entry{
+		onDone: []func(Entry){
+			func(ent Entry) { called <- ent },
+			func(ent Entry) { called <- ent },
+		},
+	}
+
+	obj.complete(&Entry{
+		Object: "object",
+	})
+
+	assert.Nil(t, obj.onDone)
+	assert.Equal(t, Entry{Object: "object"}, <-called)
+	assert.Equal(t, Entry{Object: "object"}, <-called)
+}
+
 func TestEntryCompleteCompleted(t *testing.T) {
 	ent := &Entry{}
 	obj := &entry{
@@ -192,3 +524,475 @@ func TestEntryCompleteCompleted(t *testing.T) {
 	assert.Nil(t, obj.cancel)
 	assert.Nil(t, obj.reqs)
 }
+
+func BenchmarkEntryMakeFuture(b *testing.B) {
+	fc := &FCache{}
+	obj := &entry{}
+
+	for i := 0; i < b.N; i++ {
+		obj.makeFuture(fc)
+	}
+}
+
+func BenchmarkEntryMakeFutureShared(b *testing.B) {
+	fc := &FCache{
+		sharedNotify: true,
+	}
+	obj := &entry{}
+
+	for i := 0; i < b.N; i++ {
+		obj.makeFuture(fc)
+	}
+}
+
+func TestIndexCompletePending(t *testing.T) {
+	called := make(chan Entry, 1)
+	idx := index{
+		onComplete: func(ent Entry) { called <- ent },
+	}
+	e := &entry{}
+	content := &Entry{
+		Error: assert.AnError,
+	}
+
+	result := idx.complete(e, content)
+
+	assert.True(t, result)
+	assert.Same(t, content, e.content)
+	assert.Equal(t, *content, <-called)
+}
+
+func TestIndexCompleteCompleted(t *testing.T) {
+	idx := index{
+		onComplete: func(ent Entry) { t.Fail() },
+	}
+	e := &entry{
+		content: &Entry{
+			Object: "object",
+		},
+	}
+
+	result := idx.complete(e, &Entry{
+		Object: "other",
+	})
+
+	assert.False(t, result)
+	assert.Equal(t, "object", e.content.Object)
+}
+
+func TestIndexCompleteNoCallback(t *testing.T) {
+	idx := index{}
+	e := &entry{}
+
+	result := idx.complete(e, &Entry{
+		Object: "object",
+	})
+
+	assert.False(t, result)
+	assert.Equal(t, "object", e.content.Object)
+}
+
+func TestIndexEvicted(t *testing.T) {
+	called := make(chan Entry, 1)
+	idx := index{
+		onEvict: func(ent Entry) { called <- ent },
+	}
+
+	idx.evicted(&Entry{
+		Object: "object",
+	})
+
+	assert.Equal(t, Entry{Object: "object"}, <-called)
+}
+
+func TestIndexEvictedEntryCallback(t *testing.T) {
+	called := make(chan bool, 2)
+	content := &Entry{
+		Object:  "object",
+		OnEvict: func() { called <- true },
+	}
+	idx := index{}
+
+	idx.evicted(content)
+	idx.evicted(content)
+
+	assert.True(t, <-called)
+	assert.True(t, content.evicted)
+	assert.Len(t, called, 0)
+}
+
+func TestIndexEvictedNoCallback(t *testing.T) {
+	idx := index{}
+
+	idx.evicted(&Entry{
+		Object: "object",
+	})
+}
+
+func TestEntryCompleteCounter(t *testing.T) {
+	pending := 1
+	obj := &entry{
+		counter: &pending,
+	}
+
+	obj.complete(&Entry{
+		Object: "object",
+	})
+
+	assert.Equal(t, 0, pending)
+	assert.Nil(t, obj.counter)
+}
+
+func TestIndexOverrideBase(t *testing.T) {
+	idx := index{}
+
+	result := idx.override(factory)
+
+	assert.Nil(t, result(context.Background(), Key{"one", 1}))
+}
+
+func TestIndexOverrideSerial(t *testing.T) {
+	idx := index{
+		serial: make(chan struct{}, 1),
+	}
+	idx.serial <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := idx.override(factory)
+
+	assert.Equal(t, &Entry{
+		Error: context.Canceled,
+		Keys:  []Key{{"one", 1}},
+	}, result(ctx, Key{"one", 1}))
+}
+
+func TestIndexOverrideMulti(t *testing.T) {
+	idx := index{
+		multi: true,
+	}
+
+	result := idx.override(func(ctx context.Context, key Key) *Entry {
+		return &Entry{
+			Object: []interface{}{"a", "b"},
+		}
+	})
+
+	assert.Equal(t, &Entry{
+		Object: []interface{}{"a", "b"},
+		Keys:   []Key{{"one", 1}},
+		multi:  true,
+	}, result(context.Background(), Key{"one", 1}))
+}
+
+func TestMultiFactoryBase(t *testing.T) {
+	result := multiFactory(func(ctx context.Context, key Key) []*Entry {
+		return []*Entry{
+			{Object: "a", Keys: []Key{{"two", 1}}},
+			nil,
+			{Object: "b", Keys: []Key{{"two", 2}}},
+		}
+	})
+
+	assert.Equal(t, &Entry{
+		Object: []interface{}{"a", "b"},
+		Keys:   []Key{{"one", 1}},
+		multi:  true,
+	}, result(context.Background(), Key{"one", 1}))
+}
+
+func TestMultiFactoryEmpty(t *testing.T) {
+	result := multiFactory(func(ctx context.Context, key Key) []*Entry {
+		return nil
+	})
+
+	assert.Equal(t, &Entry{
+		Object: []interface{}{},
+		Keys:   []Key{{"one", 1}},
+		multi:  true,
+	}, result(context.Background(), Key{"one", 1}))
+}
+
+func TestMultiFactoryError(t *testing.T) {
+	result := multiFactory(func(ctx context.Context, key Key) []*Entry {
+		return []*Entry{
+			{Object: "a", Keys: []Key{{"two", 1}}},
+			{Error: assert.AnError, Keys: []Key{{"two", 2}}},
+		}
+	})
+
+	assert.Equal(t, &Entry{
+		Error: assert.AnError,
+		Keys:  []Key{{"one", 1}},
+		multi: true,
+	}, result(context.Background(), Key{"one", 1}))
+}
+
+func TestMarkMultiNil(t *testing.T) {
+	result := markMulti(factory)
+
+	assert.Nil(t, result(context.Background(), Key{"one", 1}))
+}
+
+func TestPostProcessBase(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}
+
+	result := postProcess(func(key Key, ent *Entry) (*Entry, error) {
+		assert.Equal(t, Key{"one", 1}, key)
+		return &Entry{
+			Object: "rewritten",
+			Keys:   ent.Keys,
+		}, nil
+	}, Key{"one", 1}, ent)
+
+	assert.Equal(t, &Entry{
+		Object: "rewritten",
+		Keys:   []Key{{"one", 1}},
+	}, result)
+}
+
+func TestPostProcessError(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}, {"two", 2}},
+	}
+
+	result := postProcess(func(key Key, ent *Entry) (*Entry, error) {
+		return nil, assert.AnError
+	}, Key{"one", 1}, ent)
+
+	assert.Equal(t, &Entry{
+		Error: assert.AnError,
+		Keys:  []Key{{"one", 1}, {"two", 2}},
+	}, result)
+}
+
+func TestPostProcessNil(t *testing.T) {
+	result := postProcess(func(key Key, ent *Entry) (*Entry, error) {
+		t.Fail()
+		return nil, nil
+	}, Key{"one", 1}, nil)
+
+	assert.Nil(t, result)
+}
+
+func TestPostFactoryBase(t *testing.T) {
+	result := postFactory(func(ctx context.Context, key Key) *Entry {
+		return &Entry{
+			Object: "object",
+			Keys:   []Key{key},
+		}
+	}, func(key Key, ent *Entry) (*Entry, error) {
+		return nil, &PermanentError{assert.AnError}
+	})
+
+	assert.Equal(t, &Entry{
+		Error: &PermanentError{assert.AnError},
+		Keys:  []Key{{"one", 1}},
+	}, result(context.Background(), Key{"one", 1}))
+}
+
+func TestPostFactoryNoPost(t *testing.T) {
+	result := postFactory(factory, nil)
+
+	assert.Nil(t, result(context.Background(), Key{"one", 1}))
+}
+
+func TestPostFactoryNoFactory(t *testing.T) {
+	result := postFactory(nil, func(key Key, ent *Entry) (*Entry, error) {
+		return ent, nil
+	})
+
+	assert.Nil(t, result)
+}
+
+func TestPostGroupFactoryBase(t *testing.T) {
+	result := postGroupFactory(func(ctx context.Context, key Key) []*Entry {
+		return []*Entry{
+			{
+				Object: "o1",
+				Keys:   []Key{{"one", 1}},
+			},
+			{
+				Object: "o2",
+				Keys:   []Key{{"one", 2}},
+			},
+		}
+	}, func(key Key, ent *Entry) (*Entry, error) {
+		if ent.Object == "o2" {
+			return nil, assert.AnError
+		}
+		return ent, nil
+	})
+
+	assert.Equal(t, []*Entry{
+		{
+			Object: "o1",
+			Keys:   []Key{{"one", 1}},
+		},
+		{
+			Error: assert.AnError,
+			Keys:  []Key{{"one", 2}},
+		},
+	}, result(context.Background(), Key{"one", 1}))
+}
+
+func TestPostGroupFactoryNoPost(t *testing.T) {
+	result := postGroupFactory(nil, nil)
+
+	assert.Nil(t, result)
+}
+
+func TestWriteProcessBase(t *testing.T) {
+	var written Entry
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}
+
+	result := writeProcess(context.Background(), func(ctx context.Context, ent Entry) error {
+		written = ent
+		return nil
+	}, ent)
+
+	assert.Same(t, ent, result)
+	assert.Equal(t, *ent, written)
+}
+
+func TestWriteProcessError(t *testing.T) {
+	result := writeProcess(context.Background(), func(ctx context.Context, ent Entry) error {
+		return assert.AnError
+	}, &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	})
+
+	assert.Equal(t, &Entry{
+		Error: assert.AnError,
+		Keys:  []Key{{"one", 1}},
+	}, result)
+}
+
+func TestWriteProcessEntryError(t *testing.T) {
+	ent := &Entry{
+		Error: assert.AnError,
+		Keys:  []Key{{"one", 1}},
+	}
+
+	result := writeProcess(context.Background(), func(ctx context.Context, ent Entry) error {
+		panic("write called")
+	}, ent)
+
+	assert.Same(t, ent, result)
+}
+
+func TestWriteProcessNotFound(t *testing.T) {
+	ent := &Entry{
+		Keys:     []Key{{"one", 1}},
+		NotFound: true,
+	}
+
+	result := writeProcess(context.Background(), func(ctx context.Context, ent Entry) error {
+		panic("write called")
+	}, ent)
+
+	assert.Same(t, ent, result)
+}
+
+func TestWriteProcessNil(t *testing.T) {
+	result := writeProcess(context.Background(), func(ctx context.Context, ent Entry) error {
+		panic("write called")
+	}, nil)
+
+	assert.Nil(t, result)
+}
+
+func TestWriteFactoryBase(t *testing.T) {
+	result := writeFactory(func(ctx context.Context, key Key) *Entry {
+		return &Entry{
+			Object: "object",
+			Keys:   []Key{key},
+		}
+	}, func(ctx context.Context, ent Entry) error {
+		return &PermanentError{assert.AnError}
+	})
+
+	assert.Equal(t, &Entry{
+		Error: &PermanentError{assert.AnError},
+		Keys:  []Key{{"one", 1}},
+	}, result(context.Background(), Key{"one", 1}))
+}
+
+func TestWriteFactoryNoWrite(t *testing.T) {
+	result := writeFactory(factory, nil)
+
+	assert.Nil(t, result(context.Background(), Key{"one", 1}))
+}
+
+func TestWriteFactoryNoFactory(t *testing.T) {
+	result := writeFactory(nil, func(ctx context.Context, ent Entry) error {
+		return nil
+	})
+
+	assert.Nil(t, result)
+}
+
+func TestWriteGroupFactoryBase(t *testing.T) {
+	result := writeGroupFactory(func(ctx context.Context, key Key) []*Entry {
+		return []*Entry{
+			{
+				Object: "o1",
+				Keys:   []Key{{"one", 1}},
+			},
+			{
+				Object: "o2",
+				Keys:   []Key{{"one", 2}},
+			},
+		}
+	}, func(ctx context.Context, ent Entry) error {
+		if ent.Object == "o2" {
+			return assert.AnError
+		}
+		return nil
+	})
+
+	assert.Equal(t, []*Entry{
+		{
+			Object: "o1",
+			Keys:   []Key{{"one", 1}},
+		},
+		{
+			Error: assert.AnError,
+			Keys:  []Key{{"one", 2}},
+		},
+	}, result(context.Background(), Key{"one", 1}))
+}
+
+func TestWriteGroupFactoryNoWrite(t *testing.T) {
+	result := writeGroupFactory(nil, nil)
+
+	assert.Nil(t, result)
+}
+
+func TestIndexHashBase(t *testing.T) {
+	idx := index{}
+
+	result := idx.hash(1)
+
+	assert.Equal(t, 1, result)
+}
+
+func TestIndexHashHasher(t *testing.T) {
+	idx := index{
+		hasher: func(key interface{}) interface{} {
+			return fmt.Sprint(key)
+		},
+	}
+
+	result := idx.hash([]int{1, 2})
+
+	assert.Equal(t, "[1 2]", result)
+}
@@ -14,102 +14,457 @@
 
 package fcache
 
-import "context"
+import (
+	"context"
+	"reflect"
+	"time"
+)
 
 // manufacture calls the index factory function.  It MUST be called as
 // a goroutine.  It will invoke the factory, then lock the mutex and
 // complete the appropriate entry or entries in the cache.
 func (fc *FCache) manufacture(ctx context.Context, key Key, factory Factory) {
 	// Invoke the factory
+	run := fc.startFactory(key)
 	ent := factory(ctx, key)
+	if ent == nil {
+		ent = &Entry{
+			Error: ErrFactoryNil,
+			Keys:  []Key{key},
+		}
+	}
 
 	// Lock the cache
 	fc.Lock()
 	defer fc.Unlock()
+	fc.endFactory(run)
+
+	// Make sure the entry can complete the triggering key
+	if !fc.matches(ent) {
+		ent = &Entry{
+			Error: ErrNoMatchingIndex,
+			Keys:  []Key{key},
+		}
+	}
 
 	// Insert the object into the appropriate indexes
 	fc.insert(ent)
 }
 
+// manufactureGroup calls the index group factory function.  It MUST
+// be called as a goroutine.  It will invoke the group factory, then
+// lock the mutex and complete the appropriate entries in the cache.
+// Any entries in the group not provided by the group factory are
+// completed with ErrEntryNotFound.
+func (fc *FCache) manufactureGroup(ctx context.Context, key Key, gk interface{}, g *group, factory GroupFactory) {
+	// Invoke the factory
+	run := fc.startFactory(key)
+	ents := factory(ctx, key)
+
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+	fc.endFactory(run)
+
+	// Insert the objects into the appropriate indexes
+	for _, ent := range ents {
+		if ent != nil {
+			fc.insert(ent)
+		}
+	}
+
+	// The group is no longer pending
+	idx, ok := fc.indexes[key.Index]
+	if !ok {
+		return
+	}
+	if idx.groups[gk] == g {
+		delete(idx.groups, gk)
+	}
+
+	// Complete any entries that were not provided
+	for _, k := range g.keys {
+		hk := idx.hash(k.Key)
+		if e, ok := idx.entries[hk]; ok && e.content == nil {
+			idx.complete(e, &Entry{
+				Error: ErrEntryNotFound,
+				Keys:  []Key{k},
+			})
+			delete(idx.entries, hk)
+		}
+	}
+}
+
+// checkKeys checks a list of keys to ensure that no index is listed
+// with more than one key.  Returns ErrConflictingKeys if an index is
+// listed with different keys.
+func checkKeys(keys []Key) error {
+	seen := map[interface{}]interface{}{}
+	for _, k := range keys {
+		if key, ok := seen[k.Index]; ok && !reflect.DeepEqual(key, k.Key) {
+			return ErrConflictingKeys
+		}
+		seen[k.Index] = k.Key
+	}
+
+	return nil
+}
+
+// insertOverwrite is similar to insert, but completed entries cached
+// under the keys of the content are replaced, rather than kept.  Each
+// replaced entry is evicted from all its indexes, as Reindex does with
+// squatters, so that it is not left reachable under only some of its
+// keys.  Content that would not be cached, including content with
+// conflicting keys in strict mode, replaces nothing.  The cache MUST
+// be locked upon entry to this method.
+func (fc *FCache) insertOverwrite(ent *Entry) *entry {
+	ent.checkNotFound()
+	if isCacheable(ent.Error) && (!fc.strict || checkKeys(ent.Keys) == nil) {
+		for _, k := range ent.Keys {
+			idx, ok := fc.indexes[k.Index]
+			if !ok || idx.multi != ent.multi {
+				continue
+			}
+
+			if e, ok := idx.entries[idx.hash(k.Key)]; ok && e.content != nil && e.content != ent {
+				fc.evict(e.content.Keys)
+				fc.stats.ImplicitEvictions++
+			}
+		}
+	}
+
+	return fc.insert(ent)
+}
+
+// matches checks whether any of the keys of the entry reference an
+// index of the cache into which the entry may be inserted.  The cache
+// MUST be locked upon entry to this method.
+func (fc *FCache) matches(ent *Entry) bool {
+	for _, k := range ent.Keys {
+		if idx, ok := fc.indexes[k.Index]; ok && idx.multi == ent.multi {
+			return true
+		}
+	}
+
+	return false
+}
+
 // insert inserts the entry into the cache, constructing index entries
 // as required.  The cache MUST be locked upon entry to this method.
 func (fc *FCache) insert(ent *Entry) *entry {
+	// Reject conflicting keys in strict mode
+	if fc.strict {
+		if err := checkKeys(ent.Keys); err != nil {
+			ent = &Entry{
+				Error: err,
+				Keys:  ent.Keys,
+			}
+		}
+	}
+
+	// Cache the absence of the object
+	ent.checkNotFound()
+
 	// Pre-create the entry, if appropriate
 	var newE *entry
-	if ent.Error == nil || IsPermanent(ent.Error) {
+	if isCacheable(ent.Error) {
+		ent.CreatedAt = now()
+		ent.Version = fc.nextVersion()
 		newE = &entry{
 			content: ent,
 		}
 	}
 
 	// Walk through the keys
+	stored := false
 	for _, k := range ent.Keys {
-		// Skip indexes we don't know about
+		// Skip indexes we don't know about; only sets are
+		// stored in multi-value indexes
 		idx, ok := fc.indexes[k.Index]
-		if !ok {
+		if !ok || idx.multi != ent.multi {
 			continue
 		}
 
 		// Complete the entry
-		if e, ok := idx.entries[k.Key]; ok {
-			if e.complete(ent) {
-				delete(idx.entries, k.Key)
+		hk := idx.hash(k.Key)
+		if e, ok := idx.entries[hk]; ok {
+			if idx.complete(e, ent) {
+				delete(idx.entries, hk)
+			} else if e.content == ent {
+				stored = true
 			}
 		} else if newE != nil {
-			idx.entries[k.Key] = newE
+			idx.entries[hk] = newE
+			idx.grew()
+			stored = true
+		}
+
+		// Notify anyone waiting for the key
+		if newE != nil {
+			idx.notify(hk, ent)
 		}
 	}
 
+	// Record the tags, if the entry was stored under any key, and
+	// wake up anyone waiting for the cache to grow
+	if stored {
+		fc.tag(ent)
+	}
+	if newE != nil {
+		fc.signal()
+	}
+
 	return newE
 }
 
+// stored returns a Future for an entry passed with ByEntry, given the
+// index entry returned by inserting it.  Entries with errors that may
+// not be cached are not inserted, so the Future is completed with the
+// passed entry instead.
+func (fc *FCache) stored(e *entry, ent *Entry) *Future {
+	if e == nil {
+		e = &entry{
+			content: ent,
+		}
+	}
+
+	return e.makeFuture(fc)
+}
+
+// newFactoryEntry constructs a new index entry for a lookup that will
+// invoke a factory.  If the BoundFactory option was provided and the
+// lookup context has a deadline, the context returned for the factory
+// will also be bounded by that deadline.  If the DeriveFactoryContext
+// option was provided, the context returned for the factory is
+// derived from the lookup context.
+func newFactoryEntry(o lookupOptions) (*entry, context.Context) {
+	var ent *entry
+	var ctx context.Context
+	if o.derive {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(o.ctx)
+		ent = &entry{
+			cancel: cancel,
+		}
+	} else {
+		ent, ctx = newEntry()
+	}
+
+	// Apply the lookup deadline to the factory
+	if o.bound {
+		if deadline, ok := o.ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			parent := ent.cancel
+			ent.cancel = func() {
+				cancel()
+				parent()
+			}
+		}
+	}
+
+	return ent, ctx
+}
+
 // lookup looks up an entry in the cache and returns a Future.  The
 // Lookup and LookupFuture methods use lookup to perform the actual
-// lookup.
+// lookup.  If the factory function needed to fill a miss or refresh
+// an entry is missing, ErrMissingFactory is returned; stale entries
+// without a factory are simply not refreshed.
 func (fc *FCache) lookup(o lookupOptions) (*Future, error) {
 	// Lock the cache
 	fc.Lock()
 	defer fc.Unlock()
 
-	// Look for the index
+	// Look for the index, constructing it if needed; read-only
+	// lookups never construct indexes
 	idx, ok := fc.indexes[o.key.Index]
 	if !ok {
-		return nil, ErrBadIndex
+		if o.readOnly {
+			return nil, ErrBadIndex
+		}
+
+		var err error
+		if idx, err = fc.findIndex(o.key.Index); err != nil {
+			return nil, err
+		}
+	}
+
+	// Entries may not be passed for multi-value indexes
+	if o.ent != nil && idx.multi {
+		return nil, ErrMultiValue
+	}
+
+	// Reject conflicting keys in strict mode
+	if o.ent != nil && fc.strict {
+		if err := checkKeys(o.ent.Keys); err != nil {
+			return nil, err
+		}
+	}
+
+	// Find an existing entry, constructing it if needed; expired
+	// retryable errors are treated as a miss, and are evicted
+	// unless the lookup is read-only
+	hk := idx.hash(o.key.Key)
+	ent, ok := idx.entries[hk]
+	if ok && ent.content != nil && isExpired(ent.content.Error) {
+		if !o.readOnly {
+			fc.evict(ent.content.Keys)
+			fc.stats.ImplicitEvictions++
+		}
+		ent, ok = nil, false
+	}
+
+	// Check the expected version and object of an entry to store
+	if o.ent != nil {
+		if err := checkExpected(o, ent); err != nil {
+			return nil, err
+		}
 	}
 
-	// Find an existing entry, constructing it if needed
-	ent, ok := idx.entries[o.key.Key]
 	if !ok {
 		// Not present; insert entry if one was passed
 		if o.ent != nil {
-			e := fc.insert(o.ent)
-			return e.makeFuture(fc), nil
+			fc.stats.Misses++
+			return fc.stored(fc.insert(o.ent), o.ent), nil
 		}
 
-		// Only searching the cache?
-		if o.only {
-			return nil, ErrNotCached
+		// Only searching the cache, or factories paused?
+		if o.only || fc.paused {
+			fc.stats.SearchMisses++
+			return idx.defaultFuture(fc, *o.key)
+		}
+		fc.stats.Misses++
+
+		// Select the factory to use
+		factory := idx.factory
+		if o.factory != nil {
+			factory = idx.override(o.factory)
+		} else if idx.groupKey != nil && idx.groupFactory != nil {
+			// Join a pending group, if there is one
+			return fc.lookupGroup(idx, o)
+		}
+		if factory == nil {
+			return nil, ErrMissingFactory
+		}
+		if o.sem != nil {
+			factory = limitFactory(factory, o.sem)
 		}
 
 		// Construct a new entry
 		var ctx context.Context
-		ent, ctx = newEntry()
-		idx.entries[o.key.Key] = ent
+		ent, ctx = newFactoryEntry(o)
+		if err := fc.addPending(ent, *o.key); err != nil {
+			ent.cancel()
+			return nil, err
+		}
+		idx.entries[hk] = ent
+		idx.grew()
+		if fc.autoCancel && !o.warm {
+			key := *o.key
+			ent.auto = &key
+		}
 
 		// Manufacture the entry
-		go fc.manufacture(ctx, *o.key, idx.factory)
+		go fc.manufacture(ctx, *o.key, factory)
+	} else if ent.content != nil || !o.only {
+		fc.stats.Hits++
+		ent.hits++
+	}
+
+	// Replace the entry if requested
+	if o.ent != nil && o.overwrite {
+		// Pending entries are completed by the insert
+		if ent.content != nil {
+			fc.evict(ent.content.Keys)
+			fc.stats.ImplicitEvictions++
+			ent = fc.insertOverwrite(o.ent)
+		} else {
+			fc.insertOverwrite(o.ent)
+		}
+
+		return fc.stored(ent, o.ent), nil
 	}
 
 	// If the entry is incomplete and we're only searching the
 	// cache, stop here
 	if ent.content == nil && o.only {
-		return nil, ErrNotCached
+		fc.stats.SearchMisses++
+		return idx.defaultFuture(fc, *o.key)
+	}
+
+	// Refresh completed entries if requested or if too old
+	if (o.force || o.tooOld(ent.content)) && ent.content != nil && !o.only && !fc.paused {
+		factory := idx.refreshFactory()
+		if o.factory != nil {
+			factory = idx.override(o.factory)
+		}
+		if factory == nil {
+			return nil, ErrMissingFactory
+		}
+		if next := fc.startRefresh(ent, *o.key, factory); next != nil {
+			return next.makeFuture(fc), nil
+		}
+	}
+
+	// Refresh stale entries in the background
+	if ent.stale && !o.only && !fc.paused {
+		factory := idx.refreshFactory()
+		if o.factory != nil {
+			factory = idx.override(o.factory)
+		}
+		if factory != nil {
+			fc.startRefresh(ent, *o.key, factory)
+		}
 	}
 
 	// Construct and return a future
 	return ent.makeFuture(fc), nil
 }
 
+// lookupGroup handles a miss in an index with a group key.  If a
+// group factory call is already pending for the key's group, a
+// pending entry is added to the group; otherwise, a new group is
+// constructed and the group factory invoked.  The cache MUST be
+// locked upon entry to this method.
+func (fc *FCache) lookupGroup(idx index, o lookupOptions) (*Future, error) {
+	// Join an existing group
+	key := *o.key
+	gk := idx.groupKey(key)
+	if g, ok := idx.groups[gk]; ok {
+		ent := &entry{}
+		if err := fc.addPending(ent, key); err != nil {
+			return nil, err
+		}
+		idx.entries[idx.hash(key.Key)] = ent
+		idx.grew()
+		g.keys = append(g.keys, key)
+		return ent.makeFuture(fc), nil
+	}
+
+	// Construct a new entry and group
+	ent, ctx := newFactoryEntry(o)
+	if err := fc.addPending(ent, key); err != nil {
+		ent.cancel()
+		return nil, err
+	}
+	idx.entries[idx.hash(key.Key)] = ent
+	idx.grew()
+	g := &group{
+		keys: []Key{key},
+	}
+	idx.groups[gk] = g
+
+	// Manufacture the group
+	factory := idx.groupFactory
+	if o.sem != nil {
+		factory = limitGroupFactory(factory, o.sem)
+	}
+	go fc.manufactureGroup(ctx, key, gk, g, factory)
+
+	return ent.makeFuture(fc), nil
+}
+
 // Lookup looks up an entry in the cache and returns it.  The options
 // specify which entry to look up.  If necessary, the index factory
 // function will be invoked to construct the entry.  This method waits
@@ -121,6 +476,8 @@ func (fc *FCache) Lookup(opts ...LookupOption) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	cancel := o.applyTimeout()
+	defer cancel()
 
 	// Perform the lookup
 	f, err := fc.lookup(o)
@@ -128,9 +485,14 @@ func (fc *FCache) Lookup(opts ...LookupOption) (interface{}, error) {
 		return nil, err
 	}
 
-	// Wait on the future
-	defer f.Cancel()
-	return f.WaitWithContext(o.ctx)
+	// Wait on the future; with KeepWarming, a canceled wait leaves
+	// the future waiting on the entry
+	obj, err := f.WaitWithContext(o.ctx)
+	if !o.keepWarm || o.ctx.Err() == nil {
+		f.Cancel()
+	}
+
+	return obj, err
 }
 
 // LookupFuture looks up an entry in the cache and returns a Future,
@@ -148,3 +510,124 @@ func (fc *FCache) LookupFuture(opts ...LookupOption) (*Future, error) {
 	// Perform the lookup and return the future
 	return fc.lookup(o)
 }
+
+// LookupFresh is similar to Lookup, but only returns a cached object
+// if it was cached less than maxAge ago.  Older entries are refreshed,
+// as with the ForceRefresh option, and LookupFresh waits for the
+// refreshed entry; this gives each caller control over the freshness
+// of the object, independent of any refresh configured for the index.
+// As with ForceRefresh, the index's RefreshInterval is honored, in
+// which case the cached object is returned, and no refresh is
+// performed if SearchCache is also provided or if factory calls are
+// paused.
+func (fc *FCache) LookupFresh(maxAge time.Duration, opts ...LookupOption) (interface{}, error) {
+	return fc.Lookup(append(opts[:len(opts):len(opts)], maxAgeOption(maxAge))...)
+}
+
+// LookupWithFuture is similar to Lookup, but also returns the Future
+// that was waited on.  Unlike Lookup, the Future is not canceled, so
+// it may be used later; once resolved, waiting on it again returns
+// the same result.  If the lookup itself fails, the returned Future
+// is nil.
+func (fc *FCache) LookupWithFuture(opts ...LookupOption) (*Future, interface{}, error) {
+	// Process the options
+	o, err := procLookupOpts(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	cancel := o.applyTimeout()
+	defer cancel()
+
+	// Perform the lookup
+	f, err := fc.lookup(o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Wait on the future
+	obj, err := f.WaitWithContext(o.ctx)
+	return f, obj, err
+}
+
+// LookupAny looks up an object that may be identified by any of
+// several keys.  Each key is checked in order, and the first one
+// found to be cached is returned without invoking any factory
+// function.  If none of the keys are cached, the lookup is performed
+// using the first key, invoking its index factory function as
+// necessary.  Keys referencing indexes that do not exist are treated
+// as misses while scanning, so that indexes constructed on demand
+// with the LazyIndexes option may be used; the lookup of the first
+// key returns ErrBadIndex if its index cannot be found or constructed.
+func (fc *FCache) LookupAny(keys ...Key) (interface{}, error) {
+	// Make sure we have at least one key
+	if len(keys) < 1 {
+		return nil, ErrNoKey
+	}
+
+	// Scan the cache for an existing entry
+	if ent, ok := fc.lookupAny(keys); ok {
+		return ent.Object, ent.Error
+	}
+
+	// Not cached; look up the first key
+	return fc.Lookup(ByKey(keys[0]))
+}
+
+// lookupAny is a helper for LookupAny that scans the cache for the
+// first of the specified keys with a completed entry, counting a hit
+// for it as lookup does.  Keys referencing indexes that do not exist,
+// and expired retryable errors, are treated as misses.  Returns the
+// entry and a boolean true value if one was found.
+func (fc *FCache) lookupAny(keys []Key) (Entry, bool) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	for _, k := range keys {
+		idx, ok := fc.indexes[k.Index]
+		if !ok {
+			continue
+		}
+
+		ent, ok := idx.entries[idx.hash(k.Key)]
+		if ok && ent.content != nil && !isExpired(ent.content.Error) {
+			fc.stats.Hits++
+			ent.hits++
+			return *ent.content, true
+		}
+	}
+
+	return Entry{}, false
+}
+
+// Inspect looks up a completed entry in the cache and returns a copy
+// of it, including its error, keys, and creation time.  The options
+// specify which entry to inspect.  The index factory function is
+// never invoked; if the entry is not present, is still pending, or is
+// a retryable error that has expired, ErrNotCached is returned.
+func (fc *FCache) Inspect(opts ...LookupOption) (Entry, error) {
+	// Process the options
+	o, err := procLookupOpts(opts)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[o.key.Index]
+	if !ok {
+		return Entry{}, ErrBadIndex
+	}
+
+	// Check to see if there's a completed entry; expired retryable
+	// errors are treated as a miss
+	ent, ok := idx.entries[idx.hash(o.key.Key)]
+	if !ok || ent.content == nil || isExpired(ent.content.Error) {
+		return Entry{}, ErrNotCached
+	}
+
+	return ent.content.Clone(), nil
+}
@@ -16,9 +16,14 @@ package fcache
 
 import (
 	"context"
+	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/klmitch/patcher"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFCacheManufacture(t *testing.T) {
@@ -82,125 +87,156 @@ func TestFCacheManufacture(t *testing.T) {
 	assert.True(t, factoryCalled)
 }
 
-func TestFCacheInsertBase(t *testing.T) {
-	ent := &Entry{
-		Object: "object",
-		Keys: []Key{
-			{"one", 1},
-			{"two", 2},
-			{"three", 3},
-			{"four", 4},
-			{"five", 5},
-		},
-	}
+func TestFCacheManufactureNil(t *testing.T) {
+	key := Key{"one", 1}
+	pending := &entry{}
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{
-					1: {},
+					1: pending,
 				},
 			},
-			"two": {
-				entries: map[interface{}]*entry{},
-			},
-			"three": {
+		},
+	}
+
+	obj.manufacture(context.Background(), key, factory)
+
+	assert.Len(t, obj.indexes["one"].entries, 0)
+	assert.Equal(t, &Entry{
+		Error: ErrFactoryNil,
+		Keys:  []Key{key},
+	}, pending.content)
+}
+
+func TestFCacheManufactureNoMatchingIndex(t *testing.T) {
+	key := Key{"one", 1}
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
 				entries: map[interface{}]*entry{
-					3: {},
+					1: pending,
 				},
 			},
-			"five": {
-				entries: map[interface{}]*entry{},
-			},
 		},
 	}
 
-	result := obj.insert(ent)
+	obj.manufacture(context.Background(), key, func(ctx context.Context, key Key) *Entry {
+		return &Entry{
+			Object: "object",
+			Keys:   []Key{{"other", 1}},
+		}
+	})
 
-	assert.Equal(t, &entry{
-		content: ent,
-	}, result)
-	assert.Equal(t, &FCache{
+	assert.Len(t, obj.indexes["one"].entries, 0)
+	assert.Equal(t, &Entry{
+		Error: ErrNoMatchingIndex,
+		Keys:  []Key{key},
+	}, pending.content)
+}
+
+func TestFCacheInsertOverwriteBase(t *testing.T) {
+	squatter := &entry{
+		content: &Entry{
+			Object: "squatter",
+			Keys:   []Key{{"one", 1}, {"two", 2}},
+		},
+	}
+	pending := &entry{}
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}, {"three", 3}},
+	}
+	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{
-					1: result,
+					1: squatter,
 				},
 			},
 			"two": {
 				entries: map[interface{}]*entry{
-					2: result,
+					2: squatter,
 				},
 			},
 			"three": {
 				entries: map[interface{}]*entry{
-					3: result,
-				},
-			},
-			"five": {
-				entries: map[interface{}]*entry{
-					5: result,
+					3: pending,
 				},
 			},
 		},
-	}, obj)
+	}
+
+	result := obj.insertOverwrite(ent)
+
+	assert.Same(t, ent, result.content)
+	assert.Equal(t, map[interface{}]*entry{1: result}, obj.indexes["one"].entries)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["two"].entries)
+	assert.Equal(t, map[interface{}]*entry{3: pending}, obj.indexes["three"].entries)
+	assert.Same(t, ent, pending.content)
+	assert.Equal(t, uint64(1), obj.stats.ImplicitEvictions)
 }
 
-func TestFCacheInsertError(t *testing.T) {
-	ent := &Entry{
-		Error: assert.AnError,
-		Keys: []Key{
-			{"one", 1},
-			{"two", 2},
-			{"three", 3},
-			{"four", 4},
-			{"five", 5},
+func TestFCacheInsertOverwriteUncacheable(t *testing.T) {
+	squatter := &entry{
+		content: &Entry{
+			Object: "squatter",
+			Keys:   []Key{{"one", 1}},
 		},
 	}
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{
-					1: {},
-				},
-			},
-			"two": {
-				entries: map[interface{}]*entry{},
-			},
-			"three": {
-				entries: map[interface{}]*entry{
-					3: {},
+					1: squatter,
 				},
 			},
-			"five": {
-				entries: map[interface{}]*entry{},
-			},
 		},
 	}
 
-	result := obj.insert(ent)
+	result := obj.insertOverwrite(&Entry{
+		Error: assert.AnError,
+		Keys:  []Key{{"one", 1}},
+	})
 
 	assert.Nil(t, result)
-	assert.Equal(t, &FCache{
+	assert.Equal(t, map[interface{}]*entry{1: squatter}, obj.indexes["one"].entries)
+}
+
+func TestFCacheMatchesTrue(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {},
+		},
+	}
+
+	result := obj.matches(&Entry{
+		Keys: []Key{{"other", 1}, {"one", 1}},
+	})
+
+	assert.True(t, result)
+}
+
+func TestFCacheMatchesFalse(t *testing.T) {
+	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
-				entries: map[interface{}]*entry{},
-			},
-			"two": {
-				entries: map[interface{}]*entry{},
-			},
-			"three": {
-				entries: map[interface{}]*entry{},
-			},
-			"five": {
-				entries: map[interface{}]*entry{},
+				multi: true,
 			},
 		},
-	}, obj)
+	}
+
+	result := obj.matches(&Entry{
+		Keys: []Key{{"other", 1}, {"one", 1}},
+	})
+
+	assert.False(t, result)
 }
 
-func TestFCacheInsertPermanentError(t *testing.T) {
+func TestFCacheInsertBase(t *testing.T) {
 	ent := &Entry{
-		Error: &PermanentError{assert.AnError},
+		Object: "object",
 		Keys: []Key{
 			{"one", 1},
 			{"two", 2},
@@ -258,156 +294,140 @@ func TestFCacheInsertPermanentError(t *testing.T) {
 				},
 			},
 		},
+		version: 1,
 	}, obj)
 }
 
-func TestFCacheLookupInternalBase(t *testing.T) {
+func TestFCacheInsertMulti(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+		Keys: []Key{
+			{"one", 1},
+			{"two", 2},
+		},
+	}
+	set := &Entry{
+		Object: []interface{}{"object"},
+		Keys:   []Key{{"two", 2}},
+		multi:  true,
+	}
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
-				entries: map[interface{}]*entry{
-					1: {
-						content: &Entry{
-							Object: "object",
-						},
-					},
-				},
+				entries: map[interface{}]*entry{},
+			},
+			"two": {
+				entries: map[interface{}]*entry{},
+				multi:   true,
 			},
 		},
 	}
 
-	result, err := obj.lookup(lookupOptions{
-		key: &Key{"one", 1},
-	})
+	result1 := obj.insert(ent)
+	result2 := obj.insert(set)
 
-	assert.NoError(t, err)
-	assert.Equal(t, &Future{
-		fc:  obj,
-		ent: obj.indexes["one"].entries[1],
-	}, result)
+	assert.Equal(t, map[interface{}]*entry{
+		1: result1,
+	}, obj.indexes["one"].entries)
+	assert.Equal(t, map[interface{}]*entry{
+		2: result2,
+	}, obj.indexes["two"].entries)
 }
 
-func TestFCacheLookupInternalMissBase(t *testing.T) {
+func TestFCacheInsertNotFound(t *testing.T) {
+	ent := &Entry{
+		Keys:     []Key{{"one", 1}},
+		NotFound: true,
+	}
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{},
-				factory: func(tCtx context.Context, tKey Key) *Entry {
-					return &Entry{
-						Object: "object",
-						Keys:   []Key{{"one", 1}},
-					}
-				},
 			},
 		},
 	}
 
-	result, err := obj.lookup(lookupOptions{
-		key: &Key{"one", 1},
-	})
+	result := obj.insert(ent)
 
-	assert.NoError(t, err)
-	assert.NotNil(t, result)
-	object, err := result.Wait()
-	assert.NoError(t, err)
-	assert.Equal(t, "object", object)
+	assert.Same(t, ErrNotFound, ent.Error)
+	assert.Same(t, ent, result.content)
+	assert.Equal(t, map[interface{}]*entry{
+		1: result,
+	}, obj.indexes["one"].entries)
 }
 
-func TestFCacheLookupInternalMissWithObject(t *testing.T) {
+func TestFCacheInsertCreatedAt(t *testing.T) {
+	createdAt := time.Unix(1000, 0)
+	defer patcher.SetVar(&now, func() time.Time { return createdAt }).Install().Restore()
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{},
-				factory: func(tCtx context.Context, tKey Key) *Entry {
-					return &Entry{
-						Error: assert.AnError,
-						Keys:  []Key{{"one", 1}},
-					}
-				},
 			},
 		},
 	}
 
-	result, err := obj.lookup(lookupOptions{
-		ent: &Entry{
-			Object: "object",
-			Keys:   []Key{{"one", 1}},
-		},
-		key: &Key{"one", 1},
-	})
+	obj.insert(ent)
 
-	assert.NoError(t, err)
-	assert.Equal(t, &Future{
-		fc:  obj,
-		ent: obj.indexes["one"].entries[1],
-	}, result)
+	assert.Equal(t, createdAt, ent.CreatedAt)
 }
 
-func TestFCacheLookupInternalPendingSearchOnly(t *testing.T) {
+func TestFCacheInsertVersion(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
-				entries: map[interface{}]*entry{
-					1: {},
-				},
+				entries: map[interface{}]*entry{},
 			},
 		},
+		version: 5,
 	}
 
-	result, err := obj.lookup(lookupOptions{
-		key:  &Key{"one", 1},
-		only: true,
-	})
+	obj.insert(ent)
 
-	assert.Same(t, ErrNotCached, err)
-	assert.Nil(t, result)
+	assert.Equal(t, uint64(6), ent.Version)
+	assert.Equal(t, uint64(6), obj.version)
 }
 
-func TestFCacheLookupInternalMissSearchCache(t *testing.T) {
+func TestFCacheInsertTags(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+		Tags:   []string{"a"},
+	}
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{},
-				factory: func(tCtx context.Context, tKey Key) *Entry {
-					return &Entry{
-						Object: "object",
-						Keys:   []Key{{"one", 1}},
-					}
-				},
 			},
 		},
 	}
 
-	result, err := obj.lookup(lookupOptions{
-		key:  &Key{"one", 1},
-		only: true,
-	})
+	obj.insert(ent)
 
-	assert.Same(t, ErrNotCached, err)
-	assert.Nil(t, result)
+	assert.Equal(t, map[string]tagSet{"a": {ent: true}}, obj.tags)
 }
 
-func TestFCacheLookupInternalBadIndex(t *testing.T) {
-	obj := &FCache{
-		indexes: map[interface{}]index{},
+func TestFCacheInsertTagsNotStored(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}, {"two", 1}},
+		Tags:   []string{"a"},
 	}
-
-	result, err := obj.lookup(lookupOptions{
-		key: &Key{"one", 1},
-	})
-
-	assert.Same(t, ErrBadIndex, err)
-	assert.Nil(t, result)
-}
-
-func TestFCacheLookupBase(t *testing.T) {
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{
 					1: {
 						content: &Entry{
-							Object: "object",
+							Object: "cached",
 						},
 					},
 				},
@@ -415,76 +435,1535 @@ func TestFCacheLookupBase(t *testing.T) {
 		},
 	}
 
-	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	obj.insert(ent)
 
-	assert.NoError(t, err)
-	assert.Equal(t, "object", result)
+	assert.Nil(t, obj.tags)
 }
 
-func TestFCacheLookupBadOption(t *testing.T) {
+func TestFCacheInsertTagsPending(t *testing.T) {
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+		Tags:   []string{"a"},
+	}
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{
-					1: {
-						content: &Entry{
-							Object: "object",
-						},
-					},
+					1: {},
 				},
 			},
 		},
 	}
 
-	result, err := obj.Lookup()
+	obj.insert(ent)
 
-	assert.Same(t, ErrNoKey, err)
-	assert.Nil(t, result)
+	assert.Equal(t, map[string]tagSet{"a": {ent: true}}, obj.tags)
 }
 
-func TestFCacheLookupLookupError(t *testing.T) {
-	obj := &FCache{
-		indexes: map[interface{}]index{},
-	}
+func TestCheckKeysBase(t *testing.T) {
+	err := checkKeys([]Key{{"one", 1}, {"two", 2}, {"one", 1}})
 
-	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+}
 
-	assert.Same(t, ErrBadIndex, err)
-	assert.Nil(t, result)
+func TestCheckKeysConflict(t *testing.T) {
+	err := checkKeys([]Key{{"one", 1}, {"two", 2}, {"one", 2}})
+
+	assert.Same(t, ErrConflictingKeys, err)
 }
 
-func TestFCacheLookupFutureBase(t *testing.T) {
+func TestFCacheInsertStrict(t *testing.T) {
+	pending := &entry{}
+	ent := &Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}, {"one", 2}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+		},
+		strict: true,
+	}
+
+	result := obj.insert(ent)
+
+	assert.Nil(t, result)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["one"].entries)
+	assert.Equal(t, &Entry{
+		Error: ErrConflictingKeys,
+		Keys:  []Key{{"one", 1}, {"one", 2}},
+	}, pending.content)
+}
+
+func TestFCacheInsertError(t *testing.T) {
+	ent := &Entry{
+		Error: assert.AnError,
+		Keys: []Key{
+			{"one", 1},
+			{"two", 2},
+			{"three", 3},
+			{"four", 4},
+			{"five", 5},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{},
+			},
+			"three": {
+				entries: map[interface{}]*entry{
+					3: {},
+				},
+			},
+			"five": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result := obj.insert(ent)
+
+	assert.Nil(t, result)
+	assert.Equal(t, &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+			"two": {
+				entries: map[interface{}]*entry{},
+			},
+			"three": {
+				entries: map[interface{}]*entry{},
+			},
+			"five": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}, obj)
+}
+
+func TestFCacheInsertPermanentError(t *testing.T) {
+	ent := &Entry{
+		Error: &PermanentError{assert.AnError},
+		Keys: []Key{
+			{"one", 1},
+			{"two", 2},
+			{"three", 3},
+			{"four", 4},
+			{"five", 5},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{},
+			},
+			"three": {
+				entries: map[interface{}]*entry{
+					3: {},
+				},
+			},
+			"five": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result := obj.insert(ent)
+
+	assert.Equal(t, &entry{
+		content: ent,
+	}, result)
+	assert.Equal(t, &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: result,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: result,
+				},
+			},
+			"three": {
+				entries: map[interface{}]*entry{
+					3: result,
+				},
+			},
+			"five": {
+				entries: map[interface{}]*entry{
+					5: result,
+				},
+			},
+		},
+		version: 1,
+	}, obj)
+}
+
+func TestNewFactoryEntryBase(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	ent, result := newFactoryEntry(lookupOptions{
+		ctx: ctx,
+	})
+
+	assert.NotNil(t, ent.cancel)
+	_, ok := result.Deadline()
+	assert.False(t, ok)
+}
+
+func TestNewFactoryEntryBound(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	expected, _ := ctx.Deadline()
+
+	ent, result := newFactoryEntry(lookupOptions{
+		ctx:   ctx,
+		bound: true,
+	})
+
+	deadline, ok := result.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, expected, deadline)
+	ent.cancel()
+	assert.Same(t, context.Canceled, result.Err())
+}
+
+type testCtxKey struct{}
+
+func TestNewFactoryEntryDerive(t *testing.T) {
+	ctx := context.WithValue(context.Background(), testCtxKey{}, "batch")
+
+	ent, result := newFactoryEntry(lookupOptions{
+		ctx:    ctx,
+		derive: true,
+	})
+
+	assert.Equal(t, "batch", result.Value(testCtxKey{}))
+	ent.cancel()
+	assert.Same(t, context.Canceled, result.Err())
+}
+
+func TestFCacheLookupDeriveFactoryContext(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(ctx context.Context, key Key) *Entry {
+					return &Entry{
+						Object: ctx.Value(testCtxKey{}),
+						Keys:   []Key{key},
+					}
+				},
+			},
+		},
+	}
+	ctx := context.WithValue(context.Background(), testCtxKey{}, "batch")
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}), WithContext(ctx), DeriveFactoryContext)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "batch", result)
+}
+
+func TestFCacheLookupWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(ctx context.Context, key Key) *Entry {
+					<-release
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{key},
+					}
+				},
+			},
+		},
+	}
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}), WithTimeout(10*time.Millisecond))
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, result)
+	close(release)
+	result, err = obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+}
+
+func TestFCacheLookupKeepWarming(t *testing.T) {
+	release := make(chan struct{})
+	calls := int32(0)
+	obj, err := NewWithOptions([]Index{{
+		Index: "one",
+		Factory: func(ctx context.Context, key Key) *Entry {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return &Entry{
+				Object: ctx.Err() == nil,
+				Keys:   []Key{key},
+			}
+		},
+	}}, AutoCancel)
+	require.NoError(t, err)
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}), WithTimeout(10*time.Millisecond), KeepWarming)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, result)
+	close(release)
+	result, err = obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, true, result)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFCacheLookupFreshFresh(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1005, 0) }).Install().Restore()
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object:    "object",
+							Keys:      []Key{{"one", 1}},
+							CreatedAt: time.Unix(1000, 0),
+						},
+					},
+				},
+				factory: func(ctx context.Context, key Key) *Entry {
+					panic("factory called")
+				},
+			},
+		},
+	}
+
+	result, err := obj.LookupFresh(10*time.Second, ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Nil(t, obj.indexes["one"].entries[1].next)
+}
+
+func TestFCacheLookupFreshTooOld(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1010, 0) }).Install().Restore()
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object:    "old",
+							Keys:      []Key{{"one", 1}},
+							CreatedAt: time.Unix(1000, 0),
+						},
+					},
+				},
+				factory: func(ctx context.Context, key Key) *Entry {
+					return &Entry{
+						Object: "new",
+						Keys:   []Key{key},
+					}
+				},
+			},
+		},
+	}
+
+	result, err := obj.LookupFresh(10*time.Second, ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "new", result)
+}
+
+func TestFCacheLookupMissingFactory(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrMissingFactory, err)
+	assert.Nil(t, result)
+	assert.Len(t, obj.indexes["one"].entries, 0)
+	assert.Equal(t, 0, obj.pending)
+}
+
+func TestFCacheLookupMissingGroupFactory(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				groupKey: func(key Key) interface{} {
+					return key.Key
+				},
+				groups: map[interface{}]*group{},
+			},
+		},
+	}
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrMissingFactory, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupMissingRefreshFactory(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+							Keys:   []Key{{"one", 1}},
+						},
+						stale: true,
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Nil(t, obj.indexes["one"].entries[1].next)
+
+	result, err = obj.Lookup(ByKey(Key{"one", 1}), ForceRefresh)
+
+	assert.Same(t, ErrMissingFactory, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupBoundFactory(t *testing.T) {
+	factoryErr := make(chan error, 1)
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(ctx context.Context, key Key) *Entry {
+					<-ctx.Done()
+					factoryErr <- ctx.Err()
+					return &Entry{
+						Error: ctx.Err(),
+						Keys:  []Key{key},
+					}
+				},
+			},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}), WithContext(ctx), BoundFactory)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, result)
+	assert.Equal(t, context.DeadlineExceeded, <-factoryErr)
+}
+
+func TestFCacheLookupInternalBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 1},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Future{
+		fc:  obj,
+		ent: obj.indexes["one"].entries[1],
+	}, result)
+	assert.Equal(t, uint64(1), obj.indexes["one"].entries[1].hits)
+}
+
+func TestFCacheLookupInternalMissBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{{"one", 1}},
+					}
+				},
+			},
+		},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 1},
+	})
+
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	object, err := result.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", object)
+}
+
+func TestFCacheLookupInternalMissWithFactory(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					t.Fail()
+					return nil
+				},
+			},
+		},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 1},
+		factory: func(tCtx context.Context, tKey Key) *Entry {
+			return &Entry{
+				Object: "override",
+				Keys:   []Key{{"one", 1}},
+			}
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	object, err := result.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "override", object)
+}
+
+func TestFCacheLookupInternalMissWithObject(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					return &Entry{
+						Error: assert.AnError,
+						Keys:  []Key{{"one", 1}},
+					}
+				},
+			},
+		},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		ent: &Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 1}},
+		},
+		key: &Key{"one", 1},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Future{
+		fc:  obj,
+		ent: obj.indexes["one"].entries[1],
+	}, result)
+}
+
+func TestFCacheLookupInternalPendingSearchOnly(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		key:  &Key{"one", 1},
+		only: true,
+	})
+
+	assert.Same(t, ErrNotCached, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupInternalMissSearchCache(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{{"one", 1}},
+					}
+				},
+			},
+		},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		key:  &Key{"one", 1},
+		only: true,
+	})
+
+	assert.Same(t, ErrNotCached, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupInternalMissSearchCacheDefault(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					2: {},
+				},
+				defObject: "default",
+			},
+		},
+	}
+
+	for _, k := range []interface{}{1, 2} {
+		result, err := obj.lookup(lookupOptions{
+			key:  &Key{"one", k},
+			only: true,
+		})
+
+		assert.NoError(t, err)
+		object, err := result.Wait()
+		assert.NoError(t, err)
+		assert.Equal(t, "default", object)
+	}
+	assert.Len(t, obj.indexes["one"].entries, 1)
+}
+
+func TestFCacheLookupInternalBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 1},
+	})
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+}
+
+func TestFCacheLookupBadOption(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Lookup()
+
+	assert.Same(t, ErrNoKey, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupLookupError(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupFutureBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.LookupFuture(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Future{
+		fc:  obj,
+		ent: obj.indexes["one"].entries[1],
+	}, result)
+}
+
+func TestFCacheLookupFutureBadOption(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.LookupFuture()
+
+	assert.Same(t, ErrNoKey, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupWithFutureBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				factory: func(ctx context.Context, key Key) *Entry {
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{key},
+					}
+				},
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	f, result, err := obj.LookupWithFuture(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.False(t, f.canceled)
+	result, err = f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+}
+
+func TestFCacheLookupWithFutureBadOption(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	f, result, err := obj.LookupWithFuture()
+
+	assert.Same(t, ErrNoKey, err)
+	assert.Nil(t, f)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupWithFutureLookupError(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	f, result, err := obj.LookupWithFuture(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, f)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupAnyBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.LookupAny(Key{"one", 1}, Key{"two", 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Len(t, obj.indexes["one"].entries, 0)
+}
+
+func TestFCacheLookupAnyScan(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: ent,
+				},
+			},
+		},
+	}
+
+	result, err := obj.LookupAny(Key{"three", 3}, Key{"one", 1}, Key{"two", 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Equal(t, Stats{Hits: 1}, obj.stats)
+	assert.Equal(t, uint64(1), ent.hits)
+}
+
+func TestFCacheLookupAnyMiss(t *testing.T) {
+	factoryCalled := 0
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					assert.Equal(t, Key{"one", 1}, tKey)
+					factoryCalled++
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{{"one", 1}},
+					}
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result, err := obj.LookupAny(Key{"one", 1}, Key{"two", 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Equal(t, 1, factoryCalled)
+}
+
+func TestFCacheLookupAnyExpired(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{{"one", 1}},
+					}
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: {
+						content: &Entry{
+							Error: &RetryableError{assert.AnError, time.Unix(999, 0)},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.LookupAny(Key{"one", 1}, Key{"two", 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+}
+
+func TestFCacheLookupAnyBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.LookupAny(Key{"one", 1}, Key{"two", 2})
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupAnyNoKeys(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.LookupAny()
+
+	assert.Same(t, ErrNoKey, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheLookupInternalOverwriteCompleted(t *testing.T) {
+	old := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}, {"two", 2}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: old,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: old,
+				},
+			},
+		},
+	}
+	ent := &Entry{
+		Object: "new",
+		Keys:   []Key{{"one", 1}, {"two", 2}},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		ent:       ent,
+		key:       &Key{"one", 1},
+		overwrite: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &Future{
+		fc: obj,
+		ent: &entry{
+			content: ent,
+		},
+	}, result)
+	assert.Same(t, result.ent, obj.indexes["one"].entries[1])
+	assert.Same(t, result.ent, obj.indexes["two"].entries[2])
+	assert.Equal(t, uint64(1), obj.stats.ImplicitEvictions)
+}
+
+func TestFCacheLookupInternalOverwriteUncacheable(t *testing.T) {
+	old := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: old,
+				},
+			},
+		},
+	}
+	ent := &Entry{
+		Error: assert.AnError,
+		Keys:  []Key{{"one", 1}},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		ent:       ent,
+		key:       &Key{"one", 1},
+		overwrite: true,
+	})
+
+	require.NoError(t, err)
+	obj2, err := result.Wait()
+	assert.Same(t, assert.AnError, err)
+	assert.Nil(t, obj2)
+	assert.Empty(t, obj.indexes["one"].entries)
+}
+
+func TestFCacheLookupInternalMissUncacheable(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result, err := obj.Lookup(ByEntry(Entry{
+		Error: assert.AnError,
+		Keys:  []Key{{"one", 1}},
+	}))
+
+	assert.Same(t, assert.AnError, err)
+	assert.Nil(t, result)
+	assert.Empty(t, obj.indexes["one"].entries)
+}
+
+func TestFCacheLookupInternalOverwriteVersion(t *testing.T) {
+	old := &entry{
+		content: &Entry{
+			Object:  "old",
+			Keys:    []Key{{"one", 1}},
+			Version: 3,
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: old,
+				},
+			},
+		},
+		version: 3,
+	}
+	ent := &Entry{
+		Object: "new",
+		Keys:   []Key{{"one", 1}},
+	}
+	version := uint64(2)
+
+	result, err := obj.lookup(lookupOptions{
+		ent:       ent,
+		key:       &Key{"one", 1},
+		overwrite: true,
+		version:   &version,
+	})
+
+	assert.Same(t, ErrVersionConflict, err)
+	assert.Nil(t, result)
+	assert.Same(t, old, obj.indexes["one"].entries[1])
+
+	version = 3
+	result, err = obj.lookup(lookupOptions{
+		ent:       ent,
+		key:       &Key{"one", 1},
+		overwrite: true,
+		version:   &version,
+	})
+
+	assert.NoError(t, err)
+	assert.Same(t, ent, result.ent.content)
+	assert.Equal(t, uint64(4), ent.Version)
+}
+
+func TestFCacheLookupInternalOverwriteObject(t *testing.T) {
+	old := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: old,
+				},
+			},
+		},
+	}
+	ent := &Entry{
+		Object: "new",
+		Keys:   []Key{{"one", 1}},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		ent:       ent,
+		key:       &Key{"one", 1},
+		overwrite: true,
+		expect: &expectation{
+			object: "other",
+			equal:  reflect.DeepEqual,
+		},
+	})
+
+	assert.Same(t, ErrObjectConflict, err)
+	assert.Nil(t, result)
+	assert.Same(t, old, obj.indexes["one"].entries[1])
+
+	result, err = obj.lookup(lookupOptions{
+		ent:       ent,
+		key:       &Key{"one", 1},
+		overwrite: true,
+		expect: &expectation{
+			object: "old",
+			equal:  reflect.DeepEqual,
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Same(t, ent, result.ent.content)
+}
+
+func TestFCacheLookupInternalOverwritePending(t *testing.T) {
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+	ent := &Entry{
+		Object: "new",
+		Keys:   []Key{{"one", 1}, {"two", 2}},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		ent:       ent,
+		key:       &Key{"one", 1},
+		overwrite: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Same(t, pending, result.ent)
+	assert.Same(t, ent, pending.content)
+	assert.Same(t, pending, obj.indexes["one"].entries[1])
+	assert.Same(t, ent, obj.indexes["two"].entries[2].content)
+}
+
+func TestFCacheLookupInternalHitIgnoresEntry(t *testing.T) {
+	old := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: old,
+				},
+			},
+		},
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		ent: &Entry{
+			Object: "new",
+			Keys:   []Key{{"one", 1}},
+		},
+		key: &Key{"one", 1},
+	})
+
+	assert.NoError(t, err)
+	assert.Same(t, old, result.ent)
+	assert.Equal(t, "old", old.content.Object)
+}
+
+func TestFCacheLookupInternalStrictEntry(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+		strict: true,
+	}
+
+	result, err := obj.lookup(lookupOptions{
+		ent: &Entry{
+			Object: "new",
+			Keys:   []Key{{"one", 1}, {"one", 2}},
+		},
+		key: &Key{"one", 1},
+	})
+
+	assert.Same(t, ErrConflictingKeys, err)
+	assert.Nil(t, result)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["one"].entries)
+}
+
+func TestFCacheManufactureGroup(t *testing.T) {
+	ctx := context.Background()
+	key := Key{"one", 1}
+	ent1 := &Entry{
+		Object: "o1",
+		Keys:   []Key{{"one", 1}},
+	}
+	ent2 := &Entry{
+		Object: "o2",
+		Keys:   []Key{{"one", 2}},
+	}
+	g := &group{
+		keys: []Key{{"one", 1}, {"one", 2}, {"one", 3}},
+	}
+	pending3 := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+					2: {},
+					3: pending3,
+				},
+				groups: map[interface{}]*group{
+					"group": g,
+				},
+			},
+		},
+	}
+	factory := func(tCtx context.Context, tKey Key) []*Entry {
+		assert.Equal(t, key, tKey)
+		return []*Entry{ent1, ent2}
+	}
+
+	obj.manufactureGroup(ctx, key, "group", g, factory)
+
+	assert.Len(t, obj.indexes["one"].groups, 0)
+	assert.Len(t, obj.indexes["one"].entries, 2)
+	assert.Same(t, ent1, obj.indexes["one"].entries[1].content)
+	assert.Same(t, ent2, obj.indexes["one"].entries[2].content)
+	assert.Same(t, ErrEntryNotFound, pending3.content.Error)
+}
+
+func TestFCacheLookupInternalGroup(t *testing.T) {
+	calls := 0
+	release := make(chan struct{})
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				groupKey: func(key Key) interface{} {
+					return key.Key.(int) / 10
+				},
+				groupFactory: func(tCtx context.Context, tKey Key) []*Entry {
+					<-release
+					calls++
+					return []*Entry{
+						{
+							Object: "o11",
+							Keys:   []Key{{"one", 11}},
+						},
+						{
+							Object: "o12",
+							Keys:   []Key{{"one", 12}},
+						},
+					}
+				},
+				groups: map[interface{}]*group{},
+			},
+		},
+	}
+
+	f1, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 11},
+	})
+	assert.NoError(t, err)
+	f2, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 12},
+	})
+	assert.NoError(t, err)
+	close(release)
+
+	result, err := f1.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "o11", result)
+	result, err = f2.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "o12", result)
+	assert.Equal(t, 1, calls)
+}
+
+func TestFCacheLookupInternalMaxPending(t *testing.T) {
+	release := make(chan struct{})
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					<-release
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{tKey},
+					}
+				},
+			},
+		},
+		maxPending: 1,
+	}
+
+	f1, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 1},
+	})
+	assert.NoError(t, err)
+	f2, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 2},
+	})
+	assert.Same(t, ErrTooManyPending, err)
+	assert.Nil(t, f2)
+	obj.Lock()
+	assert.Equal(t, 1, obj.pending)
+	assert.NotContains(t, obj.indexes["one"].entries, 2)
+	obj.Unlock()
+	close(release)
+
+	result, err := f1.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	obj.Lock()
+	assert.Equal(t, 0, obj.pending)
+	obj.Unlock()
+	f2, err = obj.lookup(lookupOptions{
+		key: &Key{"one", 2},
+	})
+	assert.NoError(t, err)
+	result, err = f2.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+}
+
+func TestFCacheLookupInternalGroupMaxPending(t *testing.T) {
+	release := make(chan struct{})
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				groupKey: func(key Key) interface{} {
+					return key.Key.(int) / 10
+				},
+				groupFactory: func(tCtx context.Context, tKey Key) []*Entry {
+					<-release
+					return nil
+				},
+				groups: map[interface{}]*group{},
+			},
+		},
+		maxPending: 1,
+	}
+
+	f1, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 11},
+	})
+	assert.NoError(t, err)
+	f2, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 12},
+	})
+	assert.Same(t, ErrTooManyPending, err)
+	assert.Nil(t, f2)
+	f3, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 21},
+	})
+	assert.Same(t, ErrTooManyPending, err)
+	assert.Nil(t, f3)
+	close(release)
+
+	_, err = f1.Wait()
+	assert.Same(t, ErrEntryNotFound, err)
+}
+
+func TestFCacheLookupInternalRetryable(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{
 					1: {
 						content: &Entry{
-							Object: "object",
+							Error: &RetryableError{assert.AnError, time.Unix(1001, 0)},
+							Keys:  []Key{{"one", 1}},
+						},
+					},
+					2: {
+						content: &Entry{
+							Error: &RetryableError{assert.AnError, time.Unix(999, 0)},
+							Keys:  []Key{{"one", 2}},
 						},
 					},
 				},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{tKey},
+					}
+				},
 			},
 		},
 	}
 
-	result, err := obj.LookupFuture(ByKey(Key{"one", 1}))
+	f1, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 1},
+	})
+	assert.NoError(t, err)
+	f2, err := obj.lookup(lookupOptions{
+		key: &Key{"one", 2},
+	})
+	assert.NoError(t, err)
 
+	result, err := f1.Wait()
+	assert.Equal(t, &RetryableError{assert.AnError, time.Unix(1001, 0)}, err)
+	assert.Nil(t, result)
+	result, err = f2.Wait()
 	assert.NoError(t, err)
-	assert.Equal(t, &Future{
-		fc:  obj,
-		ent: obj.indexes["one"].entries[1],
+	assert.Equal(t, "object", result)
+	assert.Equal(t, uint64(1), obj.stats.ImplicitEvictions)
+}
+
+func TestFCacheLookupInternalPaused(t *testing.T) {
+	stale := &entry{
+		content: &Entry{
+			Object: "stale",
+			Keys:   []Key{{"one", 2}},
+		},
+		stale: true,
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					2: stale,
+				},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{tKey},
+					}
+				},
+			},
+		},
+		paused: true,
+	}
+
+	f1, err1 := obj.lookup(lookupOptions{
+		key: &Key{"one", 1},
+	})
+	f2, err2 := obj.lookup(lookupOptions{
+		key: &Key{"one", 2},
+	})
+
+	assert.Same(t, ErrNotCached, err1)
+	assert.Nil(t, f1)
+	assert.NotContains(t, obj.indexes["one"].entries, 1)
+	assert.NoError(t, err2)
+	assert.Same(t, stale, f2.ent)
+	assert.Nil(t, stale.next)
+	assert.Equal(t, uint64(1), obj.stats.SearchMisses)
+}
+
+func TestFCacheInspectBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Error:     &PermanentError{assert.AnError},
+							Keys:      []Key{{"one", 1}},
+							CreatedAt: time.Unix(1000, 0),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Inspect(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Entry{
+		Error:     &PermanentError{assert.AnError},
+		Keys:      []Key{{"one", 1}},
+		CreatedAt: time.Unix(1000, 0),
 	}, result)
 }
 
-func TestFCacheLookupFutureBadOption(t *testing.T) {
+func TestFCacheInspectPending(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Inspect(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrNotCached, err)
+	assert.Equal(t, Entry{}, result)
+}
+
+func TestFCacheInspectExpired(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
 	obj := &FCache{
 		indexes: map[interface{}]index{
 			"one": {
 				entries: map[interface{}]*entry{
 					1: {
 						content: &Entry{
-							Object: "object",
+							Error: &RetryableError{assert.AnError, time.Unix(999, 0)},
 						},
 					},
 				},
@@ -492,8 +1971,91 @@ func TestFCacheLookupFutureBadOption(t *testing.T) {
 		},
 	}
 
-	result, err := obj.LookupFuture()
+	result, err := obj.Inspect(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrNotCached, err)
+	assert.Equal(t, Entry{}, result)
+}
+
+func TestFCacheInspectMissing(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				factory: func(tCtx context.Context, tKey Key) *Entry {
+					t.Fail()
+					return nil
+				},
+			},
+		},
+	}
+
+	result, err := obj.Inspect(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrNotCached, err)
+	assert.Equal(t, Entry{}, result)
+	assert.Len(t, obj.indexes["one"].entries, 0)
+}
+
+func TestFCacheInspectBadOption(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.Inspect()
 
 	assert.Same(t, ErrNoKey, err)
-	assert.Nil(t, result)
+	assert.Equal(t, Entry{}, result)
+}
+
+func TestFCacheInspectBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.Inspect(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Equal(t, Entry{}, result)
+}
+
+func TestFCacheLookupInternalStats(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+					2: {},
+				},
+				factory: func(ctx context.Context, key Key) *Entry {
+					return &Entry{
+						Object: "object",
+						Keys:   []Key{key},
+					}
+				},
+			},
+		},
+	}
+
+	for _, o := range []lookupOptions{
+		{key: &Key{"one", 1}},
+		{key: &Key{"one", 1}, only: true},
+		{key: &Key{"one", 2}},
+		{key: &Key{"one", 2}, only: true},
+		{key: &Key{"one", 3}, only: true},
+		{key: &Key{"one", 3}},
+		{key: &Key{"one", 4}, ent: &Entry{Keys: []Key{{"one", 4}}}},
+	} {
+		_, _ = obj.lookup(o)
+	}
+
+	obj.Lock()
+	defer obj.Unlock()
+	assert.Equal(t, uint64(3), obj.stats.Hits)
+	assert.Equal(t, uint64(2), obj.stats.Misses)
+	assert.Equal(t, uint64(2), obj.stats.SearchMisses)
 }
@@ -14,7 +14,11 @@
 
 package fcache
 
-import "context"
+import (
+	"context"
+	"reflect"
+	"time"
+)
 
 // LookupOption identifies an option that may be passed to the
 // FCache.Lookup and FCache.Evict methods.
@@ -26,18 +30,37 @@ type LookupOption interface {
 // lookupOptions contains the consolidated options for a cache lookup
 // or invalidation operation.
 type lookupOptions struct {
-	ent  *Entry          // Specific entry to look up or cache
-	key  *Key            // Key to look up
-	only bool            // Flag to allow the miss and return an error
-	ctx  context.Context // Context to monitor for cancellation
+	ent       *Entry          // Specific entry to look up or cache
+	key       *Key            // Key to look up
+	only      bool            // Flag to allow the miss and return an error
+	overwrite bool            // Flag to replace a cached entry with ent
+	ctx       context.Context // Context to monitor for cancellation
+	factory   Factory         // Factory to use instead of the index's
+	parallel  int             // Maximum concurrent factories for batches
+	sem       chan struct{}   // Semaphore limiting concurrent factories
+	bound     bool            // Bound the factory by the ctx deadline
+	force     bool            // Refresh a completed entry
+	derive    bool            // Derive the factory context from ctx
+	version   *uint64         // Expected version of the entry
+	timeout   time.Duration   // Timeout for the lookup
+	maxAge    time.Duration   // Refresh completed entries this old
+	warm      bool            // Lookup only warms the cache
+	expect    *expectation    // Expected object of the entry
+	keepWarm  bool            // Keep the future if the wait is canceled
+	readOnly  bool            // Lookup must not alter the cache
+}
+
+// expectation describes the object expected to be cached, passed with
+// the IfObject option.
+type expectation struct {
+	object interface{}                 // The expected object
+	equal  func(a, b interface{}) bool // Compares the objects
 }
 
 // procLookupOpts processes a list of options and returns a
 // constructed options structure.
 func procLookupOpts(opts []LookupOption) (lookupOptions, error) {
-	result := lookupOptions{
-		ctx: context.Background(),
-	}
+	result := lookupOptions{}
 
 	// Apply the options
 	for _, opt := range opts {
@@ -51,9 +74,35 @@ func procLookupOpts(opts []LookupOption) (lookupOptions, error) {
 		return lookupOptions{}, ErrNoKey
 	}
 
+	// Default the context
+	if result.ctx == nil {
+		result.ctx = context.Background()
+	}
+
 	return result, nil
 }
 
+// applyTimeout applies the timeout specified with the WithTimeout
+// option, if any, to the lookup context.  The returned function MUST
+// be called to release the resources of the derived context once the
+// lookup is complete.
+func (o *lookupOptions) applyTimeout() context.CancelFunc {
+	if o.timeout <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(o.ctx, o.timeout)
+	o.ctx = ctx
+
+	return cancel
+}
+
+// tooOld checks whether the specified content is older than the
+// maximum age passed to LookupFresh, if any.
+func (o lookupOptions) tooOld(content *Entry) bool {
+	return o.maxAge > 0 && content != nil && now().Sub(content.CreatedAt) >= o.maxAge
+}
+
 // byEntryOption is a LookupOption that specifies an object to look
 // up.  If the object is in the cache, the cached version (rather than
 // the passed version) will be returned; otherwise, the specified
@@ -67,6 +116,9 @@ func (opt byEntryOption) apply(o *lookupOptions) error {
 	if o.key != nil {
 		return ErrDuplicateOption
 	}
+	if len(opt.Ent.Keys) <= 0 {
+		return ErrNoKeys
+	}
 	o.ent = &opt.Ent
 	o.key = &o.ent.Keys[0]
 	return nil
@@ -74,8 +126,9 @@ func (opt byEntryOption) apply(o *lookupOptions) error {
 
 // ByEntry returns a LookupOption that specifies an object to look up.
 // If the object is in the cache, the cached version (rather than the
-// passed version) will be returned; otherwise, the specified object
-// will be added to the cache and returned.  For a call to Evict, the
+// passed version) will be returned, unless the Overwrite option is
+// also provided; otherwise, the specified object will be added to the
+// cache and returned.  For a call to Evict, the
 // object itself is ignored, and only the first key is looked up and
 // used to evict whatever is in the cache.
 func ByEntry(ent Entry) LookupOption {
@@ -127,6 +180,172 @@ func (opt searchCacheOption) apply(o *lookupOptions) error {
 // not be called, even if the key is not found.
 var SearchCache searchCacheOption = true
 
+// overwriteOption is a LookupOption that specifies that the entry
+// passed with ByEntry should replace any entry already in the cache.
+type overwriteOption bool
+
+// apply simply applies the option.
+func (opt overwriteOption) apply(o *lookupOptions) error {
+	o.overwrite = bool(opt)
+	return nil
+}
+
+// Overwrite is a LookupOption that alters the behavior of ByEntry.
+// Normally, if the object is in the cache, the cached version is
+// returned and the passed version is ignored; with Overwrite, the
+// passed version replaces the cached version, completing any pending
+// entry; other entries cached under the keys of the passed version are
+// evicted.  This option has no effect unless ByEntry is also provided.
+var Overwrite overwriteOption = true
+
+// keepWarmingOption is a LookupOption that specifies that Lookup
+// should not cancel its future if its context is canceled.
+type keepWarmingOption bool
+
+// apply simply applies the option.
+func (opt keepWarmingOption) apply(o *lookupOptions) error {
+	o.keepWarm = bool(opt)
+	return nil
+}
+
+// KeepWarming is a LookupOption that alters the behavior of Lookup
+// when its context is canceled or times out while waiting for the
+// entry.  Normally, Lookup cancels its future when it returns, which,
+// with the AutoCancel option, may cancel the factory call; with
+// KeepWarming, the future is left waiting on the entry, so the factory
+// call completes and caches the entry, and a retry of the lookup may
+// find it.  The future is still canceled if the wait completes.
+var KeepWarming keepWarmingOption = true
+
+// boundFactoryOption is a LookupOption that specifies that the
+// deadline of the lookup context should also bound the factory.
+type boundFactoryOption bool
+
+// apply simply applies the option.
+func (opt boundFactoryOption) apply(o *lookupOptions) error {
+	o.bound = bool(opt)
+	return nil
+}
+
+// BoundFactory is a LookupOption that specifies that, if the lookup
+// invokes the index factory function, the deadline of the context
+// passed with WithContext should also apply to the context passed to
+// the factory.  Only the lookup that invokes the factory affects the
+// factory's deadline; later lookups that wait on the same pending
+// entry cannot shorten it.
+var BoundFactory boundFactoryOption = true
+
+// deriveFactoryContextOption is a LookupOption that specifies that
+// the factory context should be derived from the lookup context.
+type deriveFactoryContextOption bool
+
+// apply simply applies the option.
+func (opt deriveFactoryContextOption) apply(o *lookupOptions) error {
+	o.derive = bool(opt)
+	return nil
+}
+
+// DeriveFactoryContext is a LookupOption that specifies that, if the
+// lookup invokes the index factory function, the context passed to
+// the factory should be derived from the context passed with
+// WithContext, rather than from context.Background.  This allows
+// values, such as a batch identifier, to be passed through to the
+// factory; note that canceling the lookup context will then also
+// cancel the factory.  Only the lookup that invokes the factory
+// affects the factory's context; later lookups that wait on the same
+// pending entry have no effect on it.
+var DeriveFactoryContext deriveFactoryContextOption = true
+
+// ifVersionOption is a LookupOption that specifies the expected
+// version of the entry.
+type ifVersionOption uint64
+
+// apply applies the option.
+func (opt ifVersionOption) apply(o *lookupOptions) error {
+	version := uint64(opt)
+	o.version = &version
+	return nil
+}
+
+// IfVersion returns a LookupOption that specifies the expected version
+// of the entry being altered, as reported in the Version field of the
+// entry returned by Inspect.  If the version of the entry in the cache
+// does not match, the operation fails with ErrVersionConflict.  An
+// entry that is not cached, or is still pending, has version 0.  This
+// provides optimistic concurrency control: a caller may Inspect an
+// entry, compute a change, then apply it with IfVersion, retrying if
+// another caller altered the entry in the meantime.  The option is
+// honored when storing an entry with ByEntry, and by Reindex; it is
+// ignored by other operations.
+func IfVersion(version uint64) LookupOption {
+	return ifVersionOption(version)
+}
+
+// maxAgeOption is a LookupOption that specifies that completed entries
+// older than the specified age should be refreshed.  It is used by
+// LookupFresh.
+type maxAgeOption time.Duration
+
+// apply simply applies the option.
+func (opt maxAgeOption) apply(o *lookupOptions) error {
+	o.maxAge = time.Duration(opt)
+	return nil
+}
+
+// ifObjectOption is a LookupOption that specifies the expected object
+// of the entry.
+type ifObjectOption expectation
+
+// apply applies the option.
+func (opt ifObjectOption) apply(o *lookupOptions) error {
+	expect := expectation(opt)
+	if expect.equal == nil {
+		expect.equal = reflect.DeepEqual
+	}
+	o.expect = &expect
+	return nil
+}
+
+// IfObject returns a LookupOption that specifies the object expected
+// to be cached in the entry being altered.  If the cached object is not
+// equal to the expected object, as determined by the equal function,
+// the operation fails with ErrObjectConflict; an entry that is not
+// cached, or is still pending, has a nil object.  The equal function
+// is called with the cached object and the expected object, with the
+// cache locked; if it is nil, reflect.DeepEqual is used.  Callers may
+// supply a function comparing identities or selected fields for
+// objects where reflect.DeepEqual is too slow or gives the wrong
+// answer.  As with IfVersion, the option is honored when storing an
+// entry with ByEntry, and by Reindex; it is ignored by other
+// operations.
+func IfObject(expected interface{}, equal func(a, b interface{}) bool) LookupOption {
+	return ifObjectOption{
+		object: expected,
+		equal:  equal,
+	}
+}
+
+// forceRefreshOption is a LookupOption that specifies that a
+// completed entry should be refreshed.
+type forceRefreshOption bool
+
+// apply simply applies the option.
+func (opt forceRefreshOption) apply(o *lookupOptions) error {
+	o.force = bool(opt)
+	return nil
+}
+
+// ForceRefresh is a LookupOption that specifies that, if a completed
+// entry is found in the cache, it should be ignored; the index factory
+// function, or the factory specified by the WithFactory option, is
+// called to refresh the entry, and the lookup returns the result.  As
+// with a refresh of a stale entry, concurrent refreshes of the same
+// entry result in a single factory call, and the index's
+// RefreshInterval is honored, in which case the cached entry is
+// returned.  This option is ignored if SearchCache is also provided,
+// or if factory calls are paused.
+var ForceRefresh forceRefreshOption = true
+
 // withContextOption is a LookupOption that specifies a
 // context.Context for the lookup.
 type withContextOption struct {
@@ -152,6 +371,31 @@ func WithContext(ctx context.Context) LookupOption {
 	}
 }
 
+// withTimeoutOption is a LookupOption that specifies a timeout for
+// the lookup.
+type withTimeoutOption time.Duration
+
+// apply simply applies the option.
+func (opt withTimeoutOption) apply(o *lookupOptions) error {
+	if o.timeout != 0 {
+		return ErrDuplicateOption
+	}
+	o.timeout = time.Duration(opt)
+	return nil
+}
+
+// WithTimeout returns a LookupOption that specifies a timeout for the
+// lookup.  It is equivalent to passing WithContext with a context
+// constructed by context.WithTimeout, except that the context is
+// managed by the cache.  If WithContext is also passed, the timeout
+// applies to that context, so the earlier of the two deadlines is
+// used.  As with WithContext, this option is ignored by the
+// LookupFuture method.  For LookupMany, the timeout bounds the wait
+// for the entire batch.
+func WithTimeout(d time.Duration) LookupOption {
+	return withTimeoutOption(d)
+}
+
 // CleanOption identifies an option that may be passed to the
 // FCache.Clean method.
 type CleanOption interface {
@@ -165,6 +409,7 @@ type cleanOptions struct {
 	objects bool // Clean objects from the cache
 	errors  bool // Clean errors from the cache
 	pending bool // Clean pending operations from the cache
+	dryRun  bool // Don't actually clean the cache
 }
 
 // procCleanOpts processes a list of options and returns a constructed
@@ -186,6 +431,13 @@ func procCleanOpts(opts []CleanOption) cleanOptions {
 		opt.apply(&result)
 	}
 
+	// If only DryRun was passed, clean everything
+	if result.dryRun && !result.objects && !result.errors && !result.pending {
+		result.objects = true
+		result.errors = true
+		result.pending = true
+	}
+
 	return result
 }
 
@@ -216,9 +468,413 @@ func (opt pendingOption) apply(o *cleanOptions) {
 	o.pending = bool(opt)
 }
 
+// dryRunOption is a CleanOption that specifies that the cache should
+// not actually be cleaned.
+type dryRunOption bool
+
+// apply simply applies the option.
+func (opt dryRunOption) apply(o *cleanOptions) {
+	o.dryRun = bool(opt)
+}
+
 // CleanOptions that may be passed to the FCache.Clean method.
 var (
 	Objects objectsOption = true // Clean objects from the cache
 	Errors  errorsOption  = true // Clean errors from the cache
 	Pending pendingOption = true // Clean pending operations from the cache
+	DryRun  dryRunOption  = true // Only report what would be cleaned
+)
+
+// ContentsOption identifies an option that may be passed to the
+// FCache.Contents method.
+type ContentsOption interface {
+	// apply simply applies the option.
+	apply(o *contentsOptions)
+}
+
+// contentsOptions contains the consolidated options for listing the
+// contents of a cache index.
+type contentsOptions struct {
+	pending bool // Include placeholders for pending entries
+}
+
+// procContentsOpts processes a list of options and returns a
+// constructed options structure.
+func procContentsOpts(opts []ContentsOption) contentsOptions {
+	result := contentsOptions{}
+
+	// Apply the options
+	for _, opt := range opts {
+		opt.apply(&result)
+	}
+
+	return result
+}
+
+// includePendingOption is a ContentsOption that specifies that
+// placeholders for pending entries should be included.
+type includePendingOption bool
+
+// apply simply applies the option.
+func (opt includePendingOption) apply(o *contentsOptions) {
+	o.pending = bool(opt)
+}
+
+// ContentsIncludePending is a ContentsOption that specifies that
+// Contents should include a placeholder for each pending entry in the
+// index.  The placeholder has Pending set and a single key, the key of
+// the pending entry; for indexes with a KeyHasher, the key is the
+// value returned by the KeyHasher.  It has no object or error.
+var ContentsIncludePending includePendingOption = true
+
+// withFactoryOption is a LookupOption that specifies a factory
+// function to use instead of the index factory function.
+type withFactoryOption struct {
+	Factory Factory // The factory
+}
+
+// apply simply applies the option.
+func (opt withFactoryOption) apply(o *lookupOptions) error {
+	if o.factory != nil {
+		return ErrDuplicateOption
+	}
+	o.factory = opt.Factory
+	return nil
+}
+
+// WithFactory returns a LookupOption that specifies a factory function
+// to use instead of the index factory function, should the key not be
+// found in the cache.  This only affects the lookup that triggers the
+// factory; any other lookups that wait on the same pending entry
+// receive the results of whichever factory was invoked.
+func WithFactory(factory Factory) LookupOption {
+	return withFactoryOption{
+		Factory: factory,
+	}
+}
+
+// parallelismOption is a LookupOption that specifies the maximum
+// number of factory functions that a batch operation may run
+// concurrently.
+type parallelismOption int
+
+// apply simply applies the option.
+func (opt parallelismOption) apply(o *lookupOptions) error {
+	o.parallel = int(opt)
+	return nil
+}
+
+// Parallelism returns a LookupOption that specifies the maximum
+// number of factory functions that may be run concurrently by the
+// LookupMany or Preload methods; the remaining factory calls are
+// queued until one completes.  A value of 0 means that the number of
+// concurrent factory calls is unbounded.  This option is ignored by
+// other methods.
+func Parallelism(n int) LookupOption {
+	return parallelismOption(n)
+}
+
+// CacheOption identifies an option that may be passed to the
+// NewWithOptions function.
+type CacheOption interface {
+	// apply simply applies the option.
+	apply(o *cacheOptions)
+}
+
+// cacheOptions contains the consolidated options for constructing a
+// cache.
+type cacheOptions struct {
+	instrument   bool                    // Instrument the cache lock
+	sharedNotify bool                    // Share notification channels between futures
+	factories    map[interface{}]Factory // Factories shared between indexes
+	strict       bool                    // Reject conflicting entry keys
+	maker        IndexMaker              // Constructs indexes on demand
+	maxPending   int                     // Maximum number of pending entries
+	serveStale   bool                    // Keep stale content on error
+	track        bool                    // Track factory calls
+	slowAfter    time.Duration           // Threshold for slow factory calls
+	onSlow       SlowFactoryFunc         // Called for slow factory calls
+	onReject     RejectFunc              // Called when a limit is hit
+	coalesce     bool                    // Coalesce identical mutations
+	autoCancel   bool                    // Cancel abandoned factory calls
+}
+
+// procCacheOpts processes a list of options and returns a constructed
+// options structure.
+func procCacheOpts(opts []CacheOption) cacheOptions {
+	result := cacheOptions{}
+
+	// Apply the options
+	for _, opt := range opts {
+		opt.apply(&result)
+	}
+
+	return result
+}
+
+// instrumentLockOption is a CacheOption that specifies that the time
+// spent waiting for the cache lock should be recorded.
+type instrumentLockOption bool
+
+// apply simply applies the option.
+func (opt instrumentLockOption) apply(o *cacheOptions) {
+	o.instrument = bool(opt)
+}
+
+// InstrumentLock is a CacheOption that specifies that the cache lock
+// should be instrumented.  The number of times the lock is acquired,
+// the number of times an acquisition had to wait for another holder,
+// and the total time spent waiting are recorded and may be retrieved
+// using the Stats method.
+var InstrumentLock instrumentLockOption = true
+
+// sharedNotifyOption is a CacheOption that specifies that futures
+// waiting on a pending entry should share a notification channel.
+type sharedNotifyOption bool
+
+// apply simply applies the option.
+func (opt sharedNotifyOption) apply(o *cacheOptions) {
+	o.sharedNotify = bool(opt)
+}
+
+// SharedNotify is a CacheOption that specifies that futures waiting
+// on a pending entry should share a single notification channel,
+// reading the entry contents from the cache once the entry is
+// completed.  This avoids allocating a result channel for each
+// waiter, which may be beneficial for keys with many concurrent
+// waiters.  The Future.Channel method synthesizes a result channel on
+// demand.
+var SharedNotify sharedNotifyOption = true
+
+// strictKeysOption is a CacheOption that specifies that entries with
+// conflicting keys should be rejected.
+type strictKeysOption bool
+
+// apply simply applies the option.
+func (opt strictKeysOption) apply(o *cacheOptions) {
+	o.strict = bool(opt)
+}
+
+// StrictKeys is a CacheOption that specifies that entries listing
+// more than one key for the same index should be rejected.  Such an
+// entry returned by a factory function is replaced by an entry with
+// the ErrConflictingKeys error, and passing such an entry to ByEntry
+// causes the lookup to return ErrConflictingKeys.  By default, such
+// entries are indexed under all the listed keys.
+var StrictKeys strictKeysOption = true
+
+// sharedFactoryOption is a CacheOption that specifies a factory
+// function shared by several indexes.
+type sharedFactoryOption struct {
+	factory Factory       // The shared factory
+	indexes []interface{} // The indexes sharing the factory
+}
+
+// apply applies the option.
+func (opt sharedFactoryOption) apply(o *cacheOptions) {
+	if o.factories == nil {
+		o.factories = map[interface{}]Factory{}
+	}
+
+	for _, index := range opt.indexes {
+		o.factories[index] = opt.factory
+	}
+}
+
+// SharedFactory is a CacheOption that specifies a single factory
+// function to be used by several indexes.  The factory is used by
+// each of the named indexes that does not specify its own Factory;
+// since the factory is passed the Key, which includes the index, it
+// may determine which index triggered the call.  If an index is named
+// by more than one SharedFactory option, the last one applies.
+func SharedFactory(factory Factory, indexes ...interface{}) CacheOption {
+	return sharedFactoryOption{
+		factory: factory,
+		indexes: indexes,
+	}
+}
+
+// IndexMaker describes a function that may be used to construct an
+// index on demand.  It is passed the key describing the index, and
+// must return the Index and a boolean true value, or a boolean false
+// value if no such index should exist.  The Index field of the
+// returned Index is ignored.
+type IndexMaker func(index interface{}) (Index, bool)
+
+// lazyIndexesOption is a CacheOption that specifies a function to
+// construct indexes on demand.
+type lazyIndexesOption struct {
+	maker IndexMaker // The index maker
+}
+
+// apply applies the option.
+func (opt lazyIndexesOption) apply(o *cacheOptions) {
+	o.maker = opt.maker
+}
+
+// LazyIndexes is a CacheOption that specifies an IndexMaker to be
+// called to construct an index the first time a lookup references an
+// index that does not exist.  The index is constructed with the cache
+// locked, so the IndexMaker is called only once for each index; it
+// must not call any methods of the cache.  Indexes that do not define
+// a factory function may obtain one from the SharedFactory option.
+// Only Lookup and its variants, Reserve, and WaitFor construct
+// indexes; other methods, such as Inspect and Evict, return
+// ErrBadIndex for an index that has not yet been constructed, and
+// LookupAny treats such an index as a miss.
+func LazyIndexes(maker IndexMaker) CacheOption {
+	return lazyIndexesOption{
+		maker: maker,
+	}
+}
+
+// maxPendingOption is a CacheOption that specifies the maximum number
+// of pending entries in the cache.
+type maxPendingOption int
+
+// apply simply applies the option.
+func (opt maxPendingOption) apply(o *cacheOptions) {
+	o.maxPending = int(opt)
+}
+
+// MaxPending is a CacheOption that specifies the maximum number of
+// pending entries in the cache.  Once the limit is reached, lookups
+// that would add another pending entry to the cache fail with
+// ErrTooManyPending until some pending entries are completed.
+// Completed entries do not count against the limit.  A limit of 0,
+// the default, means there is no limit.
+func MaxPending(n int) CacheOption {
+	return maxPendingOption(n)
+}
+
+// serveStaleOnErrorOption is a CacheOption that specifies that stale
+// content should be kept if a refresh fails.
+type serveStaleOnErrorOption bool
+
+// apply simply applies the option.
+func (opt serveStaleOnErrorOption) apply(o *cacheOptions) {
+	o.serveStale = bool(opt)
+}
+
+// ServeStaleOnError is a CacheOption that specifies that, if the
+// factory function called to refresh a stale entry returns an error
+// that would not be cached, the stale content should be kept rather
+// than removed from the cache.  The entry remains stale, so a later
+// lookup will again attempt to refresh it.  Such failed refreshes are
+// counted in the StaleServed statistic.
+var ServeStaleOnError serveStaleOnErrorOption = true
+
+// SlowFactoryFunc describes a function that may be called when a
+// factory function call has been running for longer than a threshold.
+// It is passed the key that triggered the factory call and the time
+// the call has been running.  See TrackFactories.
+type SlowFactoryFunc func(key Key, elapsed time.Duration)
+
+// trackFactoriesOption is a CacheOption that specifies that factory
+// function calls should be tracked.
+type trackFactoriesOption struct {
+	threshold time.Duration   // Threshold for slow factory calls
+	onSlow    SlowFactoryFunc // Called for slow factory calls
+}
+
+// apply applies the option.
+func (opt trackFactoriesOption) apply(o *cacheOptions) {
+	o.track = true
+	o.slowAfter = opt.threshold
+	o.onSlow = opt.onSlow
+}
+
+// TrackFactories is a CacheOption that specifies that the factory
+// function calls in progress should be tracked.  The number of calls
+// in progress and the time the oldest of them has been running may
+// be retrieved using the Stats method.  If threshold is greater than
+// 0, each call still running after that long is counted in the
+// SlowFactories statistic, and onSlow, if not nil, is called in a
+// separate goroutine.  This may be used to detect factory functions
+// that never return, such as those that ignore the cancellation of
+// their context.
+func TrackFactories(threshold time.Duration, onSlow SlowFactoryFunc) CacheOption {
+	return trackFactoriesOption{
+		threshold: threshold,
+		onSlow:    onSlow,
+	}
+}
+
+// Reasons that may be passed to a RejectFunc.
+const (
+	RejectMaxPending = "MaxPending" // The MaxPending limit was reached
 )
+
+// RejectFunc describes a function that may be called when an operation
+// is rejected because a configured limit has been reached.  It is
+// passed the reason, which identifies the limit, and the key involved.
+// See OnReject.
+type RejectFunc func(reason string, key Key)
+
+// onRejectOption is a CacheOption that specifies a function to call
+// when an operation is rejected due to a configured limit.
+type onRejectOption struct {
+	fn RejectFunc // The function to call
+}
+
+// apply applies the option.
+func (opt onRejectOption) apply(o *cacheOptions) {
+	o.onReject = opt.fn
+}
+
+// OnReject is a CacheOption that specifies a function to be called
+// whenever an operation is rejected because a configured limit, such
+// as the MaxPending limit, has been reached.  The function is called
+// in a separate goroutine, and is passed one of the Reject constants,
+// such as RejectMaxPending, identifying the limit, and the key
+// involved.  This may be used to alert operators that the cache is
+// saturated.
+func OnReject(fn RejectFunc) CacheOption {
+	return onRejectOption{
+		fn: fn,
+	}
+}
+
+// coalesceMutationsOption is a CacheOption that specifies that
+// identical concurrent mutations should be coalesced.
+type coalesceMutationsOption bool
+
+// apply simply applies the option.
+func (opt coalesceMutationsOption) apply(o *cacheOptions) {
+	o.coalesce = bool(opt)
+}
+
+// CoalesceMutations is a CacheOption that specifies that identical
+// calls to Evict or Reindex made concurrently should be coalesced.  A
+// call that is still waiting for the cache lock when an identical
+// call is made is shared by both callers, which both receive its
+// result; calls that have already acquired the cache lock are never
+// shared, so the effect of each call is always observed after the
+// call is made.  Calls are identical if they have the same key and,
+// for Reindex, the same new keys.  Keys whose values may not be
+// compared, such as those only usable with a KeyHasher, are never
+// coalesced.  This reduces lock traffic under heavy invalidation, at
+// the cost of some bookkeeping for every call.
+var CoalesceMutations coalesceMutationsOption = true
+
+// autoCancelOption is a CacheOption that specifies that factory calls
+// should be canceled once no callers are waiting on them.
+type autoCancelOption bool
+
+// apply simply applies the option.
+func (opt autoCancelOption) apply(o *cacheOptions) {
+	o.autoCancel = bool(opt)
+}
+
+// AutoCancel is a CacheOption that specifies that, when the last
+// Future waiting on a pending entry is canceled, the factory call for
+// the entry should be canceled, by canceling the context passed to
+// it, and the pending entry removed from the cache.  This reclaims
+// work that no caller wants any longer.  Note that Lookup cancels its
+// Future when it returns, so a Lookup that gives up because its
+// context was canceled also cancels the factory call, unless another
+// caller is waiting on it.  Entries looked up by Preload, entries
+// with callbacks registered by OnCompleteKey, entries waited on by
+// futures sharing a notification channel (see SharedNotify), and
+// entries waiting on a group factory are never canceled in this way.
+var AutoCancel autoCancelOption = true
@@ -17,9 +17,12 @@ package fcache
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/klmitch/patcher"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type mockLookupOption struct {
@@ -85,6 +88,19 @@ func TestProcLookupOptsNoKey(t *testing.T) {
 	opt2.AssertExpectations(t)
 }
 
+func TestProcLookupOptsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result, err := procLookupOpts([]LookupOption{
+		ByKey(Key{"one", 1}),
+		WithContext(ctx),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, ctx, result.ctx)
+}
+
 func TestByEntryOptionImplementsLookupOption(t *testing.T) {
 	assert.Implements(t, (*LookupOption)(nil), &byEntryOption{})
 }
@@ -129,6 +145,20 @@ func TestByEntryOptionApplyDuplicateOption(t *testing.T) {
 	}, o)
 }
 
+func TestByEntryOptionApplyNoKeys(t *testing.T) {
+	o := &lookupOptions{}
+	obj := byEntryOption{
+		Ent: Entry{
+			Object: "object",
+		},
+	}
+
+	err := obj.apply(o)
+
+	assert.Same(t, ErrNoKeys, err)
+	assert.Equal(t, &lookupOptions{}, o)
+}
+
 func TestByEntry(t *testing.T) {
 	ent := Entry{
 		Error: assert.AnError,
@@ -202,6 +232,180 @@ func TestSearchCacheOptionApply(t *testing.T) {
 	}, o)
 }
 
+func TestOverwriteOptionImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), Overwrite)
+}
+
+func TestOverwriteOptionApply(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := Overwrite.apply(o)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &lookupOptions{
+		overwrite: true,
+	}, o)
+}
+
+func TestKeepWarmingOptionImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), KeepWarming)
+}
+
+func TestKeepWarmingOptionApply(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := KeepWarming.apply(o)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &lookupOptions{
+		keepWarm: true,
+	}, o)
+}
+
+func TestBoundFactoryOptionImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), BoundFactory)
+}
+
+func TestBoundFactoryOptionApply(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := BoundFactory.apply(o)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &lookupOptions{
+		bound: true,
+	}, o)
+}
+
+func TestDeriveFactoryContextOptionImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), DeriveFactoryContext)
+}
+
+func TestDeriveFactoryContextOptionApply(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := DeriveFactoryContext.apply(o)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &lookupOptions{
+		derive: true,
+	}, o)
+}
+
+func TestIfVersionImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), IfVersion(3))
+}
+
+func TestIfVersionApply(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := IfVersion(3).apply(o)
+
+	assert.NoError(t, err)
+	require.NotNil(t, o.version)
+	assert.Equal(t, uint64(3), *o.version)
+}
+
+func TestIfObjectImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), IfObject("object", nil))
+}
+
+func TestIfObjectApplyBase(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := IfObject("object", nil).apply(o)
+
+	assert.NoError(t, err)
+	require.NotNil(t, o.expect)
+	assert.Equal(t, "object", o.expect.object)
+	require.NotNil(t, o.expect.equal)
+	assert.True(t, o.expect.equal([]int{1}, []int{1}))
+	assert.False(t, o.expect.equal([]int{1}, []int{2}))
+}
+
+func TestIfObjectApplyEqual(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := IfObject("object", func(a, b interface{}) bool {
+		return true
+	}).apply(o)
+
+	assert.NoError(t, err)
+	require.NotNil(t, o.expect)
+	assert.Equal(t, "object", o.expect.object)
+	assert.True(t, o.expect.equal(1, 2))
+}
+
+func TestMaxAgeOptionApply(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := maxAgeOption(time.Second).apply(o)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &lookupOptions{
+		maxAge: time.Second,
+	}, o)
+}
+
+func TestLookupOptionsTooOldUnset(t *testing.T) {
+	o := lookupOptions{}
+
+	result := o.tooOld(&Entry{})
+
+	assert.False(t, result)
+}
+
+func TestLookupOptionsTooOldPending(t *testing.T) {
+	o := lookupOptions{
+		maxAge: time.Second,
+	}
+
+	result := o.tooOld(nil)
+
+	assert.False(t, result)
+}
+
+func TestLookupOptionsTooOldFresh(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	o := lookupOptions{
+		maxAge: 10 * time.Second,
+	}
+
+	result := o.tooOld(&Entry{
+		CreatedAt: time.Unix(995, 0),
+	})
+
+	assert.False(t, result)
+}
+
+func TestLookupOptionsTooOldExpired(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	o := lookupOptions{
+		maxAge: 10 * time.Second,
+	}
+
+	result := o.tooOld(&Entry{
+		CreatedAt: time.Unix(990, 0),
+	})
+
+	assert.True(t, result)
+}
+
+func TestForceRefreshOptionImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), ForceRefresh)
+}
+
+func TestForceRefreshOptionApply(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := ForceRefresh.apply(o)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &lookupOptions{
+		force: true,
+	}, o)
+}
+
 func TestWithContextOptionImplementsLookupOption(t *testing.T) {
 	assert.Implements(t, (*LookupOption)(nil), &withContextOption{})
 }
@@ -243,6 +447,174 @@ func TestWithContext(t *testing.T) {
 	assert.Same(t, ctx, result.(withContextOption).Ctx)
 }
 
+func TestWithTimeoutOptionImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), WithTimeout(time.Second))
+}
+
+func TestWithTimeoutOptionApplyBase(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := WithTimeout(time.Second).apply(o)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &lookupOptions{
+		timeout: time.Second,
+	}, o)
+}
+
+func TestWithTimeoutOptionApplyDuplicateOption(t *testing.T) {
+	o := &lookupOptions{
+		timeout: time.Second,
+	}
+
+	err := WithTimeout(time.Minute).apply(o)
+
+	assert.Same(t, ErrDuplicateOption, err)
+	assert.Equal(t, time.Second, o.timeout)
+}
+
+func TestLookupOptionsApplyTimeoutUnset(t *testing.T) {
+	ctx := context.Background()
+	o := &lookupOptions{
+		ctx: ctx,
+	}
+
+	cancel := o.applyTimeout()
+	cancel()
+
+	assert.Equal(t, ctx, o.ctx)
+}
+
+func TestLookupOptionsApplyTimeoutSet(t *testing.T) {
+	o := &lookupOptions{
+		ctx:     context.Background(),
+		timeout: time.Hour,
+	}
+
+	cancel := o.applyTimeout()
+
+	_, ok := o.ctx.Deadline()
+	assert.True(t, ok)
+	cancel()
+	assert.Same(t, context.Canceled, o.ctx.Err())
+}
+
+func TestLookupOptionsApplyTimeoutShorterContext(t *testing.T) {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer ctxCancel()
+	expected, _ := ctx.Deadline()
+	o := &lookupOptions{
+		ctx:     ctx,
+		timeout: time.Hour,
+	}
+
+	cancel := o.applyTimeout()
+	defer cancel()
+
+	deadline, ok := o.ctx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, expected, deadline)
+}
+
+func TestDryRunOptionImplementsCleanOption(t *testing.T) {
+	assert.Implements(t, (*CleanOption)(nil), DryRun)
+}
+
+func TestDryRunOptionApply(t *testing.T) {
+	o := &cleanOptions{}
+
+	DryRun.apply(o)
+
+	assert.Equal(t, &cleanOptions{
+		dryRun: true,
+	}, o)
+}
+
+func TestProcContentsOptsBase(t *testing.T) {
+	result := procContentsOpts([]ContentsOption{ContentsIncludePending})
+
+	assert.Equal(t, contentsOptions{
+		pending: true,
+	}, result)
+}
+
+func TestProcContentsOptsNoOptions(t *testing.T) {
+	result := procContentsOpts(nil)
+
+	assert.Equal(t, contentsOptions{}, result)
+}
+
+func TestIncludePendingOptionImplementsContentsOption(t *testing.T) {
+	assert.Implements(t, (*ContentsOption)(nil), ContentsIncludePending)
+}
+
+func TestIncludePendingOptionApply(t *testing.T) {
+	o := &contentsOptions{}
+
+	ContentsIncludePending.apply(o)
+
+	assert.Equal(t, &contentsOptions{
+		pending: true,
+	}, o)
+}
+
+func TestWithFactoryOptionImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), &withFactoryOption{})
+}
+
+func TestWithFactoryOptionApplyBase(t *testing.T) {
+	o := &lookupOptions{}
+	obj := withFactoryOption{
+		Factory: factory,
+	}
+
+	err := obj.apply(o)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, o.factory)
+}
+
+func TestWithFactoryOptionApplyDuplicateOption(t *testing.T) {
+	o := &lookupOptions{
+		factory: factory,
+	}
+	obj := withFactoryOption{
+		Factory: factory,
+	}
+
+	err := obj.apply(o)
+
+	assert.Same(t, ErrDuplicateOption, err)
+	assert.NotNil(t, o.factory)
+}
+
+func TestWithFactory(t *testing.T) {
+	result := WithFactory(factory)
+
+	assert.NotNil(t, result.(withFactoryOption).Factory)
+}
+
+func TestParallelismOptionImplementsLookupOption(t *testing.T) {
+	assert.Implements(t, (*LookupOption)(nil), parallelismOption(0))
+}
+
+func TestParallelismOptionApply(t *testing.T) {
+	o := &lookupOptions{}
+
+	err := parallelismOption(5).apply(o)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &lookupOptions{
+		parallel: 5,
+	}, o)
+}
+
+func TestParallelism(t *testing.T) {
+	result := Parallelism(5)
+
+	assert.Equal(t, parallelismOption(5), result)
+}
+
 type mockCleanOption struct {
 	mock.Mock
 }
@@ -274,6 +646,26 @@ func TestProcCleanOptsNoOptions(t *testing.T) {
 	}, result)
 }
 
+func TestProcCleanOptsDryRun(t *testing.T) {
+	result := procCleanOpts([]CleanOption{DryRun})
+
+	assert.Equal(t, cleanOptions{
+		objects: true,
+		errors:  true,
+		pending: true,
+		dryRun:  true,
+	}, result)
+}
+
+func TestProcCleanOptsDryRunObjects(t *testing.T) {
+	result := procCleanOpts([]CleanOption{DryRun, Objects})
+
+	assert.Equal(t, cleanOptions{
+		objects: true,
+		dryRun:  true,
+	}, result)
+}
+
 func TestObjectsOptionImplementsCleanOption(t *testing.T) {
 	assert.Implements(t, (*CleanOption)(nil), Objects)
 }
@@ -315,3 +707,189 @@ func TestPendingOptionApply(t *testing.T) {
 		pending: true,
 	}, o)
 }
+
+type mockCacheOption struct {
+	mock.Mock
+}
+
+func (m *mockCacheOption) apply(o *cacheOptions) {
+	m.MethodCalled("apply", o)
+}
+
+func TestProcCacheOpts(t *testing.T) {
+	opt1 := &mockCacheOption{}
+	opt1.On("apply", &cacheOptions{})
+	opt2 := &mockCacheOption{}
+	opt2.On("apply", &cacheOptions{})
+
+	result := procCacheOpts([]CacheOption{opt1, opt2})
+
+	assert.Equal(t, cacheOptions{}, result)
+	opt1.AssertExpectations(t)
+	opt2.AssertExpectations(t)
+}
+
+func TestInstrumentLockOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), InstrumentLock)
+}
+
+func TestInstrumentLockOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	InstrumentLock.apply(o)
+
+	assert.Equal(t, &cacheOptions{
+		instrument: true,
+	}, o)
+}
+
+func TestSharedNotifyOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), SharedNotify)
+}
+
+func TestSharedNotifyOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	SharedNotify.apply(o)
+
+	assert.Equal(t, &cacheOptions{
+		sharedNotify: true,
+	}, o)
+}
+
+func TestStrictKeysOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), StrictKeys)
+}
+
+func TestStrictKeysOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	StrictKeys.apply(o)
+
+	assert.Equal(t, &cacheOptions{
+		strict: true,
+	}, o)
+}
+
+func TestSharedFactoryOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), SharedFactory(factory))
+}
+
+func TestSharedFactoryOptionApply(t *testing.T) {
+	o := &cacheOptions{
+		factories: map[interface{}]Factory{
+			"one": nil,
+		},
+	}
+
+	SharedFactory(factory, "one", "two").apply(o)
+
+	assert.Len(t, o.factories, 2)
+	assert.NotNil(t, o.factories["one"])
+	assert.NotNil(t, o.factories["two"])
+}
+
+func TestSharedFactoryOptionApplyNilMap(t *testing.T) {
+	o := &cacheOptions{}
+
+	SharedFactory(factory, "one").apply(o)
+
+	assert.Len(t, o.factories, 1)
+	assert.NotNil(t, o.factories["one"])
+}
+
+func TestLazyIndexesOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), LazyIndexes(nil))
+}
+
+func TestLazyIndexesOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	LazyIndexes(func(index interface{}) (Index, bool) {
+		return Index{}, false
+	}).apply(o)
+
+	assert.NotNil(t, o.maker)
+}
+
+func TestMaxPendingOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), MaxPending(5))
+}
+
+func TestMaxPendingOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	MaxPending(5).apply(o)
+
+	assert.Equal(t, &cacheOptions{
+		maxPending: 5,
+	}, o)
+}
+
+func TestServeStaleOnErrorOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), ServeStaleOnError)
+}
+
+func TestServeStaleOnErrorOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	ServeStaleOnError.apply(o)
+
+	assert.Equal(t, &cacheOptions{
+		serveStale: true,
+	}, o)
+}
+
+func TestTrackFactoriesOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), TrackFactories(0, nil))
+}
+
+func TestTrackFactoriesOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	TrackFactories(time.Second, func(key Key, elapsed time.Duration) {}).apply(o)
+
+	assert.True(t, o.track)
+	assert.Equal(t, time.Second, o.slowAfter)
+	assert.NotNil(t, o.onSlow)
+}
+
+func TestOnRejectOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), OnReject(nil))
+}
+
+func TestOnRejectOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	OnReject(func(reason string, key Key) {}).apply(o)
+
+	assert.NotNil(t, o.onReject)
+}
+
+func TestCoalesceMutationsOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), CoalesceMutations)
+}
+
+func TestCoalesceMutationsOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	CoalesceMutations.apply(o)
+
+	assert.Equal(t, &cacheOptions{
+		coalesce: true,
+	}, o)
+}
+
+func TestAutoCancelOptionImplementsCacheOption(t *testing.T) {
+	assert.Implements(t, (*CacheOption)(nil), AutoCancel)
+}
+
+func TestAutoCancelOptionApply(t *testing.T) {
+	o := &cacheOptions{}
+
+	AutoCancel.apply(o)
+
+	assert.Equal(t, &cacheOptions{
+		autoCancel: true,
+	}, o)
+}
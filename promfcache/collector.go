@@ -0,0 +1,132 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package promfcache exports the statistics of an fcache.FCache as
+// Prometheus metrics.  It is a separate module, so that users of the
+// fcache package that do not use Prometheus need not depend on the
+// Prometheus client library.
+package promfcache
+
+import (
+	"fmt"
+
+	"github.com/klmitch/fcache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector that exports the statistics of
+// a cache.  The metrics are computed from the cache statistics each
+// time the collector is scraped.
+type Collector struct {
+	fc *fcache.FCache // The cache to collect metrics from
+
+	hits              *prometheus.Desc
+	misses            *prometheus.Desc
+	searchMisses      *prometheus.Desc
+	staleServed       *prometheus.Desc
+	explicitEvictions *prometheus.Desc
+	implicitEvictions *prometheus.Desc
+	lockAcquisitions  *prometheus.Desc
+	lockContentions   *prometheus.Desc
+	lockWait          *prometheus.Desc
+	factoriesRunning  *prometheus.Desc
+	oldestFactory     *prometheus.Desc
+	slowFactories     *prometheus.Desc
+	factoryLatency    *prometheus.Desc
+	entries           *prometheus.Desc
+}
+
+// NewCollector constructs a Collector for the specified cache.  The
+// namespace is prepended to the names of the metrics, and constLabels
+// are added to every metric; this allows the collectors of several
+// caches to be registered with the same registry.  The indexes of the
+// cache are identified by the "index" label of the entries metric,
+// formatted with the %#v verb of fmt, so that index keys of different
+// types, such as 1 and "1", have different labels.  Note that the lock
+// and factory statistics are only recorded if the cache was constructed
+// with the InstrumentLock and TrackFactories options, respectively.
+func NewCollector(fc *fcache.FCache, namespace string, constLabels prometheus.Labels) *Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "fcache", name), help, labels, constLabels)
+	}
+
+	return &Collector{
+		fc:                fc,
+		hits:              desc("hits_total", "Number of lookups that hit."),
+		misses:            desc("misses_total", "Number of lookups that missed."),
+		searchMisses:      desc("search_misses_total", "Number of cache-only lookups that missed."),
+		staleServed:       desc("stale_served_total", "Number of failed refreshes that kept stale content."),
+		explicitEvictions: desc("explicit_evictions_total", "Number of entries evicted explicitly."),
+		implicitEvictions: desc("implicit_evictions_total", "Number of entries evicted by the cache itself."),
+		lockAcquisitions:  desc("lock_acquisitions_total", "Number of times the cache lock was acquired."),
+		lockContentions:   desc("lock_contentions_total", "Number of cache lock acquisitions that waited."),
+		lockWait:          desc("lock_wait_seconds_total", "Total time spent acquiring the cache lock."),
+		factoriesRunning:  desc("factories_running", "Number of factory calls in progress."),
+		oldestFactory:     desc("oldest_factory_seconds", "Running time of the oldest factory call in progress."),
+		slowFactories:     desc("slow_factories_total", "Number of factory calls that exceeded the slow threshold."),
+		factoryLatency:    desc("factory_latency_seconds", "Latency of completed factory calls."),
+		entries:           desc("entries", "Number of entries in an index.", "index", "state"),
+	}
+}
+
+// Describe sends the descriptors of the metrics to the channel.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.searchMisses
+	ch <- c.staleServed
+	ch <- c.explicitEvictions
+	ch <- c.implicitEvictions
+	ch <- c.lockAcquisitions
+	ch <- c.lockContentions
+	ch <- c.lockWait
+	ch <- c.factoriesRunning
+	ch <- c.oldestFactory
+	ch <- c.slowFactories
+	ch <- c.factoryLatency
+	ch <- c.entries
+}
+
+// Collect sends the current values of the metrics to the channel.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.fc.Stats()
+	counter := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v)
+	}
+	gauge := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v)
+	}
+
+	counter(c.hits, float64(stats.Hits))
+	counter(c.misses, float64(stats.Misses))
+	counter(c.searchMisses, float64(stats.SearchMisses))
+	counter(c.staleServed, float64(stats.StaleServed))
+	counter(c.explicitEvictions, float64(stats.ExplicitEvictions))
+	counter(c.implicitEvictions, float64(stats.ImplicitEvictions))
+	counter(c.lockAcquisitions, float64(stats.LockAcquisitions))
+	counter(c.lockContentions, float64(stats.LockContentions))
+	counter(c.lockWait, stats.LockWait.Seconds())
+	gauge(c.factoriesRunning, float64(stats.FactoriesRunning))
+	gauge(c.oldestFactory, stats.OldestFactory.Seconds())
+	counter(c.slowFactories, float64(stats.SlowFactories))
+	ch <- prometheus.MustNewConstSummary(c.factoryLatency, stats.FactoryCalls, stats.FactoryTime.Seconds(), nil)
+
+	// Report the entries in each index
+	for idx, size := range c.fc.SizeByIndex() {
+		name := fmt.Sprintf("%#v", idx)
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(size.Completed-size.Errors), name, "object")
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(size.Errors), name, "error")
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(size.Pending), name, "pending")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package promfcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/klmitch/fcache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func factory(ctx context.Context, key fcache.Key) *fcache.Entry {
+	return &fcache.Entry{
+		Object: "object",
+		Keys:   []fcache.Key{key},
+	}
+}
+
+func TestCollector(t *testing.T) {
+	fc, err := fcache.New(fcache.Index{
+		Index:   1,
+		Factory: factory,
+	}, fcache.Index{
+		Index:   "1",
+		Factory: factory,
+	})
+	require.NoError(t, err)
+	_, err = fc.Lookup(fcache.ByKey(fcache.Key{Index: 1, Key: 1}))
+	require.NoError(t, err)
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(NewCollector(fc, "test", prometheus.Labels{"cache": "c"})))
+
+	families, err := reg.Gather()
+
+	require.NoError(t, err)
+	values := map[string]float64{}
+	entries := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			switch {
+			case m.Counter != nil:
+				values[family.GetName()] = m.Counter.GetValue()
+			case m.Summary != nil:
+				values[family.GetName()] = float64(m.Summary.GetSampleCount())
+			case family.GetName() == "test_fcache_entries":
+				labels := map[string]string{}
+				for _, l := range m.Label {
+					labels[l.GetName()] = l.GetValue()
+				}
+				assert.Equal(t, "c", labels["cache"])
+				entries[labels["index"]+"/"+labels["state"]] = m.Gauge.GetValue()
+			}
+		}
+	}
+	assert.Equal(t, float64(1), values["test_fcache_misses_total"])
+	assert.Equal(t, float64(0), values["test_fcache_hits_total"])
+	assert.Contains(t, values, "test_fcache_implicit_evictions_total")
+	assert.Equal(t, map[string]float64{
+		`1/object`:    1,
+		`1/error`:     0,
+		`1/pending`:   0,
+		`"1"/object`:  0,
+		`"1"/error`:   0,
+		`"1"/pending`: 0,
+	}, entries)
+}
@@ -0,0 +1,11 @@
+module github.com/klmitch/fcache/promfcache
+
+go 1.15
+
+require (
+	github.com/klmitch/fcache v0.0.0-20261017190212-c4e9c0399464
+	github.com/prometheus/client_golang v1.8.0
+	github.com/stretchr/testify v1.6.1
+)
+
+replace github.com/klmitch/fcache => ../
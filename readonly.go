@@ -0,0 +1,126 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+// ReadOnlyCache is a read-only view of an FCache, returned by the
+// ReadOnly method.  Lookups through the view only search the cache,
+// as if the SearchCache option had been passed, so the index factory
+// functions are never invoked; the methods that would alter the cache
+// return ErrReadOnly.  Lookups through the view do not alter the cache
+// either: expired retryable errors are treated as misses without being
+// evicted, and indexes are not constructed by the LazyIndexes option.
+type ReadOnlyCache struct {
+	fc *FCache // The underlying cache
+}
+
+// ReadOnly returns a read-only view of the cache.  This may be passed
+// to code that should be able to look up entries in the cache, but
+// not trigger factory functions or otherwise alter the cache.
+func (fc *FCache) ReadOnly() *ReadOnlyCache {
+	return &ReadOnlyCache{
+		fc: fc,
+	}
+}
+
+// options processes the lookup options for the view.  The ByEntry
+// option is rejected with ErrReadOnly, since it would insert an entry
+// into the cache.
+func (r *ReadOnlyCache) options(opts []LookupOption) (lookupOptions, error) {
+	o, err := procLookupOpts(opts)
+	if err != nil {
+		return lookupOptions{}, err
+	}
+
+	// Don't allow entries to be inserted
+	if o.ent != nil {
+		return lookupOptions{}, ErrReadOnly
+	}
+	o.only = true
+	o.readOnly = true
+
+	return o, nil
+}
+
+// Lookup looks up a completed entry in the cache and returns it.  It
+// is similar to FCache.Lookup with the SearchCache option.
+func (r *ReadOnlyCache) Lookup(opts ...LookupOption) (interface{}, error) {
+	// Process the options
+	o, err := r.options(opts)
+	if err != nil {
+		return nil, err
+	}
+	cancel := o.applyTimeout()
+	defer cancel()
+
+	// Perform the lookup
+	f, err := r.fc.lookup(o)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait on the future
+	defer f.Cancel()
+	return f.WaitWithContext(o.ctx)
+}
+
+// LookupFuture looks up a completed entry in the cache and returns a
+// Future.  It is similar to FCache.LookupFuture with the SearchCache
+// option.
+func (r *ReadOnlyCache) LookupFuture(opts ...LookupOption) (*Future, error) {
+	// Process the options
+	o, err := r.options(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Perform the lookup and return the future
+	return r.fc.lookup(o)
+}
+
+// Inspect looks up a completed entry in the cache and returns a copy
+// of it.  See FCache.Inspect.
+func (r *ReadOnlyCache) Inspect(opts ...LookupOption) (Entry, error) {
+	return r.fc.Inspect(opts...)
+}
+
+// Contents returns all completed entries in the specified cache
+// index.  See FCache.Contents.
+func (r *ReadOnlyCache) Contents(index interface{}, opts ...ContentsOption) ([]Entry, error) {
+	return r.fc.Contents(index, opts...)
+}
+
+// Stats returns a copy of the statistics about the cache.  See
+// FCache.Stats.
+func (r *ReadOnlyCache) Stats() Stats {
+	return r.fc.Stats()
+}
+
+// Evict is disabled for a read-only view, and always returns
+// ErrReadOnly.
+func (r *ReadOnlyCache) Evict(opts ...LookupOption) error {
+	return ErrReadOnly
+}
+
+// Clean is disabled for a read-only view, and always returns
+// ErrReadOnly.
+func (r *ReadOnlyCache) Clean(opts ...CleanOption) error {
+	return ErrReadOnly
+}
+
+// Reindex is disabled for a read-only view, and always returns
+// ErrReadOnly.
+func (r *ReadOnlyCache) Reindex(newKeys []Key, opts ...LookupOption) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/klmitch/patcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFCacheReadOnly(t *testing.T) {
+	obj := &FCache{}
+
+	result := obj.ReadOnly()
+
+	assert.Same(t, obj, result.fc)
+}
+
+func TestReadOnlyCacheLookup(t *testing.T) {
+	calls := 0
+	fc, err := New(Index{
+		Index: "one",
+		Factory: func(ctx context.Context, key Key) *Entry {
+			calls++
+			return &Entry{
+				Object: "object",
+				Keys:   []Key{key},
+			}
+		},
+	})
+	require.NoError(t, err)
+	_, err = fc.Lookup(ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+	obj := fc.ReadOnly()
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	result, err = obj.Lookup(ByKey(Key{"one", 2}))
+	assert.Same(t, ErrNotCached, err)
+	assert.Nil(t, result)
+	f, err := obj.LookupFuture(ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+	result, err = f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	ent, err := obj.Inspect(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "object", ent.Object)
+	ents, err := obj.Contents("one")
+	assert.NoError(t, err)
+	assert.Len(t, ents, 1)
+	assert.Equal(t, uint64(2), obj.Stats().Hits)
+	assert.Equal(t, 1, calls)
+}
+
+func TestReadOnlyCacheLookupByEntry(t *testing.T) {
+	obj := (&FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}).ReadOnly()
+
+	result, err := obj.Lookup(ByEntry(Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}))
+	assert.Same(t, ErrReadOnly, err)
+	assert.Nil(t, result)
+	f, err := obj.LookupFuture(ByEntry(Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 1}},
+	}))
+	assert.Same(t, ErrReadOnly, err)
+	assert.Nil(t, f)
+	assert.Len(t, obj.fc.indexes["one"].entries, 0)
+}
+
+func TestReadOnlyCacheLookupBadOption(t *testing.T) {
+	obj := (&FCache{}).ReadOnly()
+
+	result, err := obj.Lookup()
+	assert.Same(t, ErrNoKey, err)
+	assert.Nil(t, result)
+}
+
+func TestReadOnlyCacheLookupBadIndex(t *testing.T) {
+	obj := (&FCache{
+		indexes: map[interface{}]index{},
+	}).ReadOnly()
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestReadOnlyCacheLookupExpired(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	ent := &entry{
+		content: &Entry{
+			Error: &RetryableError{assert.AnError, time.Unix(999, 0)},
+			Keys:  []Key{{"one", 1}},
+		},
+	}
+	obj := (&FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}).ReadOnly()
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.Same(t, ErrNotCached, err)
+	assert.Nil(t, result)
+	assert.Equal(t, map[interface{}]*entry{1: ent}, obj.fc.indexes["one"].entries)
+}
+
+func TestReadOnlyCacheLookupLazyIndex(t *testing.T) {
+	fc, err := NewWithOptions(nil, LazyIndexes(func(index interface{}) (Index, bool) {
+		t.Fail()
+		return Index{Factory: factory}, true
+	}))
+	require.NoError(t, err)
+	obj := fc.ReadOnly()
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+	assert.Len(t, fc.indexes, 0)
+}
+
+func TestReadOnlyCacheMutators(t *testing.T) {
+	obj := (&FCache{}).ReadOnly()
+
+	assert.Same(t, ErrReadOnly, obj.Evict(ByKey(Key{"one", 1})))
+	assert.Same(t, ErrReadOnly, obj.Clean())
+	assert.Same(t, ErrReadOnly, obj.Reindex([]Key{{"one", 2}}, ByKey(Key{"one", 1})))
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import "context"
+
+// startRefresh starts a background refresh of a completed entry.  If
+// a refresh is already in progress, no new refresh is started.
+// Returns the pending entry that will be completed with the results
+// of the refresh, or nil if the entry was refreshed less than the
+// index's RefreshInterval ago.  The cache MUST be locked upon entry
+// to this method.
+func (fc *FCache) startRefresh(ent *entry, key Key, factory Factory) *entry {
+	// Don't start a second refresh
+	if ent.next != nil {
+		return ent.next
+	}
+
+	// Don't refresh too often
+	if idx, ok := fc.indexes[key.Index]; ok && idx.refreshEvery > 0 && !ent.refresh.IsZero() && now().Sub(ent.refresh) < idx.refreshEvery {
+		return nil
+	}
+
+	// Construct the pending entry
+	var ctx context.Context
+	ent.next, ctx = newEntry()
+
+	// Refresh the entry
+	go fc.refresh(ctx, ent, key, factory)
+
+	return ent.next
+}
+
+// refresh calls the factory function to refresh an entry.  It MUST be
+// called as a goroutine.  It will invoke the factory, then lock the
+// mutex and replace the entry in the cache, provided the entry has not
+// been removed from the cache in the meantime.
+func (fc *FCache) refresh(ctx context.Context, ent *entry, key Key, factory Factory) {
+	// Invoke the factory
+	run := fc.startFactory(key)
+	content := factory(ctx, key)
+	if content == nil {
+		content = &Entry{
+			Error: ErrFactoryNil,
+			Keys:  []Key{key},
+		}
+	}
+
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+	fc.endFactory(run)
+
+	// Replace the entry if it's still in the cache, keeping the
+	// stale content on error if requested
+	if idx, ok := fc.indexes[key.Index]; ok && idx.entries[idx.hash(key.Key)] == ent {
+		if fc.serveStale && !isCacheable(content.Error) {
+			fc.stats.StaleServed++
+			content = ent.content
+			ent.refresh = now()
+		} else if newE := fc.replace(ent, content); newE != nil {
+			newE.refresh = now()
+		}
+	}
+
+	// Complete the pending refresh
+	next := ent.next
+	ent.next = nil
+	next.complete(content)
+}
+
+// replace replaces a completed entry in the cache with new content.
+// The keys referring to the entry are removed from the cache, as if it
+// had been evicted, then the new content is inserted, replacing any
+// other completed entries cached under its keys.  The cache MUST be
+// locked upon entry to this method.
+func (fc *FCache) replace(ent *entry, content *Entry) *entry {
+	// Remove the old entry
+	for _, k := range ent.content.Keys {
+		if idx, ok := fc.indexes[k.Index]; ok && idx.entries[idx.hash(k.Key)] == ent {
+			delete(idx.entries, idx.hash(k.Key))
+			idx.evicted(ent.content)
+		}
+	}
+	fc.untag(ent.content)
+
+	// Insert the new content
+	return fc.insertOverwrite(content)
+}
+
+// MarkStale marks a completed entry in the cache as stale.  The
+// options specify which entry to mark.  The next lookup of the entry
+// that does not only search the cache will return the stale entry,
+// but will also start a background refresh of the entry using the
+// index factory function; lookups after the refresh completes will
+// return the refreshed entry.
+func (fc *FCache) MarkStale(opts ...LookupOption) error {
+	// Process the options
+	o, err := procLookupOpts(opts)
+	if err != nil {
+		return err
+	}
+
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[o.key.Index]
+	if !ok {
+		return ErrBadIndex
+	}
+
+	// Check to see if there's a completed entry
+	ent, ok := idx.entries[idx.hash(o.key.Key)]
+	if !ok || ent.content == nil {
+		return ErrNotCached
+	}
+
+	// Mark it stale
+	ent.stale = true
+
+	return nil
+}
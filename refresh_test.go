@@ -0,0 +1,594 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klmitch/patcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFCacheStartRefreshBase(t *testing.T) {
+	release := make(chan struct{})
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+		stale: true,
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+	factory := func(ctx context.Context, key Key) *Entry {
+		<-release
+		return &Entry{
+			Object: "new",
+			Keys:   []Key{key},
+		}
+	}
+
+	obj.Lock()
+	result := obj.startRefresh(ent, Key{"one", 1}, factory)
+	assert.Same(t, result, obj.startRefresh(ent, Key{"one", 1}, factory))
+	f := result.makeFuture(obj)
+	obj.Unlock()
+	close(release)
+	object, err := f.Wait()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "new", object)
+	obj.Lock()
+	defer obj.Unlock()
+	assert.Nil(t, ent.next)
+	assert.NotSame(t, ent, obj.indexes["one"].entries[1])
+	assert.Equal(t, "new", obj.indexes["one"].entries[1].content.Object)
+	assert.False(t, obj.indexes["one"].entries[1].stale)
+}
+
+func TestFCacheStartRefreshHashedGroup(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", []int{1}}},
+		},
+	}
+	idx := index{
+		entries: map[interface{}]*entry{
+			"[1]": ent,
+		},
+		hasher: func(key interface{}) interface{} {
+			return fmt.Sprint(key)
+		},
+		groupFactory: func(ctx context.Context, key Key) []*Entry {
+			return []*Entry{
+				{
+					Object: "other",
+					Keys:   []Key{{"one", []int{2}}},
+				},
+				{
+					Object: "new",
+					Keys:   []Key{{"one", []int{1}}},
+				},
+			}
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": idx,
+		},
+	}
+
+	obj.Lock()
+	f := obj.startRefresh(ent, Key{"one", []int{1}}, idx.refreshFactory()).makeFuture(obj)
+	obj.Unlock()
+	object, err := f.Wait()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "new", object)
+	obj.Lock()
+	defer obj.Unlock()
+	assert.Equal(t, "new", obj.indexes["one"].entries["[1]"].content.Object)
+}
+
+func TestFCacheRefreshRemoved(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	next := &entry{}
+	ent.next = next
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	obj.refresh(context.Background(), ent, Key{"one", 1}, factory)
+
+	assert.Nil(t, ent.next)
+	assert.Len(t, obj.indexes["one"].entries, 0)
+	assert.Equal(t, &Entry{
+		Error: ErrFactoryNil,
+		Keys:  []Key{{"one", 1}},
+	}, next.content)
+}
+
+func TestFCacheRefreshServeStale(t *testing.T) {
+	content := &Entry{
+		Object: "old",
+		Keys:   []Key{{"one", 1}},
+	}
+	ent := &entry{
+		content: content,
+		stale:   true,
+	}
+	next := &entry{}
+	ent.next = next
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+		serveStale: true,
+	}
+
+	obj.refresh(context.Background(), ent, Key{"one", 1}, func(ctx context.Context, key Key) *Entry {
+		return &Entry{
+			Error: assert.AnError,
+			Keys:  []Key{key},
+		}
+	})
+
+	assert.Nil(t, ent.next)
+	assert.True(t, ent.stale)
+	assert.Same(t, ent, obj.indexes["one"].entries[1])
+	assert.Same(t, content, next.content)
+	assert.False(t, ent.refresh.IsZero())
+	assert.Equal(t, uint64(1), obj.stats.StaleServed)
+}
+
+func TestFCacheRefreshServeStaleSuccess(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+		stale: true,
+	}
+	next := &entry{}
+	ent.next = next
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+		serveStale: true,
+	}
+
+	obj.refresh(context.Background(), ent, Key{"one", 1}, func(ctx context.Context, key Key) *Entry {
+		return &Entry{
+			Object: "new",
+			Keys:   []Key{key},
+		}
+	})
+
+	assert.Equal(t, "new", obj.indexes["one"].entries[1].content.Object)
+	assert.Equal(t, "new", next.content.Object)
+	assert.Equal(t, uint64(0), obj.stats.StaleServed)
+}
+
+func TestFCacheRefreshError(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+		stale: true,
+	}
+	ent.next = &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	obj.refresh(context.Background(), ent, Key{"one", 1}, func(ctx context.Context, key Key) *Entry {
+		return &Entry{
+			Error: assert.AnError,
+			Keys:  []Key{key},
+		}
+	})
+
+	assert.Len(t, obj.indexes["one"].entries, 0)
+}
+
+func TestFCacheReplace(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}, {"two", 2}, {"three", 3}},
+		},
+	}
+	other := &entry{
+		content: &Entry{
+			Object: "other",
+		},
+	}
+	content := &Entry{
+		Object: "new",
+		Keys:   []Key{{"one", 1}, {"two", 22}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: ent,
+				},
+			},
+			"three": {
+				entries: map[interface{}]*entry{
+					3: other,
+				},
+			},
+		},
+	}
+
+	result := obj.replace(ent, content)
+
+	assert.Same(t, content, result.content)
+	assert.Equal(t, map[interface{}]*entry{1: result}, obj.indexes["one"].entries)
+	assert.Equal(t, map[interface{}]*entry{22: result}, obj.indexes["two"].entries)
+	assert.Equal(t, map[interface{}]*entry{3: other}, obj.indexes["three"].entries)
+}
+
+func TestFCacheReplaceOnEvict(t *testing.T) {
+	called := make(chan Entry, 1)
+	evicted := make(chan bool, 1)
+	ent := &entry{
+		content: &Entry{
+			Object:  "old",
+			Keys:    []Key{{"one", 1}},
+			OnEvict: func() { evicted <- true },
+		},
+	}
+	content := &Entry{
+		Object: "new",
+		Keys:   []Key{{"one", 1}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+				onEvict: func(ent Entry) { called <- ent },
+			},
+		},
+	}
+
+	obj.replace(ent, content)
+
+	assert.Equal(t, "old", (<-called).Object)
+	assert.True(t, <-evicted)
+}
+
+func TestFCacheReplaceSquatter(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	squatter := &entry{
+		content: &Entry{
+			Object: "squatter",
+			Keys:   []Key{{"two", 2}, {"three", 3}},
+		},
+	}
+	content := &Entry{
+		Object: "new",
+		Keys:   []Key{{"one", 1}, {"two", 2}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: squatter,
+				},
+			},
+			"three": {
+				entries: map[interface{}]*entry{
+					3: squatter,
+				},
+			},
+		},
+	}
+
+	result := obj.replace(ent, content)
+
+	assert.Same(t, content, result.content)
+	assert.Equal(t, map[interface{}]*entry{1: result}, obj.indexes["one"].entries)
+	assert.Equal(t, map[interface{}]*entry{2: result}, obj.indexes["two"].entries)
+	assert.Equal(t, map[interface{}]*entry{}, obj.indexes["three"].entries)
+}
+
+func TestFCacheMarkStaleBase(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.MarkStale(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.True(t, ent.stale)
+}
+
+func TestFCacheMarkStalePending(t *testing.T) {
+	ent := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.MarkStale(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrNotCached, err)
+	assert.False(t, ent.stale)
+}
+
+func TestFCacheMarkStaleBadOption(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.MarkStale()
+
+	assert.Same(t, ErrNoKey, err)
+}
+
+func TestFCacheMarkStaleBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.MarkStale(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrBadIndex, err)
+}
+
+func TestFCacheLookupStale(t *testing.T) {
+	refreshed := make(chan struct{})
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "old",
+							Keys:   []Key{{"one", 1}},
+						},
+						stale: true,
+					},
+				},
+				factory: func(ctx context.Context, key Key) *Entry {
+					defer close(refreshed)
+					return &Entry{
+						Object: "new",
+						Keys:   []Key{key},
+					}
+				},
+			},
+		},
+	}
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "old", result)
+	<-refreshed
+	obj.Lock()
+	f := obj.indexes["one"].entries[1].next
+	obj.Unlock()
+	if f != nil {
+		_, _ = f.makeFuture(obj).Wait()
+	}
+	result, err = obj.Lookup(ByKey(Key{"one", 1}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "new", result)
+}
+
+func TestFCacheStartRefreshThrottled(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+		stale:   true,
+		refresh: time.Unix(995, 0),
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+				refreshEvery: 10 * time.Second,
+			},
+		},
+	}
+
+	result := obj.startRefresh(ent, Key{"one", 1}, factory)
+
+	assert.Nil(t, result)
+	assert.Nil(t, ent.next)
+}
+
+func TestFCacheStartRefreshIntervalPassed(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	ent := &entry{
+		content: &Entry{
+			Object: "old",
+			Keys:   []Key{{"one", 1}},
+		},
+		stale:   true,
+		refresh: time.Unix(990, 0),
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+				refreshEvery: 10 * time.Second,
+			},
+		},
+	}
+
+	obj.Lock()
+	result := obj.startRefresh(ent, Key{"one", 1}, func(ctx context.Context, key Key) *Entry {
+		return &Entry{
+			Object: "new",
+			Keys:   []Key{key},
+		}
+	})
+	f := result.makeFuture(obj)
+	obj.Unlock()
+	object, err := f.Wait()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "new", object)
+	obj.Lock()
+	defer obj.Unlock()
+	assert.Equal(t, time.Unix(1000, 0), obj.indexes["one"].entries[1].refresh)
+}
+
+func TestFCacheLookupForceRefresh(t *testing.T) {
+	release := make(chan struct{})
+	calls := int32(0)
+	obj, err := New(Index{
+		Index: "one",
+		Factory: func(ctx context.Context, key Key) *Entry {
+			n := atomic.AddInt32(&calls, 1)
+			if n > 1 {
+				<-release
+			}
+			return &Entry{
+				Object: n,
+				Keys:   []Key{key},
+			}
+		},
+	})
+	require.NoError(t, err)
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+	require.Equal(t, int32(1), result)
+
+	f1, err := obj.LookupFuture(ByKey(Key{"one", 1}), ForceRefresh)
+	require.NoError(t, err)
+	f2, err := obj.LookupFuture(ByKey(Key{"one", 1}), ForceRefresh)
+	require.NoError(t, err)
+	result, err = obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), result)
+	close(release)
+
+	result, err = f1.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), result)
+	result, err = f2.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), result)
+	result, err = obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), result)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestFCacheLookupForceRefreshSearchCache(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+							Keys:   []Key{{"one", 1}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}), ForceRefresh, SearchCache)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Nil(t, obj.indexes["one"].entries[1].next)
+}
@@ -43,7 +43,7 @@ func (fc *FCache) fillKeyMap(ent *entry) (map[interface{}]*keyMap, error) {
 		}
 
 		// Make sure it's this entry that's there
-		if tmp, ok := idx.entries[k.Key]; !ok || !reflect.DeepEqual(ent.content, tmp.content) {
+		if tmp, ok := idx.entries[idx.hash(k.Key)]; !ok || !reflect.DeepEqual(ent.content, tmp.content) {
 			return nil, ErrEntryNotFound
 		}
 
@@ -57,6 +57,20 @@ func (fc *FCache) fillKeyMap(ent *entry) (map[interface{}]*keyMap, error) {
 	return indexes, nil
 }
 
+// keyListed is a helper that determines whether the specified key is
+// listed in a list of keys.  The key must be hashed with the index's
+// KeyHasher, if any; keys within the index are compared in the same
+// way as by finishKeyMap.
+func (idx index) keyListed(keys []Key, key Key) bool {
+	for _, k := range keys {
+		if k.Index == key.Index && reflect.DeepEqual(idx.hash(k.Key), key.Key) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // finishKeyMap completes the work of fillKeyMap by walking through
 // the list of new keys, detecting duplications and handling them
 // appropriately.  The cache MUST be locked upon entry to this method.
@@ -102,28 +116,35 @@ func (fc *FCache) remap(indexes map[interface{}]*keyMap, ent *entry) {
 			Key:   km.new,
 		}
 
-		// Delete the old entry
-		delete(km.idx.entries, km.old)
+		// Delete the old entry and notify anyone waiting for the
+		// new key
+		newKey := km.idx.hash(km.new)
+		delete(km.idx.entries, km.idx.hash(km.old))
+		km.idx.notify(newKey, ent.content)
 
 		// Check for a squatter
-		e, ok := km.idx.entries[km.new]
+		e, ok := km.idx.entries[newKey]
 		if ok {
 			// Try to complete the squatter
 			if e.content == nil {
-				defer e.complete(ent.content)
+				defer km.idx.complete(e, ent.content)
 				continue
 			}
 
 			// OK, have to evict the old entry
 			fc.evict(e.content.Keys)
+			fc.stats.ImplicitEvictions++
 		}
 
 		// Replace with the new entry
-		km.idx.entries[km.new] = ent
+		km.idx.entries[newKey] = ent
+		km.idx.grew()
 	}
 
 	// Update the entry keys
 	ent.content.Keys = keys
+	ent.content.Version = fc.nextVersion()
+	fc.signal()
 }
 
 // Reindex reindexes an existing entry in the cache--that is, it
@@ -137,22 +158,71 @@ func (fc *FCache) Reindex(newKeys []Key, opts ...LookupOption) error {
 		return err
 	}
 
+	fn := func() error {
+		// Look for the index of the primary key
+		idx, ok := fc.indexes[o.key.Index]
+		if !ok {
+			return ErrBadIndex
+		}
+
+		// Find the existing entry
+		ent, ok := idx.entries[idx.hash(o.key.Key)]
+		if !ok || ent.content == nil {
+			return ErrNotCached
+		}
+
+		// Check the expected version and object
+		if err := checkExpected(o, ent); err != nil {
+			return err
+		}
+
+		return fc.reindex(ent, newKeys)
+	}
+
+	// Calls expecting a version or object are not identical to
+	// other calls, so don't coalesce them
+	if o.version != nil || o.expect != nil {
+		fc.Lock()
+		defer fc.Unlock()
+
+		return fn()
+	}
+
+	return fc.coalesced(opReindex, *o.key, newKeys, fn)
+}
+
+// ReindexEntry is similar to Reindex, but uses the keys of the passed
+// entry as the list of new keys.  The existing entry is located using
+// the first of those keys that is present in the cache.  Only the keys
+// of the passed entry are used; the cached object is not altered.
+func (fc *FCache) ReindexEntry(ent Entry) error {
+	if len(ent.Keys) <= 0 {
+		return ErrNoKeys
+	}
+
 	// Lock the cache
 	fc.Lock()
 	defer fc.Unlock()
 
-	// Look for the index of the primary key
-	idx, ok := fc.indexes[o.key.Index]
-	if !ok {
-		return ErrBadIndex
-	}
-
 	// Find the existing entry
-	ent, ok := idx.entries[o.key.Key]
-	if !ok || ent.content == nil {
-		return ErrNotCached
+	for _, k := range ent.Keys {
+		idx, ok := fc.indexes[k.Index]
+		if !ok {
+			continue
+		}
+
+		if e, ok := idx.entries[idx.hash(k.Key)]; ok && e.content != nil {
+			return fc.reindex(e, ent.Keys)
+		}
 	}
 
+	return ErrNotCached
+}
+
+// reindex is a helper for Reindex and ReindexEntry that changes the
+// keys of the specified entry to the new keys.  The cache MUST be
+// locked upon entry to this method.
+func (fc *FCache) reindex(ent *entry, newKeys []Key) error {
 	// Construct the initial keymap
 	indexes, err := fc.fillKeyMap(ent)
 	if err != nil {
@@ -169,3 +239,167 @@ func (fc *FCache) Reindex(newKeys []Key, opts ...LookupOption) error {
 
 	return nil
 }
+
+// MoveIndex moves an existing entry in the cache from one index to
+// another.  The options are used to find the entry to move; the entry
+// is removed from the index of the key used to find it, under all of
+// its keys in that index, it is added to the index of the specified
+// new key under that key, and it is given a new Version.  The entry's
+// keys in other indexes are not altered.  If the entry already has a
+// key in the new key's index, ErrIncongruentKeys is returned; use
+// Reindex to change keys within an index.  Multi-value indexes may not
+// be used, and ErrMultiValue is returned for them.  As with Reindex, a
+// pending entry with the new key is completed with the entry, and a
+// completed entry with the new key is evicted.
+func (fc *FCache) MoveIndex(newKey Key, opts ...LookupOption) error {
+	// Process the options
+	o, err := procLookupOpts(opts)
+	if err != nil {
+		return err
+	}
+
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the indexes
+	oldIdx, ok := fc.indexes[o.key.Index]
+	if !ok {
+		return ErrBadIndex
+	}
+	newIdx, ok := fc.indexes[newKey.Index]
+	if !ok {
+		return ErrBadIndex
+	}
+	if oldIdx.multi || newIdx.multi {
+		return ErrMultiValue
+	}
+
+	// Find the existing entry
+	oldHK := oldIdx.hash(o.key.Key)
+	ent, ok := oldIdx.entries[oldHK]
+	if !ok || ent.content == nil {
+		return ErrNotCached
+	}
+
+	// Make sure the entry isn't already in the new index
+	for _, k := range ent.content.Keys {
+		if k.Index == newKey.Index {
+			return ErrIncongruentKeys
+		}
+	}
+
+	// Construct the new key list, removing the entry from the old
+	// index under all its keys there
+	keys := make([]Key, 0, len(ent.content.Keys))
+	for _, k := range ent.content.Keys {
+		if k.Index != o.key.Index {
+			keys = append(keys, k)
+		} else if hk := oldIdx.hash(k.Key); oldIdx.entries[hk] == ent {
+			delete(oldIdx.entries, hk)
+		}
+	}
+	keys = append(keys, newKey)
+	delete(oldIdx.entries, oldHK)
+
+	// Check for a squatter in the new index
+	newHK := newIdx.hash(newKey.Key)
+	if e, ok := newIdx.entries[newHK]; ok {
+		if e.content == nil {
+			defer newIdx.complete(e, ent.content)
+		} else {
+			fc.evict(e.content.Keys)
+			fc.stats.ImplicitEvictions++
+		}
+	}
+
+	// Add the entry to the new index and notify anyone waiting
+	newIdx.entries[newHK] = ent
+	newIdx.grew()
+	ent.content.Keys = keys
+	ent.content.Version = fc.nextVersion()
+	newIdx.notify(newHK, ent.content)
+	fc.signal()
+
+	return nil
+}
+
+// hasIndex is a helper that determines whether any of the specified
+// keys is in the specified index.
+func hasIndex(keys []Key, index interface{}) bool {
+	for _, k := range keys {
+		if k.Index == index {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RebuildIndex makes the completed entries of the source index
+// reachable through the target index, such as after the target index
+// has been added to a cache that is already populated.  The function is
+// called with the cache locked and is passed a copy of each completed
+// entry in the source index; it returns the key of the entry within the
+// target index, and a flag indicating whether the entry should be added
+// to the target index.  The entry is added to the target index under
+// that key, the key is appended to the entry's Keys, and the entry is
+// given a new Version.  Entries that already have a key in the target
+// index are skipped, as are entries whose key is held by a completed
+// entry in the target index; a pending entry with the key is completed
+// with the entry.  The function must not call any methods of the cache.
+func (fc *FCache) RebuildIndex(target, source interface{}, keyFn func(Entry) (interface{}, bool)) error {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the indexes
+	tIdx, ok := fc.indexes[target]
+	if !ok {
+		return ErrBadIndex
+	}
+	sIdx, ok := fc.indexes[source]
+	if !ok {
+		return ErrBadIndex
+	}
+	if tIdx.multi || sIdx.multi {
+		return ErrMultiValue
+	}
+
+	// Walk the entries of the source index
+	seen := map[*Entry]bool{}
+	for _, ent := range sIdx.entries {
+		if ent.content == nil || seen[ent.content] || hasIndex(ent.content.Keys, target) {
+			continue
+		}
+		seen[ent.content] = true
+
+		// Derive the key
+		key, ok := keyFn(ent.content.Clone())
+		if !ok {
+			continue
+		}
+
+		// Check for a squatter in the target index
+		hk := tIdx.hash(key)
+		e, squat := tIdx.entries[hk]
+		if squat && e.content != nil {
+			continue
+		}
+
+		// Add the entry to the target index
+		keys := make([]Key, len(ent.content.Keys), len(ent.content.Keys)+1)
+		copy(keys, ent.content.Keys)
+		ent.content.Keys = append(keys, Key{Index: target, Key: key})
+		ent.content.Version = fc.nextVersion()
+		tIdx.entries[hk] = ent
+		tIdx.grew()
+		if squat {
+			tIdx.complete(e, ent.content)
+		}
+		tIdx.notify(hk, ent.content)
+	}
+	fc.signal()
+
+	return nil
+}
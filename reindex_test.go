@@ -392,9 +392,48 @@ func TestFCacheRemap(t *testing.T) {
 				},
 			},
 		},
+		stats: Stats{
+			ImplicitEvictions: 1,
+		},
+		version: 1,
 	}, obj)
 }
 
+func TestFCacheReindexSquatterFuture(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 2}},
+		},
+	}
+	squatter := &entry{
+		content: &Entry{
+			Object: "squatter",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: squatter,
+					2: ent,
+				},
+			},
+		},
+	}
+	f, err := obj.LookupFuture(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+
+	err = obj.Reindex([]Key{{"one", 1}}, ByKey(Key{"one", 2}))
+
+	assert.NoError(t, err)
+	assert.Same(t, ent, obj.indexes["one"].entries[1])
+	result, err := f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "squatter", result)
+}
+
 func TestFCacheReindexBase(t *testing.T) {
 	object := &entry{
 		content: &Entry{
@@ -464,6 +503,7 @@ func TestFCacheReindexBase(t *testing.T) {
 				},
 			},
 		},
+		version: 1,
 	}, obj)
 }
 
@@ -823,3 +863,543 @@ func TestFCacheReindexIncongruentKeys(t *testing.T) {
 		},
 	}, obj)
 }
+
+func TestFCacheReindexVersionConflict(t *testing.T) {
+	object := &entry{
+		content: &Entry{
+			Object:  "object",
+			Keys:    []Key{{"one", 1}},
+			Version: 2,
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: object,
+				},
+			},
+		},
+		coalesce: true,
+	}
+
+	err := obj.Reindex([]Key{{"one", 2}}, ByKey(Key{"one", 1}), IfVersion(1))
+
+	assert.Same(t, ErrVersionConflict, err)
+	assert.Equal(t, []Key{{"one", 1}}, object.content.Keys)
+	assert.Equal(t, uint64(2), object.content.Version)
+}
+
+func TestFCacheReindexObjectConflict(t *testing.T) {
+	object := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: object,
+				},
+			},
+		},
+		coalesce: true,
+	}
+
+	err := obj.Reindex([]Key{{"one", 2}}, ByKey(Key{"one", 1}), IfObject("other", nil))
+
+	assert.Same(t, ErrObjectConflict, err)
+	assert.Equal(t, []Key{{"one", 1}}, object.content.Keys)
+}
+
+func TestFCacheReindexEntryBase(t *testing.T) {
+	object := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys: []Key{
+				{"one", 1},
+				{"two", 3},
+			},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: object,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					3: object,
+				},
+			},
+		},
+	}
+
+	err := obj.ReindexEntry(Entry{
+		Object: "ignored",
+		Keys: []Key{
+			{"zero", 0},
+			{"two", 2},
+			{"one", 1},
+		},
+	})
+
+	assert.Same(t, ErrIncongruentKeys, err)
+
+	err = obj.ReindexEntry(Entry{
+		Object: "ignored",
+		Keys: []Key{
+			{"two", 2},
+			{"one", 1},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: object,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: object,
+				},
+			},
+		},
+		version: 1,
+	}, obj)
+	assert.Equal(t, "object", object.content.Object)
+	assert.Equal(t, []Key{{"one", 1}, {"two", 2}}, object.content.Keys)
+	assert.Equal(t, uint64(1), object.content.Version)
+}
+
+func TestFCacheReindexEntryNoKeys(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.ReindexEntry(Entry{})
+
+	assert.Same(t, ErrNoKeys, err)
+}
+
+func TestFCacheReindexEntryNotCached(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+		},
+	}
+
+	err := obj.ReindexEntry(Entry{
+		Keys: []Key{
+			{"one", 1},
+			{"two", 2},
+		},
+	})
+
+	assert.Same(t, ErrNotCached, err)
+}
+
+func TestFCacheMoveIndexBase(t *testing.T) {
+	content := &Entry{
+		Object: "object",
+		Keys:   []Key{{"a", 1}, {"c", 3}},
+	}
+	ent := &entry{
+		content: content,
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"b": {
+				entries: map[interface{}]*entry{},
+			},
+			"c": {
+				entries: map[interface{}]*entry{
+					3: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.MoveIndex(Key{"b", 2}, ByKey(Key{"a", 1}))
+
+	assert.NoError(t, err)
+	assert.Len(t, obj.indexes["a"].entries, 0)
+	assert.Equal(t, map[interface{}]*entry{
+		2: ent,
+	}, obj.indexes["b"].entries)
+	assert.Equal(t, map[interface{}]*entry{
+		3: ent,
+	}, obj.indexes["c"].entries)
+	assert.Equal(t, []Key{{"c", 3}, {"b", 2}}, content.Keys)
+	assert.Equal(t, uint64(1), content.Version)
+	assert.Len(t, obj.Verify(), 0)
+}
+
+func TestFCacheMoveIndexSeveralKeys(t *testing.T) {
+	content := &Entry{
+		Object: "object",
+		Keys:   []Key{{"a", 1}, {"a", 11}, {"c", 3}},
+	}
+	ent := &entry{
+		content: content,
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{
+					1:  ent,
+					11: ent,
+				},
+			},
+			"b": {
+				entries: map[interface{}]*entry{},
+			},
+			"c": {
+				entries: map[interface{}]*entry{
+					3: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.MoveIndex(Key{"b", 2}, ByKey(Key{"a", 1}))
+
+	assert.NoError(t, err)
+	assert.Len(t, obj.indexes["a"].entries, 0)
+	assert.Equal(t, []Key{{"c", 3}, {"b", 2}}, content.Keys)
+	assert.Len(t, obj.Verify(), 0)
+}
+
+func TestFCacheMoveIndexMultiValue(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"a", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"b": {
+				entries: map[interface{}]*entry{},
+				multi:   true,
+			},
+		},
+	}
+
+	err := obj.MoveIndex(Key{"b", 2}, ByKey(Key{"a", 1}))
+
+	assert.Same(t, ErrMultiValue, err)
+	assert.Equal(t, map[interface{}]*entry{
+		1: ent,
+	}, obj.indexes["a"].entries)
+	assert.Len(t, obj.indexes["b"].entries, 0)
+}
+
+func TestFCacheMoveIndexPendingSquatter(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"a", 1}},
+		},
+	}
+	squatter := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"b": {
+				entries: map[interface{}]*entry{
+					2: squatter,
+				},
+			},
+		},
+	}
+
+	err := obj.MoveIndex(Key{"b", 2}, ByKey(Key{"a", 1}))
+
+	assert.NoError(t, err)
+	assert.Same(t, ent, obj.indexes["b"].entries[2])
+	assert.Same(t, ent.content, squatter.content)
+	assert.Equal(t, []Key{{"b", 2}}, squatter.content.Keys)
+}
+
+func TestFCacheMoveIndexCompletedSquatter(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"a", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"b": {
+				entries: map[interface{}]*entry{
+					2: {
+						content: &Entry{
+							Object: "squatter",
+							Keys:   []Key{{"b", 2}, {"c", 3}},
+						},
+					},
+				},
+			},
+			"c": {
+				entries: map[interface{}]*entry{
+					3: {
+						content: &Entry{
+							Object: "squatter",
+							Keys:   []Key{{"b", 2}, {"c", 3}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := obj.MoveIndex(Key{"b", 2}, ByKey(Key{"a", 1}))
+
+	assert.NoError(t, err)
+	assert.Same(t, ent, obj.indexes["b"].entries[2])
+	assert.Len(t, obj.indexes["c"].entries, 0)
+}
+
+func TestFCacheMoveIndexAlreadyIndexed(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"a", 1}, {"b", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"b": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.MoveIndex(Key{"b", 2}, ByKey(Key{"a", 1}))
+
+	assert.Same(t, ErrIncongruentKeys, err)
+	assert.Same(t, ent, obj.indexes["a"].entries[1])
+}
+
+func TestFCacheMoveIndexNotCached(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+			"b": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	err := obj.MoveIndex(Key{"b", 2}, ByKey(Key{"a", 1}))
+
+	assert.Same(t, ErrNotCached, err)
+}
+
+func TestFCacheMoveIndexBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	assert.Same(t, ErrBadIndex, obj.MoveIndex(Key{"b", 2}, ByKey(Key{"a", 1})))
+	assert.Same(t, ErrBadIndex, obj.MoveIndex(Key{"a", 2}, ByKey(Key{"b", 1})))
+}
+
+func TestFCacheMoveIndexBadOption(t *testing.T) {
+	obj := &FCache{}
+
+	err := obj.MoveIndex(Key{"b", 2})
+
+	assert.Same(t, ErrNoKey, err)
+}
+
+func TestHasIndexTrue(t *testing.T) {
+	result := hasIndex([]Key{{"a", 1}, {"b", 2}}, "b")
+
+	assert.True(t, result)
+}
+
+func TestHasIndexFalse(t *testing.T) {
+	result := hasIndex([]Key{{"a", 1}, {"b", 2}}, "c")
+
+	assert.False(t, result)
+}
+
+func nameKey(ent Entry) (interface{}, bool) {
+	if ent.Object == nil {
+		return nil, false
+	}
+
+	return ent.Object, true
+}
+
+func TestFCacheRebuildIndexBase(t *testing.T) {
+	ent1 := &entry{
+		content: &Entry{
+			Object: "one",
+			Keys:   []Key{{"a", 1}, {"a", 11}},
+		},
+	}
+	ent2 := &entry{
+		content: &Entry{
+			Keys: []Key{{"a", 2}},
+		},
+	}
+	ent3 := &entry{
+		content: &Entry{
+			Object: "three",
+			Keys:   []Key{{"a", 3}, {"b", "other"}},
+		},
+	}
+	ent4 := &entry{
+		content: &Entry{
+			Object: "four",
+			Keys:   []Key{{"a", 4}},
+		},
+	}
+	ent5 := &entry{
+		content: &Entry{
+			Object: "five",
+			Keys:   []Key{{"a", 5}},
+		},
+	}
+	squatter := &entry{
+		content: &Entry{
+			Object: "squatter",
+			Keys:   []Key{{"b", "four"}},
+		},
+	}
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{
+					1:  ent1,
+					11: ent1,
+					2:  ent2,
+					3:  ent3,
+					4:  ent4,
+					5:  ent5,
+					6:  {},
+				},
+			},
+			"b": {
+				entries: map[interface{}]*entry{
+					"other": ent3,
+					"four":  squatter,
+					"five":  pending,
+				},
+			},
+		},
+	}
+
+	err := obj.RebuildIndex("b", "a", nameKey)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]*entry{
+		"one":   ent1,
+		"other": ent3,
+		"four":  squatter,
+		"five":  ent5,
+	}, obj.indexes["b"].entries)
+	assert.Equal(t, []Key{{"a", 1}, {"a", 11}, {"b", "one"}}, ent1.content.Keys)
+	assert.Equal(t, []Key{{"a", 2}}, ent2.content.Keys)
+	assert.Equal(t, []Key{{"a", 3}, {"b", "other"}}, ent3.content.Keys)
+	assert.Equal(t, []Key{{"a", 4}}, ent4.content.Keys)
+	assert.Equal(t, []Key{{"a", 5}, {"b", "five"}}, ent5.content.Keys)
+	assert.Same(t, ent5.content, pending.content)
+	assert.ElementsMatch(t, []uint64{1, 2}, []uint64{ent1.content.Version, ent5.content.Version})
+	assert.Equal(t, uint64(0), ent2.content.Version)
+}
+
+func TestFCacheRebuildIndexBadTarget(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	err := obj.RebuildIndex("b", "a", nameKey)
+
+	assert.Same(t, ErrBadIndex, err)
+}
+
+func TestFCacheRebuildIndexBadSource(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"b": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	err := obj.RebuildIndex("b", "a", nameKey)
+
+	assert.Same(t, ErrBadIndex, err)
+}
+
+func TestFCacheRebuildIndexMultiValue(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"a": {
+				entries: map[interface{}]*entry{},
+			},
+			"b": {
+				entries: map[interface{}]*entry{},
+				multi:   true,
+			},
+		},
+	}
+
+	err := obj.RebuildIndex("b", "a", nameKey)
+
+	assert.Same(t, ErrMultiValue, err)
+}
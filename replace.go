@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import "context"
+
+// ReplaceIndex atomically replaces the entire contents of the specified
+// cache index with the specified entries.  Only the keys of each entry
+// that reference the specified index are used; other indexes are not
+// altered.  As with entries returned by a factory, entries with errors
+// are only included if the error is a permanent or retryable error.
+// Any pending entries in the index are completed with the matching new
+// entry, if there is one, or canceled otherwise.  The completed entries
+// dropped from the index are passed to the index's OnEvict callback;
+// their own OnEvict callbacks are called if they are no longer cached
+// under other indexes.
+func (fc *FCache) ReplaceIndex(index interface{}, entries []Entry) error {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return ErrBadIndex
+	}
+
+	// Construct the new entries map
+	createdAt := now()
+	newEntries := map[interface{}]*entry{}
+	for i := range entries {
+		// Skip uncacheable errors
+		content := entries[i]
+		content.checkNotFound()
+		if !isCacheable(content.Error) {
+			continue
+		}
+		content.CreatedAt = createdAt
+		content.Version = fc.nextVersion()
+		newE := &entry{
+			content: &content,
+		}
+		for _, k := range content.Keys {
+			if k.Index == index {
+				newEntries[idx.hash(k.Key)] = newE
+			}
+		}
+	}
+
+	// Complete any pending entries, collecting the completed
+	// entries being dropped
+	dropped := map[*Entry]bool{}
+	for key, ent := range idx.entries {
+		if ent.content != nil {
+			dropped[ent.content] = true
+			continue
+		}
+
+		if newE, ok := newEntries[key]; ok {
+			idx.complete(ent, newE.content)
+		} else {
+			idx.complete(ent, &Entry{
+				Error: context.Canceled,
+			})
+		}
+	}
+
+	// Swap in the new entries; the old map is released, so the
+	// peak since reallocation starts over
+	idx.entries = newEntries
+	fc.indexes[index] = idx
+	if idx.growth != nil {
+		idx.growth.PeakSinceRealloc = 0
+	}
+	idx.grew()
+
+	// Report the dropped entries as evicted from the index; the
+	// entries themselves are only evicted, and their tags
+	// forgotten, if they are no longer cached in other indexes
+	for content := range dropped {
+		if !fc.cached(content) {
+			idx.evicted(content)
+			fc.untag(content)
+			fc.stats.ImplicitEvictions++
+		} else if idx.onEvict != nil {
+			go idx.onEvict(*content)
+		}
+	}
+
+	// Record the tags of the new entries and notify anyone waiting
+	// for the new keys
+	for key, newE := range newEntries {
+		fc.tag(newE.content)
+		idx.notify(key, newE.content)
+	}
+	fc.signal()
+
+	return nil
+}
+
+// cached checks whether the entry is cached under any of its keys.
+// The cache MUST be locked upon entry to this method.
+func (fc *FCache) cached(ent *Entry) bool {
+	for _, k := range ent.Keys {
+		if idx, ok := fc.indexes[k.Index]; ok {
+			if e, ok := idx.entries[idx.hash(k.Key)]; ok && e.content == ent {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/klmitch/patcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFCacheReplaceIndexGrowth(t *testing.T) {
+	growth := &IndexGrowth{
+		Peak:             10,
+		PeakSinceRealloc: 10,
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				growth:  growth,
+			},
+		},
+	}
+
+	err := obj.ReplaceIndex("one", []Entry{
+		{Object: "o1", Keys: []Key{{"one", 1}}},
+		{Object: "o2", Keys: []Key{{"one", 2}}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &IndexGrowth{
+		Peak:             10,
+		PeakSinceRealloc: 2,
+	}, growth)
+}
+
+func TestFCacheReplaceIndexBase(t *testing.T) {
+	createdAt := time.Unix(1000, 0)
+	defer patcher.SetVar(&now, func() time.Time { return createdAt }).Install().Restore()
+	pending1 := &entry{}
+	pending2 := &entry{}
+	other := &entry{
+		content: &Entry{
+			Object: "other",
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending1,
+					2: pending2,
+					3: {
+						content: &Entry{
+							Object: "old",
+						},
+					},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					1: other,
+				},
+			},
+		},
+	}
+
+	err := obj.ReplaceIndex("one", []Entry{
+		{
+			Object: "o1",
+			Keys:   []Key{{"one", 1}, {"one", 11}, {"two", 1}},
+		},
+		{
+			Error: assert.AnError,
+			Keys:  []Key{{"one", 4}},
+		},
+		{
+			Error: &PermanentError{assert.AnError},
+			Keys:  []Key{{"one", 5}},
+		},
+	})
+
+	assert.NoError(t, err)
+	entries := obj.indexes["one"].entries
+	assert.Len(t, entries, 3)
+	assert.Same(t, entries[1], entries[11])
+	assert.Equal(t, "o1", entries[1].content.Object)
+	assert.Equal(t, createdAt, entries[1].content.CreatedAt)
+	assert.Equal(t, &PermanentError{assert.AnError}, entries[5].content.Error)
+	assert.Same(t, entries[1].content, pending1.content)
+	assert.Same(t, context.Canceled, pending2.content.Error)
+	assert.Same(t, other, obj.indexes["two"].entries[1])
+}
+
+func TestFCacheReplaceIndexOnEvict(t *testing.T) {
+	called := make(chan Entry, 2)
+	evicted := make(chan string, 2)
+	old := &Entry{
+		Object:  "old",
+		Keys:    []Key{{"one", 1}, {"one", 2}},
+		OnEvict: func() { evicted <- "old" },
+	}
+	shared := &Entry{
+		Object:  "shared",
+		Keys:    []Key{{"one", 3}, {"two", 3}},
+		OnEvict: func() { evicted <- "shared" },
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {content: old},
+					2: {content: old},
+					3: {content: shared},
+				},
+				onEvict: func(ent Entry) { called <- ent },
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					3: {content: shared},
+				},
+			},
+		},
+	}
+
+	err := obj.ReplaceIndex("one", []Entry{})
+
+	assert.NoError(t, err)
+	objs := []interface{}{(<-called).Object, (<-called).Object}
+	assert.ElementsMatch(t, []interface{}{"old", "shared"}, objs)
+	assert.Equal(t, "old", <-evicted)
+	assert.False(t, shared.evicted)
+	assert.Equal(t, uint64(1), obj.stats.ImplicitEvictions)
+}
+
+func TestFCacheReplaceIndexTags(t *testing.T) {
+	old := &Entry{
+		Object: "old",
+		Keys:   []Key{{"one", 1}},
+		Tags:   []string{"a"},
+	}
+	shared := &Entry{
+		Object: "shared",
+		Keys:   []Key{{"one", 2}, {"two", 2}},
+		Tags:   []string{"a"},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {content: old},
+					2: {content: shared},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: {content: shared},
+				},
+			},
+		},
+		tags: map[string]tagSet{
+			"a": {old: true, shared: true},
+		},
+	}
+
+	err := obj.ReplaceIndex("one", []Entry{
+		{
+			Object: "new",
+			Keys:   []Key{{"one", 3}},
+			Tags:   []string{"b"},
+		},
+		{
+			Object: "elsewhere",
+			Keys:   []Key{{"two", 4}},
+			Tags:   []string{"c"},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]tagSet{
+		"a": {shared: true},
+		"b": {obj.indexes["one"].entries[3].content: true},
+	}, obj.tags)
+}
+
+func TestFCacheReplaceIndexWaiters(t *testing.T) {
+	w := &waiter{
+		ent: &entry{},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+				waiters: map[interface{}]*waiter{
+					1: w,
+				},
+			},
+		},
+	}
+
+	err := obj.ReplaceIndex("one", []Entry{
+		{
+			Object: "o1",
+			Keys:   []Key{{"one", 1}},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Same(t, obj.indexes["one"].entries[1].content, w.ent.content)
+	assert.Len(t, obj.indexes["one"].waiters, 0)
+}
+
+func TestFCacheReplaceIndexBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.ReplaceIndex("one", []Entry{})
+
+	assert.Same(t, ErrBadIndex, err)
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import "context"
+
+// Reservation is returned by Reserve and represents a pending entry
+// that the caller has promised to complete.  The reservation must be
+// completed by calling either Fulfill or Abandon.
+type Reservation struct {
+	fc   *FCache // The cache the reservation is from
+	ent  *entry  // The pending entry
+	key  Key     // The reserved key
+	done bool    // A flag indicating the reservation was completed
+}
+
+// Reserve reserves the specified key by adding a pending entry for it
+// to the cache, and returns a Reservation.  Lookups of the key wait
+// for the entry to be supplied with the Reservation's Fulfill method,
+// rather than invoking the index factory function.  If the key is
+// already present in the cache, ErrKeyExists is returned.  The
+// reservation counts against the MaxPending limit.
+func (fc *FCache) Reserve(key Key) (*Reservation, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index, constructing it if needed
+	idx, err := fc.findIndex(key.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the key isn't present
+	hk := idx.hash(key.Key)
+	if _, ok := idx.entries[hk]; ok {
+		return nil, ErrKeyExists
+	}
+
+	// Add the pending entry
+	ent, _ := newEntry()
+	if err := fc.addPending(ent, key); err != nil {
+		ent.cancel()
+		return nil, err
+	}
+	idx.entries[hk] = ent
+	idx.grew()
+
+	return &Reservation{
+		fc:  fc,
+		ent: ent,
+		key: key,
+	}, nil
+}
+
+// Fulfill completes the reservation with the specified entry, which
+// is inserted into the cache as if it had been returned by a factory
+// function; callers waiting on the reserved key receive it.  If the
+// entry has no keys, the reserved key is used.  If the reservation has
+// already been completed, ErrReservationDone is returned.
+func (r *Reservation) Fulfill(ent Entry) error {
+	// Lock the cache
+	r.fc.Lock()
+	defer r.fc.Unlock()
+
+	// Make sure the reservation is still outstanding
+	if r.done {
+		return ErrReservationDone
+	}
+	r.done = true
+
+	// Insert the entry
+	if len(ent.Keys) <= 0 {
+		ent.Keys = []Key{r.key}
+	}
+	r.fc.insert(&ent)
+
+	// Complete the reserved entry if the entry did not list its key
+	r.finish(&ent)
+
+	return nil
+}
+
+// Abandon completes the reservation without supplying an entry.
+// Callers waiting on the reserved key receive context.Canceled, and
+// the key is removed from the cache.  Calling Abandon on a reservation
+// that has already been completed has no effect.
+func (r *Reservation) Abandon() {
+	// Lock the cache
+	r.fc.Lock()
+	defer r.fc.Unlock()
+
+	if !r.done {
+		r.done = true
+		r.finish(&Entry{
+			Error: context.Canceled,
+			Keys:  []Key{r.key},
+		})
+	}
+}
+
+// finish completes the reserved entry, if it is still pending, and
+// removes it from the cache.  The cache MUST be locked upon entry to
+// this method.
+func (r *Reservation) finish(content *Entry) {
+	if r.ent.content != nil {
+		return
+	}
+
+	idx, ok := r.fc.indexes[r.key.Index]
+	if !ok {
+		r.ent.complete(content)
+		return
+	}
+
+	idx.complete(r.ent, content)
+	hk := idx.hash(r.key.Key)
+	if idx.entries[hk] == r.ent {
+		delete(idx.entries, hk)
+	}
+}
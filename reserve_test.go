@@ -0,0 +1,156 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFCacheReserveFulfill(t *testing.T) {
+	obj, err := New(Index{
+		Index: "one",
+		Factory: func(ctx context.Context, key Key) *Entry {
+			t.Fail()
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	r, err := obj.Reserve(Key{"one", 1})
+	require.NoError(t, err)
+	f, err := obj.LookupFuture(ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+	assert.True(t, f.Pending())
+	assert.NoError(t, r.Fulfill(Entry{Object: "object"}))
+	result, err := f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Same(t, ErrReservationDone, r.Fulfill(Entry{Object: "other"}))
+	result, err = obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Equal(t, 0, obj.pending)
+}
+
+func TestFCacheReserveFulfillOtherKey(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	r, err := obj.Reserve(Key{"one", 1})
+	require.NoError(t, err)
+	f := r.ent.makeFuture(obj)
+	assert.NoError(t, r.Fulfill(Entry{
+		Object: "object",
+		Keys:   []Key{{"one", 2}},
+	}))
+
+	result, err := f.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.NotContains(t, obj.indexes["one"].entries, 1)
+	assert.Contains(t, obj.indexes["one"].entries, 2)
+}
+
+func TestFCacheReserveAbandon(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	r, err := obj.Reserve(Key{"one", 1})
+	require.NoError(t, err)
+	f := r.ent.makeFuture(obj)
+	r.Abandon()
+	r.Abandon()
+
+	result, err := f.Wait()
+	assert.Same(t, context.Canceled, err)
+	assert.Nil(t, result)
+	assert.Len(t, obj.indexes["one"].entries, 0)
+	assert.Same(t, ErrReservationDone, r.Fulfill(Entry{Object: "object"}))
+}
+
+func TestFCacheReserveKeyExists(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Reserve(Key{"one", 1})
+
+	assert.Same(t, ErrKeyExists, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheReserveMaxPending(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+		maxPending: 1,
+		pending:    1,
+	}
+
+	result, err := obj.Reserve(Key{"one", 1})
+
+	assert.Same(t, ErrTooManyPending, err)
+	assert.Nil(t, result)
+	assert.Len(t, obj.indexes["one"].entries, 0)
+}
+
+func TestFCacheReserveBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.Reserve(Key{"one", 1})
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestReservationFinishBadIndex(t *testing.T) {
+	ent := &entry{}
+	r := &Reservation{
+		fc: &FCache{
+			indexes: map[interface{}]index{},
+		},
+		ent: ent,
+		key: Key{"one", 1},
+	}
+
+	r.finish(&Entry{Error: context.Canceled})
+
+	assert.Same(t, context.Canceled, ent.content.Error)
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+// ScopedCache is a view of an FCache that keeps entries stored
+// through it local to the view, returned by the Scope method.
+// Lookups through the view first search the local entries, then read
+// through to the underlying cache; entries stored with the ByEntry
+// option are kept in the view, overriding those of the underlying
+// cache, until they are promoted with the Promote method.
+type ScopedCache struct {
+	fc    *FCache // The underlying cache
+	local *FCache // The local entries
+}
+
+// Scope returns a scoped view of the cache.  This may be used, for
+// instance, to cache tentative objects while handling a request,
+// promoting them to the cache only when the request succeeds.  The
+// view has the indexes the cache has when Scope is called; entries
+// may not be stored in indexes added to the cache later, though they
+// may still be looked up.
+func (fc *FCache) Scope() *ScopedCache {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Construct empty copies of the indexes
+	local := &FCache{
+		indexes: map[interface{}]index{},
+	}
+	for key, idx := range fc.indexes {
+		local.indexes[key] = index{
+			entries: map[interface{}]*entry{},
+			groups:  map[interface{}]*group{},
+			hasher:  idx.hasher,
+			multi:   idx.multi,
+		}
+	}
+
+	return &ScopedCache{
+		fc:    fc,
+		local: local,
+	}
+}
+
+// Lookup looks up an entry and returns it.  If the ByEntry option is
+// passed, the entry is stored in the view, replacing any entry stored
+// previously, and the underlying cache is not altered; entries with
+// errors that may not be cached are rejected with ErrNotCacheable,
+// and entries with no keys referring to an index of the view with
+// ErrNoMatchingIndex.  Otherwise, an
+// entry stored in the view is returned if there is one, and the
+// lookup is passed to FCache.Lookup if not.
+func (s *ScopedCache) Lookup(opts ...LookupOption) (interface{}, error) {
+	// Process the options
+	o, err := procLookupOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store the entry in the view
+	if o.ent != nil {
+		if err := s.storable(o.ent); err != nil {
+			return nil, err
+		}
+
+		o.overwrite = true
+		f, err := s.local.lookup(o)
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Cancel()
+		return f.Wait()
+	}
+
+	// Look for an entry stored in the view
+	if ent, err := s.local.Inspect(opts...); err == nil {
+		return ent.Object, ent.Error
+	}
+
+	return s.fc.Lookup(opts...)
+}
+
+// storable checks that an entry may be stored in the view.
+func (s *ScopedCache) storable(ent *Entry) error {
+	if !isCacheable(ent.Error) {
+		return ErrNotCacheable
+	}
+
+	// Lock the local entries
+	s.local.Lock()
+	defer s.local.Unlock()
+
+	if !s.local.matches(ent) {
+		return ErrNoMatchingIndex
+	}
+
+	return nil
+}
+
+// Inspect looks up a completed entry and returns a copy of it.  An
+// entry stored in the view is returned if there is one; otherwise,
+// the entry is looked up in the underlying cache.  See FCache.Inspect.
+func (s *ScopedCache) Inspect(opts ...LookupOption) (Entry, error) {
+	if ent, err := s.local.Inspect(opts...); err == nil {
+		return ent, nil
+	}
+
+	return s.fc.Inspect(opts...)
+}
+
+// take removes all the entries stored in the view and returns them.
+func (s *ScopedCache) take() []Entry {
+	// Lock the local entries
+	s.local.Lock()
+	defer s.local.Unlock()
+
+	// Collect the entries, clearing the indexes
+	seen := map[*Entry]bool{}
+	ents := []Entry{}
+	for _, idx := range s.local.indexes {
+		for hk, ent := range idx.entries {
+			if ent.content != nil && !seen[ent.content] {
+				seen[ent.content] = true
+				ents = append(ents, ent.content.Clone())
+			}
+			delete(idx.entries, hk)
+		}
+	}
+
+	// Forget the tags of the taken entries
+	for content := range seen {
+		s.local.untag(content)
+	}
+
+	return ents
+}
+
+// Promote stores all the entries stored in the view into the
+// underlying cache, as if by FCache.Lookup with the ByEntry and
+// Overwrite options, and removes them from the view.  All the entries
+// are promoted even if some of them cannot be stored; the first such
+// error is returned.
+func (s *ScopedCache) Promote() error {
+	var result error
+	for _, ent := range s.take() {
+		f, err := s.fc.LookupFuture(ByEntry(ent), Overwrite)
+		if err != nil {
+			if result == nil {
+				result = err
+			}
+			continue
+		}
+		f.Cancel()
+	}
+
+	return result
+}
+
+// Discard removes all the entries stored in the view without storing
+// them in the underlying cache.
+func (s *ScopedCache) Discard() {
+	s.take()
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scopeFactory(ctx context.Context, key Key) *Entry {
+	return &Entry{
+		Object: "parent",
+		Keys:   []Key{key},
+	}
+}
+
+func TestFCacheScope(t *testing.T) {
+	hasher := func(key interface{}) interface{} {
+		return key
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+				hasher: hasher,
+				multi:  true,
+			},
+		},
+	}
+
+	result := obj.Scope()
+
+	assert.Same(t, obj, result.fc)
+	require.Contains(t, result.local.indexes, "one")
+	idx := result.local.indexes["one"]
+	assert.Equal(t, map[interface{}]*entry{}, idx.entries)
+	assert.Equal(t, map[interface{}]*group{}, idx.groups)
+	assert.NotNil(t, idx.hasher)
+	assert.True(t, idx.multi)
+	assert.Nil(t, idx.factory)
+}
+
+func TestScopedCacheLookup(t *testing.T) {
+	fc, err := New(Index{
+		Index:   "one",
+		Factory: scopeFactory,
+	})
+	require.NoError(t, err)
+	obj := fc.Scope()
+
+	result, err := obj.Lookup(ByEntry(Entry{
+		Object: "local",
+		Keys:   []Key{{"one", 1}},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "local", result)
+	result, err = obj.Lookup(ByEntry(Entry{
+		Object: "replaced",
+		Keys:   []Key{{"one", 1}},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "replaced", result)
+	result, err = obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "replaced", result)
+	result, err = obj.Lookup(ByKey(Key{"one", 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, "parent", result)
+	ent, err := obj.Inspect(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "replaced", ent.Object)
+	ent, err = obj.Inspect(ByKey(Key{"one", 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, "parent", ent.Object)
+	_, err = fc.Inspect(ByKey(Key{"one", 1}))
+	assert.Same(t, ErrNotCached, err)
+}
+
+func TestScopedCacheLookupError(t *testing.T) {
+	fc, err := New(Index{
+		Index:   "one",
+		Factory: scopeFactory,
+	})
+	require.NoError(t, err)
+	obj := fc.Scope()
+	_, err = obj.Lookup(ByEntry(Entry{
+		NotFound: true,
+		Keys:     []Key{{"one", 1}},
+	}))
+	require.Same(t, ErrNotFound, err)
+
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+
+	assert.Same(t, ErrNotFound, err)
+	assert.Nil(t, result)
+}
+
+func TestScopedCacheLookupBadOption(t *testing.T) {
+	obj := (&FCache{}).Scope()
+
+	result, err := obj.Lookup()
+
+	assert.Same(t, ErrNoKey, err)
+	assert.Nil(t, result)
+}
+
+func TestScopedCachePromote(t *testing.T) {
+	fc, err := New(Index{
+		Index:   "one",
+		Factory: scopeFactory,
+	}, Index{
+		Index:   "two",
+		Factory: scopeFactory,
+	})
+	require.NoError(t, err)
+	_, err = fc.Lookup(ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+	obj := fc.Scope()
+	_, err = obj.Lookup(ByEntry(Entry{
+		Object: "local",
+		Keys:   []Key{{"one", 1}, {"two", 1}},
+	}))
+	require.NoError(t, err)
+
+	err = obj.Promote()
+
+	assert.NoError(t, err)
+	result, err := fc.Lookup(ByKey(Key{"one", 1}), SearchCache)
+	assert.NoError(t, err)
+	assert.Equal(t, "local", result)
+	result, err = fc.Lookup(ByKey(Key{"two", 1}), SearchCache)
+	assert.NoError(t, err)
+	assert.Equal(t, "local", result)
+	assert.Empty(t, obj.local.indexes["one"].entries)
+	assert.Empty(t, obj.local.indexes["two"].entries)
+}
+
+func TestScopedCachePromoteError(t *testing.T) {
+	fc, err := New(Index{
+		Index:   "one",
+		Factory: scopeFactory,
+	})
+	require.NoError(t, err)
+	obj := fc.Scope()
+	_, err = obj.Lookup(ByEntry(Entry{
+		Object: "local",
+		Keys:   []Key{{"one", 1}},
+	}))
+	require.NoError(t, err)
+	delete(fc.indexes, "one")
+
+	err = obj.Promote()
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Empty(t, obj.local.indexes["one"].entries)
+}
+
+func TestScopedCacheDiscard(t *testing.T) {
+	fc, err := New(Index{
+		Index:   "one",
+		Factory: scopeFactory,
+	})
+	require.NoError(t, err)
+	obj := fc.Scope()
+	_, err = obj.Lookup(ByEntry(Entry{
+		Object: "local",
+		Keys:   []Key{{"one", 1}},
+	}))
+	require.NoError(t, err)
+
+	obj.Discard()
+
+	assert.Empty(t, obj.local.indexes["one"].entries)
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, "parent", result)
+}
+
+func TestScopedCacheDiscardTags(t *testing.T) {
+	fc, err := New(Index{
+		Index:   "one",
+		Factory: scopeFactory,
+	})
+	require.NoError(t, err)
+	obj := fc.Scope()
+	_, err = obj.Lookup(ByEntry(Entry{
+		Object: "local",
+		Keys:   []Key{{"one", 1}},
+		Tags:   []string{"a"},
+	}))
+	require.NoError(t, err)
+	require.Len(t, obj.local.tags, 1)
+
+	obj.Discard()
+
+	assert.Empty(t, obj.local.tags)
+	assert.Empty(t, fc.tags)
+}
+
+func TestScopedCacheLookupUncacheable(t *testing.T) {
+	fc, err := New(Index{
+		Index:   "one",
+		Factory: scopeFactory,
+	})
+	require.NoError(t, err)
+	obj := fc.Scope()
+
+	result, err := obj.Lookup(ByEntry(Entry{
+		Error: assert.AnError,
+		Keys:  []Key{{"one", 1}},
+	}))
+
+	assert.Same(t, ErrNotCacheable, err)
+	assert.Nil(t, result)
+	assert.Empty(t, obj.local.indexes["one"].entries)
+}
+
+func TestScopedCacheLookupNoMatchingIndex(t *testing.T) {
+	fc, err := New(Index{
+		Index:   "one",
+		Factory: scopeFactory,
+	})
+	require.NoError(t, err)
+	obj := fc.Scope()
+
+	result, err := obj.Lookup(ByEntry(Entry{
+		Object: "local",
+		Keys:   []Key{{"two", 1}},
+	}))
+
+	assert.Same(t, ErrNoMatchingIndex, err)
+	assert.Nil(t, result)
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import "time"
+
+// Stats contains statistics about the cache.  The lock statistics are
+// only recorded if the cache was constructed with the InstrumentLock
+// option.
+//
+// Lookups that find an entry, including a pending entry, are counted
+// as hits.  Lookups using the SearchCache option that do not find a
+// completed entry are counted as search misses; these are not
+// included in the misses, so that the ratio of hits to misses
+// reflects only lookups that may populate the cache.
+//
+// If the cache was constructed with the ServeStaleOnError option,
+// refreshes that failed with an error that is not cached, and thus
+// kept the stale content, are counted by StaleServed.
+//
+// The factory statistics are only recorded if the cache was
+// constructed with the TrackFactories option.  FactoryCalls and
+// FactoryTime count only completed factory calls, so their ratio is
+// the mean factory latency.
+//
+// Entries removed from the cache by explicit calls, such as Evict,
+// FlushIndex, and Clean, are counted by ExplicitEvictions; each entry
+// is counted once, regardless of how many indexes it was removed from.
+// Entries removed by the cache itself are counted separately by
+// ImplicitEvictions: expired retryable errors, entries displaced by
+// Overwrite, refreshes, or reindexing, completed entries dropped by
+// ReplaceIndex, and entries left without any key by Repair.  Comparing
+// the two shows how much of the cache's turnover is not requested by
+// its callers.
+//
+// The growth of each index is reported by Growth, which maps the index
+// key to an IndexGrowth.
+type Stats struct {
+	Hits              uint64        // Number of lookups that hit
+	Misses            uint64        // Number of lookups that missed
+	SearchMisses      uint64        // Number of cache-only lookups that missed
+	LockAcquisitions  uint64        // Number of times the lock was acquired
+	LockContentions   uint64        // Number of acquisitions that waited
+	LockWait          time.Duration // Total time spent acquiring the lock
+	StaleServed       uint64        // Number of failed refreshes kept stale
+	FactoriesRunning  int           // Number of factory calls in progress
+	OldestFactory     time.Duration // Running time of the oldest factory call
+	SlowFactories     uint64        // Number of factory calls over threshold
+	FactoryCalls      uint64        // Number of completed factory calls
+	FactoryTime       time.Duration // Total time spent in factory calls
+	ExplicitEvictions uint64        // Number of entries evicted explicitly
+	ImplicitEvictions uint64        // Number of entries evicted by the cache
+
+	Growth map[interface{}]IndexGrowth // Growth of each index
+}
+
+// IndexGrowth describes the growth of the entries in an index.  Go maps
+// never shrink, so the memory used by an index is determined by the
+// largest number of entries it has held since its map was allocated,
+// rather than the number it currently holds; this is reported by
+// PeakSinceRealloc, which is reset when the map is reallocated, such as
+// by ReplaceIndex.  Peak is the largest number of entries the index has
+// ever held.  Comparing these to the current size of the index, as
+// reported by SizeByIndex, may be used to detect unbounded growth.
+type IndexGrowth struct {
+	Peak             int // Largest number of entries ever held
+	PeakSinceRealloc int // Largest number of entries since reallocation
+}
+
+// Stats returns a copy of the statistics about the cache.
+func (fc *FCache) Stats() Stats {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Add the factory statistics
+	result := fc.stats
+	result.FactoriesRunning = len(fc.running)
+	for run := range fc.running {
+		if elapsed := now().Sub(run.start); elapsed > result.OldestFactory {
+			result.OldestFactory = elapsed
+		}
+	}
+
+	// Add the growth of the indexes
+	for key, idx := range fc.indexes {
+		if idx.growth == nil {
+			continue
+		}
+		if result.Growth == nil {
+			result.Growth = map[interface{}]IndexGrowth{}
+		}
+		result.Growth[key] = *idx.growth
+	}
+
+	return result
+}
+
+// factoryRun describes a factory function call in progress.  See
+// TrackFactories.
+type factoryRun struct {
+	key   Key         // The key that triggered the call
+	start time.Time   // The time the call started
+	timer *time.Timer // Timer to detect slow calls
+}
+
+// startFactory records the start of a factory function call, if the
+// cache was constructed with the TrackFactories option.  The returned
+// value must be passed to endFactory once the factory returns.  The
+// cache MUST NOT be locked upon entry to this method.
+func (fc *FCache) startFactory(key Key) *factoryRun {
+	if !fc.track {
+		return nil
+	}
+
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Record the call
+	run := &factoryRun{
+		key:   key,
+		start: now(),
+	}
+	if fc.running == nil {
+		fc.running = map[*factoryRun]bool{}
+	}
+	fc.running[run] = true
+
+	// Watch for slow calls
+	if fc.slowAfter > 0 {
+		run.timer = time.AfterFunc(fc.slowAfter, func() {
+			fc.slowFactory(run)
+		})
+	}
+
+	return run
+}
+
+// slowFactory is called when a factory function call has been running
+// for longer than the threshold.  It MUST be called as a goroutine.
+func (fc *FCache) slowFactory(run *factoryRun) {
+	// Lock the cache
+	fc.Lock()
+
+	// Skip calls that have completed
+	if !fc.running[run] {
+		fc.Unlock()
+		return
+	}
+	fc.stats.SlowFactories++
+	elapsed := now().Sub(run.start)
+	fc.Unlock()
+
+	// Call the callback with the lock released
+	if fc.onSlow != nil {
+		fc.onSlow(run.key, elapsed)
+	}
+}
+
+// endFactory records the end of a factory function call started with
+// startFactory.  The cache MUST be locked upon entry to this method.
+func (fc *FCache) endFactory(run *factoryRun) {
+	if run == nil {
+		return
+	}
+
+	if run.timer != nil {
+		run.timer.Stop()
+	}
+	delete(fc.running, run)
+	fc.stats.FactoryCalls++
+	fc.stats.FactoryTime += now().Sub(run.start)
+}
+
+// IndexSize contains counts of the entries in an index.  Completed
+// entries include cached errors, which are also counted by Errors.
+type IndexSize struct {
+	Completed int // Number of completed entries
+	Pending   int // Number of pending entries
+	Errors    int // Number of completed entries with errors
+}
+
+// SizeByIndex returns the counts of the entries in each index of the
+// cache.
+func (fc *FCache) SizeByIndex() map[interface{}]IndexSize {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Count the entries in each index
+	result := make(map[interface{}]IndexSize, len(fc.indexes))
+	for key, idx := range fc.indexes {
+		result[key] = idx.size()
+	}
+
+	return result
+}
+
+// size counts the entries in the index.  The cache MUST be locked upon
+// entry to this method.
+func (idx index) size() IndexSize {
+	result := IndexSize{}
+	for _, ent := range idx.entries {
+		switch {
+		case ent.content == nil:
+			result.Pending++
+		case ent.content.Error != nil:
+			result.Completed++
+			result.Errors++
+		default:
+			result.Completed++
+		}
+	}
+
+	return result
+}
+
+// AccessStats returns the number of lookups that have hit each entry
+// in the specified cache index, as a map from the key within the
+// index to the count.  An entry cached by a factory function is
+// shared by all the indexes listed in its keys, so lookups using any
+// of those keys are counted.  The count is reset when the entry is
+// replaced, such as by a refresh.  If the index has a KeyHasher, the
+// map is keyed by the values returned by the KeyHasher.
+func (fc *FCache) AccessStats(index interface{}) (map[interface{}]uint64, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return nil, ErrBadIndex
+	}
+
+	// Collect the counts
+	result := make(map[interface{}]uint64, len(idx.entries))
+	for key, ent := range idx.entries {
+		result[key] = ent.hits
+	}
+
+	return result, nil
+}
+
+// AgeRange returns the times at which the oldest and newest completed
+// entries in the specified cache index were cached, as recorded in
+// their CreatedAt fields.  Cached errors are included.  If the index
+// has no completed entries, zero times are returned along with
+// ErrEmptyIndex.
+func (fc *FCache) AgeRange(index interface{}) (time.Time, time.Time, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return time.Time{}, time.Time{}, ErrBadIndex
+	}
+
+	// Find the oldest and newest entries
+	var oldest, newest time.Time
+	found := false
+	for _, ent := range idx.entries {
+		if ent.content == nil {
+			continue
+		}
+
+		created := ent.content.CreatedAt
+		if !found || created.Before(oldest) {
+			oldest = created
+		}
+		if !found || created.After(newest) {
+			newest = created
+		}
+		found = true
+	}
+
+	if !found {
+		return time.Time{}, time.Time{}, ErrEmptyIndex
+	}
+
+	return oldest, newest, nil
+}
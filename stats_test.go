@@ -0,0 +1,312 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/klmitch/patcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFCacheStats(t *testing.T) {
+	obj := &FCache{
+		stats: Stats{
+			LockAcquisitions: 5,
+			LockContentions:  2,
+			LockWait:         time.Second,
+		},
+	}
+
+	result := obj.Stats()
+
+	assert.Equal(t, Stats{
+		LockAcquisitions: 5,
+		LockContentions:  2,
+		LockWait:         time.Second,
+	}, result)
+}
+
+func TestFCacheStatsGrowth(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				growth: &IndexGrowth{
+					Peak:             5,
+					PeakSinceRealloc: 3,
+				},
+			},
+			"two": {},
+		},
+	}
+
+	result := obj.Stats()
+
+	assert.Equal(t, Stats{
+		Growth: map[interface{}]IndexGrowth{
+			"one": {
+				Peak:             5,
+				PeakSinceRealloc: 3,
+			},
+		},
+	}, result)
+}
+
+func TestFCacheSizeByIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "o1",
+						},
+					},
+					2: {
+						content: &Entry{
+							Error: &PermanentError{assert.AnError},
+						},
+					},
+					3: {},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result := obj.SizeByIndex()
+
+	assert.Equal(t, map[interface{}]IndexSize{
+		"one": {
+			Completed: 2,
+			Pending:   1,
+			Errors:    1,
+		},
+		"two": {},
+	}, result)
+}
+
+func TestFCacheStatsFactories(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	obj := &FCache{
+		running: map[*factoryRun]bool{
+			{start: time.Unix(990, 0)}: true,
+			{start: time.Unix(995, 0)}: true,
+		},
+	}
+
+	result := obj.Stats()
+
+	assert.Equal(t, Stats{
+		FactoriesRunning: 2,
+		OldestFactory:    10 * time.Second,
+	}, result)
+}
+
+func TestFCacheStartFactoryUntracked(t *testing.T) {
+	obj := &FCache{}
+
+	result := obj.startFactory(Key{"one", 1})
+
+	assert.Nil(t, result)
+	assert.Nil(t, obj.running)
+}
+
+func TestFCacheStartFactoryTracked(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	obj := &FCache{
+		track: true,
+	}
+
+	result := obj.startFactory(Key{"one", 1})
+
+	assert.Equal(t, &factoryRun{
+		key:   Key{"one", 1},
+		start: time.Unix(1000, 0),
+	}, result)
+	assert.Equal(t, map[*factoryRun]bool{
+		result: true,
+	}, obj.running)
+}
+
+func TestFCacheStartFactorySlow(t *testing.T) {
+	called := make(chan Key, 1)
+	obj := &FCache{
+		track:     true,
+		slowAfter: time.Millisecond,
+		onSlow: func(key Key, elapsed time.Duration) {
+			called <- key
+		},
+	}
+
+	run := obj.startFactory(Key{"one", 1})
+
+	assert.Equal(t, Key{"one", 1}, <-called)
+	obj.Lock()
+	defer obj.Unlock()
+	assert.Equal(t, uint64(1), obj.stats.SlowFactories)
+	obj.endFactory(run)
+	assert.Len(t, obj.running, 0)
+}
+
+func TestFCacheSlowFactoryCompleted(t *testing.T) {
+	obj := &FCache{
+		running: map[*factoryRun]bool{},
+		onSlow: func(key Key, elapsed time.Duration) {
+			t.Fail()
+		},
+	}
+
+	obj.slowFactory(&factoryRun{})
+
+	assert.Equal(t, uint64(0), obj.stats.SlowFactories)
+}
+
+func TestFCacheEndFactory(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer patcher.SetVar(&now, func() time.Time {
+		return start.Add(5 * time.Second)
+	}).Install().Restore()
+	run := &factoryRun{
+		start: start,
+		timer: time.AfterFunc(time.Hour, func() {}),
+	}
+	obj := &FCache{
+		running: map[*factoryRun]bool{
+			run: true,
+		},
+		stats: Stats{
+			FactoryCalls: 1,
+			FactoryTime:  time.Second,
+		},
+	}
+
+	obj.endFactory(run)
+
+	assert.Len(t, obj.running, 0)
+	assert.False(t, run.timer.Stop())
+	assert.Equal(t, uint64(2), obj.stats.FactoryCalls)
+	assert.Equal(t, 6*time.Second, obj.stats.FactoryTime)
+}
+
+func TestFCacheEndFactoryNil(t *testing.T) {
+	obj := &FCache{}
+
+	obj.endFactory(nil)
+}
+
+func TestFCacheAccessStatsBase(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{},
+						hits:    5,
+					},
+					2: {
+						hits: 2,
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.AccessStats("one")
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]uint64{
+		1: 5,
+		2: 2,
+	}, result)
+}
+
+func TestFCacheAccessStatsBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.AccessStats("one")
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheAgeRangeBase(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							CreatedAt: base.Add(time.Minute),
+						},
+					},
+					2: {
+						content: &Entry{
+							CreatedAt: base,
+						},
+					},
+					3: {
+						content: &Entry{
+							CreatedAt: base.Add(time.Hour),
+						},
+					},
+					4: {},
+				},
+			},
+		},
+	}
+
+	oldest, newest, err := obj.AgeRange("one")
+
+	assert.NoError(t, err)
+	assert.Equal(t, base, oldest)
+	assert.Equal(t, base.Add(time.Hour), newest)
+}
+
+func TestFCacheAgeRangeEmpty(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {},
+				},
+			},
+		},
+	}
+
+	oldest, newest, err := obj.AgeRange("one")
+
+	assert.Same(t, ErrEmptyIndex, err)
+	assert.True(t, oldest.IsZero())
+	assert.True(t, newest.IsZero())
+}
+
+func TestFCacheAgeRangeBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	oldest, newest, err := obj.AgeRange("one")
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.True(t, oldest.IsZero())
+	assert.True(t, newest.IsZero())
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+// tagSet is a set of cached entries sharing a tag.
+type tagSet map[*Entry]bool
+
+// tag records the tags of a cached entry.  The cache MUST be locked
+// upon entry to this method.
+func (fc *FCache) tag(ent *Entry) {
+	for _, t := range ent.Tags {
+		if fc.tags == nil {
+			fc.tags = map[string]tagSet{}
+		}
+		if fc.tags[t] == nil {
+			fc.tags[t] = tagSet{}
+		}
+		fc.tags[t][ent] = true
+	}
+}
+
+// untag forgets the tags of an entry that is no longer cached.  An
+// entry still cached under any of its keys is not forgotten.  The
+// cache MUST be locked upon entry to this method.
+func (fc *FCache) untag(ent *Entry) {
+	if len(ent.Tags) == 0 || fc.cached(ent) {
+		return
+	}
+
+	for _, t := range ent.Tags {
+		delete(fc.tags[t], ent)
+		if len(fc.tags[t]) == 0 {
+			delete(fc.tags, t)
+		}
+	}
+}
+
+// EvictByTag removes all completed entries with the specified tag from
+// the cache.  As with Evict, the entries are removed from all indexes.
+// Returns the number of entries evicted, or ErrNoTag if the tag is
+// empty.  Entries are tagged with the Tags of the Entry when they are
+// cached; changing the Tags of a cached entry has no effect.
+func (fc *FCache) EvictByTag(tag string) (int, error) {
+	if tag == "" {
+		return 0, ErrNoTag
+	}
+
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Find the entries to evict
+	toEvict := []*Entry{}
+	for ent := range fc.tags[tag] {
+		if fc.cached(ent) {
+			toEvict = append(toEvict, ent)
+		}
+	}
+	delete(fc.tags, tag)
+
+	// Evict the entries
+	for _, ent := range toEvict {
+		fc.evict(ent.Keys)
+	}
+	fc.stats.ExplicitEvictions += uint64(len(toEvict))
+
+	return len(toEvict), nil
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFCacheTagBase(t *testing.T) {
+	ent1 := &Entry{Tags: []string{"a", "b"}}
+	ent2 := &Entry{Tags: []string{"b"}}
+	obj := &FCache{}
+
+	obj.tag(ent1)
+	obj.tag(ent2)
+
+	assert.Equal(t, map[string]tagSet{
+		"a": {ent1: true},
+		"b": {ent1: true, ent2: true},
+	}, obj.tags)
+}
+
+func TestFCacheTagUntagged(t *testing.T) {
+	obj := &FCache{}
+
+	obj.tag(&Entry{})
+
+	assert.Nil(t, obj.tags)
+}
+
+func TestFCacheUntagBase(t *testing.T) {
+	ent1 := &Entry{
+		Keys: []Key{{"one", 1}},
+		Tags: []string{"a", "b"},
+	}
+	ent2 := &Entry{Tags: []string{"b"}}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+		tags: map[string]tagSet{
+			"a": {ent1: true},
+			"b": {ent1: true, ent2: true},
+		},
+	}
+
+	obj.untag(ent1)
+
+	assert.Equal(t, map[string]tagSet{
+		"b": {ent2: true},
+	}, obj.tags)
+}
+
+func TestFCacheUntagCached(t *testing.T) {
+	ent := &Entry{
+		Keys: []Key{{"one", 1}},
+		Tags: []string{"a"},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {content: ent},
+				},
+			},
+		},
+		tags: map[string]tagSet{
+			"a": {ent: true},
+		},
+	}
+
+	obj.untag(ent)
+
+	assert.Equal(t, map[string]tagSet{
+		"a": {ent: true},
+	}, obj.tags)
+}
+
+func TestFCacheCachedTrue(t *testing.T) {
+	ent := &Entry{
+		Keys: []Key{{"missing", 0}, {"one", 2}, {"one", 1}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {content: ent},
+				},
+			},
+		},
+	}
+
+	result := obj.cached(ent)
+
+	assert.True(t, result)
+}
+
+func TestFCacheCachedFalse(t *testing.T) {
+	ent := &Entry{
+		Keys: []Key{{"one", 1}},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {content: &Entry{}},
+				},
+			},
+		},
+	}
+
+	result := obj.cached(ent)
+
+	assert.False(t, result)
+}
+
+func TestFCacheEvictByTagBase(t *testing.T) {
+	obj, err := New(Index{
+		Index:   "one",
+		Factory: factory,
+	}, Index{
+		Index:   "two",
+		Factory: factory,
+	})
+	require.NoError(t, err)
+	err = obj.StoreMany([]Entry{
+		{Object: 1, Keys: []Key{{"one", 1}, {"two", 1}}, Tags: []string{"tenant:1"}},
+		{Object: 2, Keys: []Key{{"one", 2}}, Tags: []string{"tenant:1", "tenant:2"}},
+		{Object: 3, Keys: []Key{{"one", 3}}, Tags: []string{"tenant:2"}},
+		{Object: 4, Keys: []Key{{"one", 4}}},
+	})
+	require.NoError(t, err)
+
+	result, err := obj.EvictByTag("tenant:1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result)
+	assert.Len(t, obj.indexes["one"].entries, 2)
+	assert.Len(t, obj.indexes["two"].entries, 0)
+	assert.Equal(t, uint64(2), obj.stats.ExplicitEvictions)
+	require.Len(t, obj.tags, 1)
+	assert.Len(t, obj.tags["tenant:2"], 1)
+}
+
+func TestFCacheEvictByTagRemoved(t *testing.T) {
+	ent := &Entry{
+		Keys: []Key{{"one", 1}},
+		Tags: []string{"a"},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+		tags: map[string]tagSet{
+			"a": {ent: true},
+		},
+	}
+
+	result, err := obj.EvictByTag("a")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result)
+	assert.Empty(t, obj.tags)
+}
+
+func TestFCacheEvictByTagNoTag(t *testing.T) {
+	obj := &FCache{}
+
+	result, err := obj.EvictByTag("")
+
+	assert.Same(t, ErrNoTag, err)
+	assert.Equal(t, 0, result)
+}
+
+func TestFCacheEvictByTagRefreshed(t *testing.T) {
+	obj, err := New(Index{
+		Index:   "one",
+		Factory: factory,
+	})
+	require.NoError(t, err)
+	_, err = obj.Lookup(ByEntry(Entry{
+		Object: "old",
+		Keys:   []Key{{"one", 1}},
+		Tags:   []string{"a"},
+	}))
+	require.NoError(t, err)
+
+	_, err = obj.Lookup(ByEntry(Entry{
+		Object: "new",
+		Keys:   []Key{{"one", 1}},
+		Tags:   []string{"b"},
+	}), Overwrite)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]tagSet{
+		"b": {obj.indexes["one"].entries[1].content: true},
+	}, obj.tags)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+// Update atomically updates the object cached with the specified key.
+// The function is called with the cache locked and is passed the
+// current object, and the object it returns replaces the current object
+// in all indexes referring to it, and the entry is given a new Version;
+// the new object is also returned.  If the key is not present in the
+// cache, or the entry is pending, the function is passed nil, and the
+// returned object is inserted into the cache with the specified key,
+// completing any pending entry.  If the entry is a cached error, the
+// function is not called and the error is returned.  The function must
+// not call any methods of the cache.
+func (fc *FCache) Update(key Key, fn func(current interface{}) interface{}) (interface{}, error) {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[key.Index]
+	if !ok {
+		return nil, ErrBadIndex
+	}
+
+	// Update a completed entry
+	if ent, ok := idx.entries[idx.hash(key.Key)]; ok && ent.content != nil {
+		if ent.content.Error != nil {
+			return nil, ent.content.Error
+		}
+
+		ent.content.Object = fn(ent.content.Object)
+		ent.content.Version = fc.nextVersion()
+		return ent.content.Object, nil
+	}
+
+	// Insert a new entry
+	obj := fn(nil)
+	fc.insert(&Entry{
+		Object: obj,
+		Keys:   []Key{key},
+	})
+
+	return obj, nil
+}
+
+// UpdateRange walks all the completed entries in the specified cache
+// index, calling the function on each of them with the cache locked.
+// The function is passed a copy of the entry, and returns the entry to
+// keep and a flag indicating whether to keep it.  If the flag is true,
+// the Object and Error of the returned entry replace those of the
+// cached entry in all indexes referring to it, and the entry is given a
+// new Version; the Keys of the returned entry are ignored, and Reindex
+// should be used to change them.  If the flag is false, or the returned
+// entry has an error that may not be cached, the entry is evicted from
+// all indexes.  Evictions are applied after all the entries have been
+// visited.  Pending entries are skipped.  The function must not call
+// any methods of the cache.  This allows, for instance, migrating the
+// cached objects to a new schema in place.
+func (fc *FCache) UpdateRange(index interface{}, fn func(Entry) (Entry, bool)) error {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look for the index
+	idx, ok := fc.indexes[index]
+	if !ok {
+		return ErrBadIndex
+	}
+
+	// Visit the entries
+	seen := map[*Entry]bool{}
+	toEvict := []*Entry{}
+	for _, ent := range idx.entries {
+		if ent.content == nil || seen[ent.content] {
+			continue
+		}
+		seen[ent.content] = true
+
+		// Call the function with a copy of the entry
+		result, keep := fn(ent.content.Clone())
+		if !keep || !isCacheable(result.Error) {
+			toEvict = append(toEvict, ent.content)
+			continue
+		}
+
+		// Update the entry
+		ent.content.Object = result.Object
+		ent.content.Error = result.Error
+		ent.content.Version = fc.nextVersion()
+	}
+
+	// Evict the entries
+	for _, content := range toEvict {
+		fc.evict(content.Keys)
+	}
+	fc.stats.ExplicitEvictions += uint64(len(toEvict))
+
+	return nil
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func increment(current interface{}) interface{} {
+	if current == nil {
+		return 1
+	}
+
+	return current.(int) + 1
+}
+
+func TestFCacheUpdateCompleted(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: 1,
+			Keys:   []Key{{"one", 1}, {"two", 2}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: ent,
+				},
+			},
+		},
+	}
+
+	result, err := obj.Update(Key{"one", 1}, increment)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result)
+	assert.Equal(t, 2, obj.indexes["two"].entries[2].content.Object)
+	assert.Equal(t, uint64(1), ent.content.Version)
+}
+
+func TestFCacheUpdateIfVersion(t *testing.T) {
+	obj, err := New(Index{
+		Index:   "one",
+		Factory: factory,
+	})
+	require.NoError(t, err)
+	_, err = obj.Update(Key{"one", 1}, increment)
+	require.NoError(t, err)
+	ent, err := obj.Inspect(ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+	_, err = obj.Update(Key{"one", 1}, increment)
+	require.NoError(t, err)
+
+	_, err = obj.Lookup(ByEntry(Entry{
+		Object: 5,
+		Keys:   []Key{{"one", 1}},
+	}), Overwrite, IfVersion(ent.Version))
+
+	assert.Same(t, ErrVersionConflict, err)
+	result, err := obj.Lookup(ByKey(Key{"one", 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result)
+}
+
+func TestFCacheUpdateError(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Error: &PermanentError{assert.AnError},
+							Keys:  []Key{{"one", 1}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.Update(Key{"one", 1}, func(current interface{}) interface{} {
+		t.Fail()
+		return nil
+	})
+
+	assert.Equal(t, &PermanentError{assert.AnError}, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheUpdateMiss(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+
+	result, err := obj.Update(Key{"one", 1}, increment)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+	assert.Equal(t, 1, obj.indexes["one"].entries[1].content.Object)
+}
+
+func TestFCacheUpdatePending(t *testing.T) {
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: pending,
+				},
+			},
+		},
+	}
+
+	result, err := obj.Update(Key{"one", 1}, increment)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+	assert.Equal(t, 1, pending.content.Object)
+}
+
+func TestFCacheUpdateBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.Update(Key{"one", 1}, increment)
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheUpdateRangeBase(t *testing.T) {
+	ent1 := &entry{
+		content: &Entry{
+			Object:  1,
+			Keys:    []Key{{"one", 1}, {"two", 1}},
+			Version: 1,
+		},
+	}
+	ent2 := &entry{
+		content: &Entry{
+			Object:  2,
+			Keys:    []Key{{"one", 2}, {"two", 2}},
+			Version: 2,
+		},
+	}
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent1,
+					2: ent2,
+					3: pending,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					1: ent1,
+					2: ent2,
+				},
+			},
+		},
+		version: 2,
+	}
+	calls := 0
+
+	err := obj.UpdateRange("one", func(e Entry) (Entry, bool) {
+		calls++
+		e.Keys[0] = Key{"three", 3}
+		if e.Object.(int) == 2 {
+			return e, false
+		}
+		e.Object = "migrated"
+		return e, true
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, &Entry{
+		Object:  "migrated",
+		Keys:    []Key{{"one", 1}, {"two", 1}},
+		Version: 3,
+	}, ent1.content)
+	assert.Equal(t, map[interface{}]*entry{
+		1: ent1,
+		3: pending,
+	}, obj.indexes["one"].entries)
+	assert.Equal(t, map[interface{}]*entry{
+		1: ent1,
+	}, obj.indexes["two"].entries)
+	assert.Equal(t, uint64(1), obj.stats.ExplicitEvictions)
+}
+
+func TestFCacheUpdateRangeKeys(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: 1,
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.UpdateRange("one", func(e Entry) (Entry, bool) {
+		e.Keys[0] = Key{"one", 2}
+		return e, true
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Key{{"one", 1}}, ent.content.Keys)
+}
+
+func TestFCacheUpdateRangeTags(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: 1,
+			Keys:   []Key{{"one", 1}},
+			Tags:   []string{"a"},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.UpdateRange("one", func(e Entry) (Entry, bool) {
+		e.Tags[0] = "b"
+		return e, true
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, ent.content.Tags)
+}
+
+func TestFCacheUpdateRangeUncacheable(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: 1,
+			Keys:   []Key{{"one", 1}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+
+	err := obj.UpdateRange("one", func(e Entry) (Entry, bool) {
+		e.Error = assert.AnError
+		return e, true
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, obj.indexes["one"].entries, 0)
+	assert.Nil(t, ent.content.Error)
+	assert.Equal(t, uint64(1), obj.stats.ExplicitEvictions)
+}
+
+func TestFCacheUpdateRangeBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.UpdateRange("one", func(e Entry) (Entry, bool) {
+		t.Fatal("function called")
+		return e, true
+	})
+
+	assert.Same(t, ErrBadIndex, err)
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+// Inconsistency describes a key in the cache that refers to an entry
+// whose keys do not include that key.  Such orphaned keys may be
+// removed using Repair.  For indexes with a KeyHasher, the key is the
+// value returned by the KeyHasher.
+type Inconsistency struct {
+	Key   Key   // The orphaned key
+	Entry Entry // The entry the key refers to
+}
+
+// inconsistencies is a helper for Verify and Repair that locates all
+// the orphaned keys in the cache.  Pending entries are not checked.
+// The cache MUST be locked upon entry to this method.
+func (fc *FCache) inconsistencies() []Inconsistency {
+	var result []Inconsistency
+	for index, idx := range fc.indexes {
+		for key, ent := range idx.entries {
+			if ent.content == nil {
+				continue
+			}
+
+			k := Key{
+				Index: index,
+				Key:   key,
+			}
+			if !idx.keyListed(ent.content.Keys, k) {
+				result = append(result, Inconsistency{
+					Key:   k,
+					Entry: *ent.content,
+				})
+			}
+		}
+	}
+
+	return result
+}
+
+// Verify scans all the indexes in the cache and reports any keys
+// referring to an entry whose keys do not include that key.  The
+// order of the returned inconsistencies is undefined.
+func (fc *FCache) Verify() []Inconsistency {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	return fc.inconsistencies()
+}
+
+// Repair removes any keys reported by Verify from the cache.  Returns
+// the inconsistencies that were repaired.  The tags of entries that
+// are no longer cached under any of their keys are forgotten.
+func (fc *FCache) Repair() []Inconsistency {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Remove the orphaned keys
+	result := fc.inconsistencies()
+	removed := make([]*Entry, 0, len(result))
+	for _, inc := range result {
+		entries := fc.indexes[inc.Key.Index].entries
+		removed = append(removed, entries[inc.Key.Key].content)
+		delete(entries, inc.Key.Key)
+	}
+
+	// Forget the tags of the removed entries, counting those no
+	// longer cached under any of their keys
+	for _, content := range removed {
+		if !fc.cached(content) {
+			fc.stats.ImplicitEvictions++
+		}
+		fc.untag(content)
+	}
+
+	return result
+}
+
+// MissingIndexes reports the indexes that do not hold the specified
+// entry under its keys.  The entry should have been obtained from the
+// cache, such as with Inspect or Contents.  As with ReindexEntry, the
+// cached entry is located using the first of its keys that holds a
+// completed entry listing that key, as Verify requires; the entry
+// passed in may be stale, since only its keys are used.  An index is
+// reported if it does not exist, if it has no completed entry under a
+// key of the entry in that index, or if the completed entry it has is
+// a different entry.  Each index is reported at most once, in the
+// order in which it appears in the entry's Keys.
+func (fc *FCache) MissingIndexes(ent Entry) []interface{} {
+	// Lock the cache
+	fc.Lock()
+	defer fc.Unlock()
+
+	// Look up the entry under each of the keys
+	found := make([]*Entry, len(ent.Keys))
+	var content *Entry
+	for i, k := range ent.Keys {
+		idx, ok := fc.indexes[k.Index]
+		if !ok {
+			continue
+		}
+
+		key := idx.hash(k.Key)
+		if e, ok := idx.entries[key]; ok && e.content != nil {
+			found[i] = e.content
+			if content == nil && idx.keyListed(e.content.Keys, Key{Index: k.Index, Key: key}) {
+				content = e.content
+			}
+		}
+	}
+
+	// Check each of the keys
+	var result []interface{}
+	seen := map[interface{}]bool{}
+	for i, k := range ent.Keys {
+		if seen[k.Index] || (content != nil && found[i] == content) {
+			continue
+		}
+
+		seen[k.Index] = true
+		result = append(result, k.Index)
+	}
+
+	return result
+}
@@ -0,0 +1,367 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyListedTrue(t *testing.T) {
+	result := index{}.keyListed([]Key{{"one", 1}, {"two", []int{2}}}, Key{"two", []int{2}})
+
+	assert.True(t, result)
+}
+
+func TestKeyListedFalse(t *testing.T) {
+	result := index{}.keyListed([]Key{{"one", 1}, {"two", 2}}, Key{"one", 2})
+
+	assert.False(t, result)
+}
+
+func TestFCacheVerify(t *testing.T) {
+	good := &entry{
+		content: &Entry{
+			Object: "good",
+			Keys:   []Key{{"one", 1}, {"two", 1}},
+		},
+	}
+	bad := &entry{
+		content: &Entry{
+			Object: "bad",
+			Keys:   []Key{{"one", 2}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: good,
+					2: bad,
+					3: {},
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					1: good,
+					2: bad,
+				},
+			},
+		},
+	}
+
+	result := obj.Verify()
+
+	assert.Equal(t, []Inconsistency{
+		{
+			Key:   Key{"two", 2},
+			Entry: *bad.content,
+		},
+	}, result)
+	assert.Len(t, obj.indexes["two"].entries, 2)
+}
+
+func TestFCacheRepair(t *testing.T) {
+	good := &entry{
+		content: &Entry{
+			Object: "good",
+			Keys:   []Key{{"one", 1}, {"two", 1}},
+		},
+	}
+	bad := &entry{
+		content: &Entry{
+			Object: "bad",
+			Keys:   []Key{{"one", 2}},
+		},
+	}
+	pending := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: good,
+					2: bad,
+					3: pending,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					1: good,
+					2: bad,
+				},
+			},
+		},
+	}
+
+	result := obj.Repair()
+
+	assert.Equal(t, []Inconsistency{
+		{
+			Key:   Key{"two", 2},
+			Entry: *bad.content,
+		},
+	}, result)
+	assert.Equal(t, map[interface{}]index{
+		"one": {
+			entries: map[interface{}]*entry{
+				1: good,
+				2: bad,
+				3: pending,
+			},
+		},
+		"two": {
+			entries: map[interface{}]*entry{
+				1: good,
+			},
+		},
+	}, obj.indexes)
+}
+
+func TestFCacheRepairTags(t *testing.T) {
+	bad := &Entry{
+		Object: "bad",
+		Keys:   []Key{{"one", 1}},
+		Tags:   []string{"a"},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: {content: bad},
+				},
+			},
+		},
+		tags: map[string]tagSet{
+			"a": {bad: true},
+		},
+	}
+
+	result := obj.Repair()
+
+	assert.Len(t, result, 1)
+	assert.Empty(t, obj.tags)
+	assert.Equal(t, uint64(1), obj.stats.ImplicitEvictions)
+}
+
+func TestFCacheMissingIndexesBase(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object:  "object",
+			Keys:    []Key{{"one", 1}, {"two", 2}},
+			Version: 3,
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: ent,
+				},
+			},
+		},
+	}
+
+	result := obj.MissingIndexes(ent.content.Clone())
+
+	assert.Empty(t, result)
+}
+
+func TestFCacheMissingIndexesMissing(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object:  "object",
+			Keys:    []Key{{"one", 1}, {"two", 2}, {"two", 22}, {"three", 3}, {"four", 4}, {"five", 5}},
+			Version: 3,
+		},
+	}
+	other := &entry{
+		content: &Entry{
+			Object:  "other",
+			Keys:    []Key{{"three", 3}},
+			Version: 4,
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2:  ent,
+					22: other,
+				},
+			},
+			"three": {
+				entries: map[interface{}]*entry{
+					3: other,
+				},
+			},
+			"four": {
+				entries: map[interface{}]*entry{
+					4: {},
+				},
+			},
+		},
+	}
+
+	result := obj.MissingIndexes(ent.content.Clone())
+
+	assert.Equal(t, []interface{}{"two", "three", "four", "five"}, result)
+}
+
+func TestFCacheMissingIndexesUpdated(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object:  "object",
+			Keys:    []Key{{"one", 1}, {"two", 2}},
+			Version: 3,
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: ent,
+				},
+			},
+		},
+		version: 3,
+	}
+	snapshot := ent.content.Clone()
+	_, err := obj.Update(Key{"one", 1}, func(current interface{}) interface{} {
+		return "updated"
+	})
+	require.NoError(t, err)
+
+	result := obj.MissingIndexes(snapshot)
+
+	assert.Empty(t, result)
+}
+
+func TestFCacheMissingIndexesReindexed(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object:  "object",
+			Keys:    []Key{{"one", 1}, {"two", 2}},
+			Version: 3,
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: ent,
+				},
+			},
+		},
+		version: 3,
+	}
+	snapshot := ent.content.Clone()
+	err := obj.Reindex([]Key{{"one", 1}, {"two", 22}}, ByKey(Key{"one", 1}))
+	require.NoError(t, err)
+
+	result := obj.MissingIndexes(snapshot)
+
+	assert.Equal(t, []interface{}{"two"}, result)
+}
+
+func TestFCacheMissingIndexesUnversioned(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 1}, {"two", 2}},
+		},
+	}
+	other := &entry{
+		content: &Entry{
+			Object: "other",
+			Keys:   []Key{{"two", 2}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: other,
+				},
+			},
+		},
+	}
+
+	result := obj.MissingIndexes(ent.content.Clone())
+
+	assert.Equal(t, []interface{}{"two"}, result)
+}
+
+func TestFCacheMissingIndexesOrphaned(t *testing.T) {
+	ent := &entry{
+		content: &Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 1}, {"two", 2}},
+		},
+	}
+	other := &entry{
+		content: &Entry{
+			Object: "other",
+			Keys:   []Key{{"three", 3}},
+		},
+	}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: other,
+				},
+			},
+			"two": {
+				entries: map[interface{}]*entry{
+					2: ent,
+				},
+			},
+		},
+	}
+
+	result := obj.MissingIndexes(ent.content.Clone())
+
+	assert.Equal(t, []interface{}{"one"}, result)
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import "context"
+
+// WaitFor waits until the specified key is present in the cache, or
+// until the context is done, and returns the object.  The index
+// factory function is never invoked.  If a completed entry is present,
+// it is returned immediately; if the entry is pending, WaitFor waits
+// for it to be completed.  If the key is not present, or the entry is
+// a retryable error that has expired, WaitFor waits until a completed
+// entry for the key is added to the cache by some other caller.
+func (fc *FCache) WaitFor(ctx context.Context, key Key) (interface{}, error) {
+	// Lock the cache
+	fc.Lock()
+
+	// Look for the index, constructing it if needed
+	idx, err := fc.findIndex(key.Index)
+	if err != nil {
+		fc.Unlock()
+		return nil, err
+	}
+
+	// If the entry is present, wait on it; expired retryable errors
+	// are treated as a miss
+	hk := idx.hash(key.Key)
+	if ent, ok := idx.entries[hk]; ok && (ent.content == nil || !isExpired(ent.content.Error)) {
+		if ent.content != nil {
+			defer fc.Unlock()
+			return ent.content.Object, ent.content.Error
+		}
+
+		f := ent.makeFuture(fc)
+		fc.Unlock()
+		defer f.Cancel()
+		return f.WaitWithContext(ctx)
+	}
+
+	// Register as a waiter for the key
+	if idx.waiters == nil {
+		idx.waiters = map[interface{}]*waiter{}
+		fc.indexes[key.Index] = idx
+	}
+	waiters := idx.waiters
+	w, ok := waiters[hk]
+	if !ok {
+		w = &waiter{
+			ent: &entry{},
+		}
+		waiters[hk] = w
+	}
+	w.count++
+	f := w.ent.makeFuture(fc)
+	fc.Unlock()
+
+	// Wait for the key to be added
+	obj, err := f.WaitWithContext(ctx)
+	f.Cancel()
+
+	// Stop waiting
+	fc.Lock()
+	defer fc.Unlock()
+	w.count--
+	if w.count <= 0 && waiters[hk] == w {
+		delete(waiters, hk)
+	}
+
+	return obj, err
+}
+
+// WaitSize waits until the specified cache index contains at least n
+// completed entries, or until the context is done, in which case the
+// context error is returned.  The index factory function is never
+// invoked.  This may be used to wait for the cache to be warmed up.
+func (fc *FCache) WaitSize(ctx context.Context, index interface{}, n int) error {
+	for {
+		// Lock the cache
+		fc.Lock()
+
+		// Look for the index
+		idx, ok := fc.indexes[index]
+		if !ok {
+			fc.Unlock()
+			return ErrBadIndex
+		}
+
+		// Count the completed entries
+		size := 0
+		for _, ent := range idx.entries {
+			if ent.content != nil {
+				size++
+			}
+		}
+		if size >= n {
+			fc.Unlock()
+			return nil
+		}
+
+		// Wait for content to be added
+		if fc.changed == nil {
+			fc.changed = make(chan struct{})
+		}
+		changed := fc.changed
+		fc.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
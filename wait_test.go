@@ -0,0 +1,263 @@
+// Copyright (c) 2020 Kevin L. Mitchell
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you
+// may not use this file except in compliance with the License.  You
+// may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/klmitch/patcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexNotify(t *testing.T) {
+	w := &waiter{
+		ent: &entry{},
+	}
+	idx := index{
+		waiters: map[interface{}]*waiter{
+			1: w,
+		},
+	}
+	content := &Entry{
+		Object: "object",
+	}
+
+	idx.notify(1, content)
+	idx.notify(2, content)
+
+	assert.Equal(t, map[interface{}]*waiter{}, idx.waiters)
+	assert.Same(t, content, w.ent.content)
+}
+
+func TestFCacheWaitForCompleted(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := obj.WaitFor(context.Background(), Key{"one", 1})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+}
+
+func TestFCacheWaitForPending(t *testing.T) {
+	ent := &entry{}
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: ent,
+				},
+			},
+		},
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		obj.Lock()
+		defer obj.Unlock()
+		ent.complete(&Entry{
+			Object: "object",
+		})
+	}()
+
+	result, err := obj.WaitFor(context.Background(), Key{"one", 1})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+}
+
+func TestFCacheWaitForAbsent(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+	go func() {
+		for {
+			obj.Lock()
+			if len(obj.indexes["one"].waiters) > 0 {
+				break
+			}
+			obj.Unlock()
+			time.Sleep(time.Millisecond)
+		}
+		defer obj.Unlock()
+		obj.insert(&Entry{
+			Object: "object",
+			Keys:   []Key{{"one", 1}},
+		})
+	}()
+
+	result, err := obj.WaitFor(context.Background(), Key{"one", 1})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "object", result)
+	assert.Len(t, obj.indexes["one"].waiters, 0)
+}
+
+func TestFCacheWaitForExpired(t *testing.T) {
+	defer patcher.SetVar(&now, func() time.Time { return time.Unix(1000, 0) }).Install().Restore()
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Error: &RetryableError{assert.AnError, time.Unix(999, 0)},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := obj.WaitFor(ctx, Key{"one", 1})
+
+	assert.Same(t, context.Canceled, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheWaitForCanceled(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := obj.WaitFor(ctx, Key{"one", 1})
+
+	assert.Same(t, context.Canceled, err)
+	assert.Nil(t, result)
+	assert.Equal(t, map[interface{}]*waiter{}, obj.indexes["one"].waiters)
+}
+
+func TestFCacheWaitForBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	result, err := obj.WaitFor(context.Background(), Key{"one", 1})
+
+	assert.Same(t, ErrBadIndex, err)
+	assert.Nil(t, result)
+}
+
+func TestFCacheSignal(t *testing.T) {
+	changed := make(chan struct{})
+	obj := &FCache{
+		changed: changed,
+	}
+
+	obj.signal()
+	obj.signal()
+
+	assert.Nil(t, obj.changed)
+	_, ok := <-changed
+	assert.False(t, ok)
+}
+
+func TestFCacheWaitSizeReached(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{
+					1: {
+						content: &Entry{
+							Object: "object",
+						},
+					},
+					2: {},
+				},
+			},
+		},
+	}
+
+	err := obj.WaitSize(context.Background(), "one", 1)
+
+	assert.NoError(t, err)
+	assert.Nil(t, obj.changed)
+}
+
+func TestFCacheWaitSizeInsert(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+	go func() {
+		for i := 1; i <= 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+			obj.Lock()
+			obj.insert(&Entry{
+				Object: i,
+				Keys:   []Key{{"one", i}},
+			})
+			obj.Unlock()
+		}
+	}()
+
+	err := obj.WaitSize(context.Background(), "one", 2)
+
+	assert.NoError(t, err)
+	assert.Len(t, obj.indexes["one"].entries, 2)
+}
+
+func TestFCacheWaitSizeCanceled(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{
+			"one": {
+				entries: map[interface{}]*entry{},
+			},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := obj.WaitSize(ctx, "one", 1)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestFCacheWaitSizeBadIndex(t *testing.T) {
+	obj := &FCache{
+		indexes: map[interface{}]index{},
+	}
+
+	err := obj.WaitSize(context.Background(), "one", 1)
+
+	assert.Same(t, ErrBadIndex, err)
+}